@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"im-system/client/internal/config"
 	"im-system/client/internal/controller"
+	"im-system/client/internal/repository"
 	"im-system/client/internal/service"
 	"im-system/client/pkg/logger"
 
@@ -24,19 +31,38 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// 初始化本地存储
+	trustRepo := repository.NewTrustRepository(cfg.DataDir)
+	keyLogRepo := repository.NewKeyLogRepository(cfg.DataDir)
+	keyStoreRepo := repository.NewKeyStoreRepository(cfg.DataDir)
+	sealedSenderRepo := repository.NewSealedSenderRepository(cfg.DataDir)
+	outboxRepo := repository.NewOutboxRepository(cfg.DataDir)
+
 	// 初始化服务层
 	serverService := service.NewServerService(cfg)
-	cryptoService := service.NewCryptoService()
-	wsService := service.NewWebSocketService(serverService, cryptoService)
+	identityService := service.NewIdentityService(serverService)
+	cryptoService := service.NewCryptoService(cfg)
+	transparencyService := service.NewTransparencyService(keyLogRepo, serverService, cfg)
+	keyStoreService := service.NewKeyStoreService(keyStoreRepo, serverService, cryptoService)
+	trustService := service.NewTrustService(trustRepo, serverService, transparencyService, keyStoreService, cfg)
+	backupService := service.NewBackupService(serverService, transparencyService, keyStoreService)
+	sealedSenderService := service.NewSealedSenderService(sealedSenderRepo, serverService, cryptoService, keyStoreService, cfg)
+	wsService := service.NewWebSocketService(serverService, identityService, trustService, sealedSenderService, outboxRepo)
 
 	// 初始化控制器
-	authCtrl := controller.NewAuthController(serverService, cryptoService)
-	messageCtrl := controller.NewMessageController(serverService, wsService, cryptoService)
+	authCtrl := controller.NewAuthController(serverService, cryptoService, keyStoreService, identityService)
+	messageCtrl := controller.NewMessageController(serverService, wsService, trustService, keyStoreService, sealedSenderService, identityService)
 	userCtrl := controller.NewUserController(serverService)
-	keyCtrl := controller.NewKeyController(serverService, cryptoService)
+	contactCtrl := controller.NewContactController(serverService)
+	sessionCtrl := controller.NewSessionController(serverService)
+	twoFactorCtrl := controller.NewTwoFactorController(serverService)
+	accountCtrl := controller.NewAccountController(serverService, keyStoreService, identityService)
+	keyCtrl := controller.NewKeyController(serverService, cryptoService, trustService, keyStoreService, identityService)
+	keyStoreCtrl := controller.NewKeyStoreController(keyStoreService, identityService)
+	backupCtrl := controller.NewBackupController(backupService, identityService)
 
 	// 设置路由
-	router := setupRouter(authCtrl, messageCtrl, userCtrl, keyCtrl, wsService)
+	router := setupRouter(authCtrl, messageCtrl, userCtrl, contactCtrl, sessionCtrl, twoFactorCtrl, accountCtrl, keyCtrl, keyStoreCtrl, backupCtrl, wsService)
 
 	// 启动服务器
 	port := os.Getenv("CLIENT_PORT")
@@ -44,27 +70,63 @@ func main() {
 		port = "3001"
 	}
 
-	logger.Info(fmt.Sprintf("🚀 IM Client Backend starting on port %s", port))
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Server error: %v", err)
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		logger.Info(fmt.Sprintf("🚀 IM Client Backend starting on port %s", port))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	logger.Info("Shutting down IM Client Backend...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	// 通知浏览器重新连接并关闭到服务端的连接，然后等待处理中的请求
+	if err := wsService.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Timed out closing WebSocket connections: %v", err)
 	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Timed out waiting for HTTP requests: %v", err)
+	}
+	logger.Info("IM Client Backend stopped")
 }
 
 func setupRouter(
 	authCtrl *controller.AuthController,
 	messageCtrl *controller.MessageController,
 	userCtrl *controller.UserController,
+	contactCtrl *controller.ContactController,
+	sessionCtrl *controller.SessionController,
+	twoFactorCtrl *controller.TwoFactorController,
+	accountCtrl *controller.AccountController,
 	keyCtrl *controller.KeyController,
+	keyStoreCtrl *controller.KeyStoreController,
+	backupCtrl *controller.BackupController,
 	wsService *service.WebSocketService,
 ) *gin.Engine {
 	router := gin.Default()
+	// 浏览器直接连接客户端后端，不信任 X-Forwarded-For
+	if err := router.SetTrustedProxies(nil); err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
+	}
 
 	// CORS 中间件
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -83,17 +145,66 @@ func setupRouter(
 		// 认证
 		api.POST("/auth/register", authCtrl.Register)
 		api.POST("/auth/login", authCtrl.Login)
+		api.POST("/auth/refresh", authCtrl.Refresh)
+		api.POST("/auth/logout", authCtrl.Logout)
+		api.POST("/auth/2fa/verify", authCtrl.VerifyTwoFactor)
+
+		// 两步验证
+		api.GET("/2fa", twoFactorCtrl.GetStatus)
+		api.POST("/2fa/setup", twoFactorCtrl.Setup)
+		api.POST("/2fa/activate", twoFactorCtrl.Activate)
+		api.POST("/2fa/disable", twoFactorCtrl.Disable)
+		api.POST("/2fa/recovery-codes", twoFactorCtrl.RegenerateRecoveryCodes)
+
+		// 会话（设备）管理
+		api.GET("/sessions", sessionCtrl.ListSessions)
+		api.DELETE("/sessions", sessionCtrl.RevokeOtherSessions)
+		api.DELETE("/sessions/:id", sessionCtrl.RevokeSession)
+
+		// 账户
+		api.PUT("/account/password", accountCtrl.ChangePassword)
+		api.DELETE("/account", accountCtrl.DeleteAccount)
+		api.GET("/account/export", accountCtrl.Export)
 
 		// WebSocket
 		api.GET("/ws", wsService.HandleWebSocket)
 
 		// 用户
-		api.GET("/users", userCtrl.GetAllUsers)
 		api.GET("/users/online", userCtrl.GetOnlineUsers)
+		api.GET("/users/search", userCtrl.SearchUsers)
+		api.GET("/users/me", userCtrl.GetMe)
+		api.PATCH("/users/me", userCtrl.UpdateMe)
+		api.GET("/users/me/privacy", userCtrl.GetPrivacy)
+		api.PUT("/users/me/privacy", userCtrl.UpdatePrivacy)
+		api.GET("/users/:id", userCtrl.GetUser)
+
+		// 联系人、好友请求与黑名单
+		api.GET("/contacts", contactCtrl.ListContacts)
+		api.DELETE("/contacts/:id", contactCtrl.RemoveContact)
+		api.GET("/contacts/requests", contactCtrl.ListRequests)
+		api.POST("/contacts/requests", contactCtrl.SendRequest)
+		api.POST("/contacts/requests/:id/accept", contactCtrl.AcceptRequest)
+		api.POST("/contacts/requests/:id/decline", contactCtrl.DeclineRequest)
+		api.GET("/blocks", contactCtrl.ListBlocked)
+		api.PUT("/blocks/:id", contactCtrl.Block)
+		api.DELETE("/blocks/:id", contactCtrl.Unblock)
 
 		// 密钥
 		api.POST("/keys/generate", keyCtrl.GenerateKeys)
+		api.POST("/keys/backup", backupCtrl.CreateBackup)
+		api.POST("/keys/backup/restore", backupCtrl.RestoreBackup)
+		api.DELETE("/keys/backup", backupCtrl.DeleteBackup)
 		api.GET("/keys/:userID", keyCtrl.GetPublicKey)
+		api.GET("/keys/:userID/safety-number", keyCtrl.GetSafetyNumber)
+		api.POST("/keys/:userID/verify", keyCtrl.VerifyKey)
+		api.POST("/keys/:userID/acknowledge", keyCtrl.AcknowledgeKey)
+
+		// 本地密钥库
+		api.GET("/keystore", keyStoreCtrl.GetStatus)
+		api.POST("/keystore/unlock", keyStoreCtrl.Unlock)
+		api.POST("/keystore/lock", keyStoreCtrl.Lock)
+		api.POST("/keystore/import", keyStoreCtrl.Import)
+		api.POST("/keystore/passphrase", keyStoreCtrl.ChangePassphrase)
 
 		// 消息
 		api.POST("/messages/send", messageCtrl.SendMessage)
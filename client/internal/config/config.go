@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +15,24 @@ type Config struct {
 
 	// 客户端配置
 	ClientPort string
+
+	// 本地数据目录（密钥指纹等持久化数据）
+	DataDir string
+
+	// 联系人公钥变更策略：block（阻止发送）或 warn（仅警告）
+	KeyChangePolicy string
+
+	// 服务端公钥透明日志的签名公钥（PEM），为空时首次使用即固定
+	KeyLogPublicKey string
+
+	// 是否启用密封发送（隐藏发送方身份）
+	SealedSender bool
+
+	// 本地支持的加密套件，按优先级排列，第一个套件决定新生成密钥的曲线
+	CipherSuites []int
+
+	// 收到 SIGTERM/SIGINT 后等待连接与请求结束的最长时间（秒）
+	ShutdownTimeoutSeconds int
 }
 
 // Load 加载配置
@@ -22,9 +42,16 @@ func Load() (*Config, error) {
 	_ = godotenv.Load(".env")
 
 	return &Config{
-		ServerHost: getEnv("SERVER_HOST", "localhost"),
-		ServerPort: getEnv("SERVER_PORT", "8080"),
-		ClientPort: getEnv("CLIENT_PORT", "3001"),
+		ServerHost:      getEnv("SERVER_HOST", "localhost"),
+		ServerPort:      getEnv("SERVER_PORT", "8080"),
+		ClientPort:      getEnv("CLIENT_PORT", "3001"),
+		DataDir:         getEnv("CLIENT_DATA_DIR", "./data"),
+		KeyChangePolicy: getEnv("KEY_CHANGE_POLICY", "block"),
+		KeyLogPublicKey: getEnv("KEYLOG_PUBLIC_KEY", ""),
+		SealedSender:    getEnv("SEALED_SENDER", "false") == "true",
+		CipherSuites:    getEnvInts("CIPHER_SUITES", "1,2"),
+
+		ShutdownTimeoutSeconds: getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30),
 	}, nil
 }
 
@@ -35,6 +62,23 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(getEnv(key, "")); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInts(key, defaultValue string) []int {
+	var values []int
+	for _, field := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value, err := strconv.Atoi(strings.TrimSpace(field)); err == nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // GetServerURL 获取服务端URL
 func (c *Config) GetServerURL() string {
 	return "http://" + c.ServerHost + ":" + c.ServerPort
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"im-system/client/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountController 账户管理控制器
+type AccountController struct {
+	serverService   service.ServerService
+	keyStoreService service.KeyStoreService
+	identityService service.IdentityService
+}
+
+// NewAccountController 创建账户管理控制器实例
+func NewAccountController(serverService service.ServerService, keyStoreService service.KeyStoreService, identityService service.IdentityService) *AccountController {
+	return &AccountController{
+		serverService:   serverService,
+		keyStoreService: keyStoreService,
+		identityService: identityService,
+	}
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// DeleteAccountRequest 删除账户请求
+type DeleteAccountRequest struct {
+	Password           string `json:"password" binding:"required"`
+	DeleteSentMessages bool   `json:"delete_sent_messages"`
+}
+
+// ChangePassword 修改登录密码，服务端会退出其他设备
+func (ctrl *AccountController) ChangePassword(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := ctrl.serverService.ChangePassword(token, req.CurrentPassword, req.NewPassword); err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// DeleteAccount 删除服务端账户，并删除本地密钥库
+func (ctrl *AccountController) DeleteAccount(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// 删除后令牌失效，先校验得到本地用户ID
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.serverService.DeleteAccount(token, req.Password, req.DeleteSentMessages); err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// 账户已删除，本地私钥不再有用
+	if err := ctrl.keyStoreService.Delete(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Account deleted, but failed to remove local keystore"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
+
+// Export 下载服务端导出的账户数据归档（消息保持加密状态）
+func (ctrl *AccountController) Export(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	archive, err := ctrl.serverService.ExportAccount(token)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("im-export-%s.json", time.Now().Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", archive)
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"net/http"
 
+	"im-system/client/internal/model"
 	"im-system/client/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -10,28 +11,41 @@ import (
 
 // AuthController 认证控制器
 type AuthController struct {
-	serverService service.ServerService
-	cryptoService service.CryptoService
+	serverService   service.ServerService
+	cryptoService   service.CryptoService
+	keyStoreService service.KeyStoreService
+	identityService service.IdentityService
 }
 
 // NewAuthController 创建认证控制器实例
-func NewAuthController(serverService service.ServerService, cryptoService service.CryptoService) *AuthController {
+func NewAuthController(
+	serverService service.ServerService,
+	cryptoService service.CryptoService,
+	keyStoreService service.KeyStoreService,
+	identityService service.IdentityService,
+) *AuthController {
 	return &AuthController{
-		serverService: serverService,
-		cryptoService: cryptoService,
+		serverService:   serverService,
+		cryptoService:   cryptoService,
+		keyStoreService: keyStoreService,
+		identityService: identityService,
 	}
 }
 
 // RegisterRequest 注册请求
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	Passphrase string `json:"passphrase" binding:"required"` // 本地密钥库口令，不会发送到服务端
+	DeviceName string `json:"device_name"`
 }
 
 // LoginRequest 登录请求
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	Passphrase string `json:"passphrase"` // 提供时登录后立即解锁本地密钥库
+	DeviceName string `json:"device_name"`
 }
 
 // Register 注册
@@ -43,31 +57,34 @@ func (ctrl *AuthController) Register(c *gin.Context) {
 	}
 
 	// 调用服务端注册
-	authResp, err := ctrl.serverService.Register(req.Username, req.Password)
+	authResp, err := ctrl.serverService.Register(req.Username, req.Password, deviceInfo(c, req.DeviceName))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	// 自动生成密钥对
-	keyPair, err := ctrl.serverService.GenerateKeys(authResp.Token)
+	// 在本地生成密钥对，私钥加密保存到密钥库，只上传公钥
+	keyStore, err := ctrl.keyStoreService.Provision(authResp.Token, authResp.UserID, req.Passphrase)
 	if err != nil {
 		// 密钥生成失败不影响注册，只记录错误
 		c.JSON(http.StatusOK, gin.H{
-			"token":    authResp.Token,
-			"user_id":  authResp.UserID,
-			"username": authResp.Username,
-			"error":    "Failed to generate keys: " + err.Error(),
+			"token":         authResp.Token,
+			"refresh_token": authResp.RefreshToken,
+			"expires_in":    authResp.ExpiresIn,
+			"user_id":       authResp.UserID,
+			"username":      authResp.Username,
+			"error":         "Failed to generate keys: " + err.Error(),
 		})
 		return
 	}
 
-	// 返回token和私钥（私钥需要客户端保存）
 	c.JSON(http.StatusOK, gin.H{
-		"token":       authResp.Token,
-		"user_id":     authResp.UserID,
-		"username":    authResp.Username,
-		"private_key": keyPair.PrivateKey,
+		"token":         authResp.Token,
+		"refresh_token": authResp.RefreshToken,
+		"expires_in":    authResp.ExpiresIn,
+		"user_id":       authResp.UserID,
+		"username":      authResp.Username,
+		"keystore":      keyStore,
 	})
 }
 
@@ -80,29 +97,139 @@ func (ctrl *AuthController) Login(c *gin.Context) {
 	}
 
 	// 调用服务端登录
-	authResp, err := ctrl.serverService.Login(req.Username, req.Password)
+	authResp, err := ctrl.serverService.Login(req.Username, req.Password, deviceInfo(c, req.DeviceName))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	// 尝试生成密钥对（如果用户还没有）
-	keyPair, err := ctrl.serverService.GenerateKeys(authResp.Token)
-	if err != nil {
-		// 可能已经存在密钥，这是正常的
+	// 开启了两步验证：返回挑战令牌，验证通过后再解锁密钥库
+	if authResp.TwoFactorRequired {
 		c.JSON(http.StatusOK, gin.H{
-			"token":    authResp.Token,
-			"user_id":  authResp.UserID,
-			"username": authResp.Username,
+			"two_factor_required": true,
+			"challenge_token":     authResp.ChallengeToken,
+			"expires_in":          authResp.ExpiresIn,
 		})
 		return
 	}
 
-	// 返回token和私钥
-	c.JSON(http.StatusOK, gin.H{
-		"token":       authResp.Token,
-		"user_id":     authResp.UserID,
-		"username":    authResp.Username,
-		"private_key": keyPair.PrivateKey,
-	})
+	ctrl.respondLoggedIn(c, authResp, req.Passphrase)
+}
+
+// VerifyTwoFactorRequest 两步验证登录请求
+type VerifyTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+	Passphrase     string `json:"passphrase"` // 提供时登录后立即解锁本地密钥库
+	DeviceName     string `json:"device_name"`
+}
+
+// VerifyTwoFactor 使用挑战令牌与验证码（或恢复码）完成登录
+func (ctrl *AuthController) VerifyTwoFactor(c *gin.Context) {
+	var req VerifyTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	authResp, err := ctrl.serverService.VerifyTwoFactor(req.ChallengeToken, req.Code, deviceInfo(c, req.DeviceName))
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	ctrl.respondLoggedIn(c, authResp, req.Passphrase)
+}
+
+// respondLoggedIn 登录成功后解锁本地密钥库并返回令牌
+func (ctrl *AuthController) respondLoggedIn(c *gin.Context, authResp *model.AuthResponse, passphrase string) {
+	resp := gin.H{
+		"token":         authResp.Token,
+		"refresh_token": authResp.RefreshToken,
+		"expires_in":    authResp.ExpiresIn,
+		"user_id":       authResp.UserID,
+		"username":      authResp.Username,
+	}
+
+	keyStore, err := ctrl.openKeyStore(authResp.Token, authResp.UserID, passphrase)
+	if err != nil {
+		// 密钥库解锁失败不影响登录，前端可稍后调用解锁接口
+		resp["keystore_error"] = err.Error()
+	}
+	resp["keystore"] = keyStore
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RefreshRequest 刷新令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌
+func (ctrl *AuthController) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	tokens, err := ctrl.serverService.RefreshToken(req.RefreshToken, deviceInfo(c, ""))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout 退出登录：吊销服务端会话并锁定本地密钥库
+func (ctrl *AuthController) Logout(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	if userID, err := ctrl.identityService.UserID(token); err == nil {
+		ctrl.keyStoreService.Lock(userID)
+	}
+
+	if err := ctrl.serverService.Logout(token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// openKeyStore 登录后解锁本地密钥库；本地和服务端都没有密钥时生成新的密钥对
+func (ctrl *AuthController) openKeyStore(token string, userID int, passphrase string) (*model.KeyStoreStatus, error) {
+	status, err := ctrl.keyStoreService.Status(userID)
+	if err != nil || passphrase == "" {
+		return status, err
+	}
+
+	if status.Exists {
+		if err := ctrl.keyStoreService.Unlock(userID, passphrase); err != nil {
+			return status, err
+		}
+		return ctrl.keyStoreService.Status(userID)
+	}
+
+	// 服务端已有公钥说明私钥在其他设备上，需要导入或从备份恢复
+	if _, err := ctrl.serverService.GetPublicKey(token, userID); err == nil {
+		return status, service.ErrKeyStoreNotFound
+	}
+
+	return ctrl.keyStoreService.Provision(token, userID, passphrase)
+}
+
+// deviceInfo 记录浏览器的设备信息，由服务端保存在会话中
+func deviceInfo(c *gin.Context, deviceName string) *model.DeviceInfo {
+	return &model.DeviceInfo{
+		Name:      deviceName,
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
 }
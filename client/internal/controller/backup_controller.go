@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"net/http"
+
+	"im-system/client/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BackupController 私钥备份控制器
+type BackupController struct {
+	backupService   service.BackupService
+	identityService service.IdentityService
+}
+
+// NewBackupController 创建私钥备份控制器实例
+func NewBackupController(backupService service.BackupService, identityService service.IdentityService) *BackupController {
+	return &BackupController{
+		backupService:   backupService,
+		identityService: identityService,
+	}
+}
+
+// CreateBackupRequest 创建私钥备份请求
+type CreateBackupRequest struct {
+	RecoveryPassphrase string `json:"recovery_passphrase" binding:"required"`
+}
+
+// RestoreBackupRequest 恢复私钥备份请求
+type RestoreBackupRequest struct {
+	RecoveryPassphrase string `json:"recovery_passphrase" binding:"required"`
+	Passphrase         string `json:"passphrase" binding:"required"`
+}
+
+// CreateBackup 使用恢复口令加密私钥并上传到服务端
+func (ctrl *BackupController) CreateBackup(c *gin.Context) {
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	var req CreateBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	token := getTokenFromHeader(c)
+	if err := ctrl.backupService.Backup(token, userID, req.RecoveryPassphrase); err != nil {
+		if err == service.ErrWeakRecoveryPassphrase {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			respondKeyStoreError(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Key backup created"})
+}
+
+// RestoreBackup 从服务端下载备份并恢复到本地密钥库
+func (ctrl *BackupController) RestoreBackup(c *gin.Context) {
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	var req RestoreBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	token := getTokenFromHeader(c)
+	status, err := ctrl.backupService.Restore(token, userID, req.RecoveryPassphrase, req.Passphrase)
+	if err != nil {
+		if serverErr, ok := err.(*service.ServerError); ok {
+			c.Data(serverErr.StatusCode, "application/json", []byte(serverErr.Body))
+		} else if err == service.ErrBackupMismatch || err == service.ErrBackupKeyMismatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			respondKeyStoreError(c, err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// DeleteBackup 删除服务端的私钥备份
+func (ctrl *BackupController) DeleteBackup(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if err := ctrl.backupService.Delete(token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Key backup deleted"})
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"im-system/client/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContactController 联系人、好友请求与黑名单控制器
+type ContactController struct {
+	serverService service.ServerService
+}
+
+// NewContactController 创建联系人控制器实例
+func NewContactController(serverService service.ServerService) *ContactController {
+	return &ContactController{
+		serverService: serverService,
+	}
+}
+
+// ContactRequestRequest 发送好友请求，user_id 与 username 二选一
+type ContactRequestRequest struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// ListContacts 获取联系人列表
+func (ctrl *ContactController) ListContacts(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	contacts, err := ctrl.serverService.GetContacts(token)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": contacts})
+}
+
+// RemoveContact 删除联系人
+func (ctrl *ContactController) RemoveContact(c *gin.Context) {
+	ctrl.withUserID(c, ctrl.serverService.RemoveContact, "Contact removed successfully")
+}
+
+// ListRequests 获取收到与发出的好友请求
+func (ctrl *ContactController) ListRequests(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	requests, err := ctrl.serverService.GetContactRequests(token)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// SendRequest 发送好友请求
+func (ctrl *ContactController) SendRequest(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	var req ContactRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.UserID == 0 && req.Username == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	result, err := ctrl.serverService.SendContactRequest(token, req.UserID, req.Username)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// AcceptRequest 接受好友请求
+func (ctrl *ContactController) AcceptRequest(c *gin.Context) {
+	ctrl.withRequestID(c, ctrl.serverService.AcceptContactRequest, "Contact request accepted")
+}
+
+// DeclineRequest 拒绝或撤回好友请求
+func (ctrl *ContactController) DeclineRequest(c *gin.Context) {
+	ctrl.withRequestID(c, ctrl.serverService.DeclineContactRequest, "Contact request declined")
+}
+
+// ListBlocked 获取黑名单
+func (ctrl *ContactController) ListBlocked(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	blocked, err := ctrl.serverService.GetBlockedUsers(token)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": blocked})
+}
+
+// Block 拉黑用户
+func (ctrl *ContactController) Block(c *gin.Context) {
+	ctrl.withUserID(c, ctrl.serverService.BlockUser, "User blocked")
+}
+
+// Unblock 取消拉黑
+func (ctrl *ContactController) Unblock(c *gin.Context) {
+	ctrl.withUserID(c, ctrl.serverService.UnblockUser, "User unblocked")
+}
+
+// withUserID 解析路径中的用户ID并调用服务端
+func (ctrl *ContactController) withUserID(c *gin.Context, call func(token string, userID int) error, message string) {
+	ctrl.withIDParam(c, "Invalid user ID", call, message)
+}
+
+// withRequestID 解析路径中的请求ID并调用服务端
+func (ctrl *ContactController) withRequestID(c *gin.Context, call func(token string, requestID int) error, message string) {
+	ctrl.withIDParam(c, "Invalid request ID", call, message)
+}
+
+func (ctrl *ContactController) withIDParam(c *gin.Context, invalid string, call func(token string, id int) error, message string) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid})
+		return
+	}
+
+	if err := call(token, id); err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,40 +12,68 @@ import (
 
 // KeyController 密钥控制器
 type KeyController struct {
-	serverService service.ServerService
-	cryptoService service.CryptoService
+	serverService   service.ServerService
+	cryptoService   service.CryptoService
+	trustService    service.TrustService
+	keyStoreService service.KeyStoreService
+	identityService service.IdentityService
 }
 
 // NewKeyController 创建密钥控制器实例
-func NewKeyController(serverService service.ServerService, cryptoService service.CryptoService) *KeyController {
+func NewKeyController(
+	serverService service.ServerService,
+	cryptoService service.CryptoService,
+	trustService service.TrustService,
+	keyStoreService service.KeyStoreService,
+	identityService service.IdentityService,
+) *KeyController {
 	return &KeyController{
-		serverService: serverService,
-		cryptoService: cryptoService,
+		serverService:   serverService,
+		cryptoService:   cryptoService,
+		trustService:    trustService,
+		keyStoreService: keyStoreService,
+		identityService: identityService,
 	}
 }
 
-// GenerateKeys 生成密钥对
+// GenerateKeysRequest 生成密钥对请求
+type GenerateKeysRequest struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// VerifyKeyRequest 校验安全码请求
+type VerifyKeyRequest struct {
+	SafetyNumber string `json:"safety_number" binding:"required"`
+}
+
+// GenerateKeys 在本地生成新的密钥对，私钥保存到密钥库，只上传公钥
 func (ctrl *KeyController) GenerateKeys(c *gin.Context) {
 	token := getTokenFromHeader(c)
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
 		return
 	}
 
-	keyPair, err := ctrl.serverService.GenerateKeys(token)
+	var req GenerateKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	status, err := ctrl.keyStoreService.Provision(token, userID, req.Passphrase)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, keyPair)
+	c.JSON(http.StatusOK, gin.H{"public_key": status.PublicKey})
 }
 
 // GetPublicKey 获取用户公钥
 func (ctrl *KeyController) GetPublicKey(c *gin.Context) {
 	token := getTokenFromHeader(c)
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+	ownerID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
 		return
 	}
 
@@ -55,11 +84,106 @@ func (ctrl *KeyController) GetPublicKey(c *gin.Context) {
 		return
 	}
 
-	publicKey, err := ctrl.serverService.GetPublicKey(token, userID)
-	if err != nil {
+	// 公钥变更时仍返回公钥，由前端根据信任状态提示用户
+	bundle, trust, err := ctrl.trustService.ResolveContactKey(token, ownerID, userID)
+	if errors.Is(err, service.ErrKeyTransparency) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "key_unverifiable"})
+		return
+	}
+	if err != nil && err != service.ErrKeyChanged {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"public_key": publicKey})
+	c.JSON(http.StatusOK, gin.H{
+		"public_key":    bundle.PublicKey,
+		"cipher_suites": bundle.CipherSuites,
+		"trust":         trust,
+	})
+}
+
+// GetSafetyNumber 获取与联系人之间的安全码
+func (ctrl *KeyController) GetSafetyNumber(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	ownerID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	safetyNumber, err := ctrl.trustService.GetSafetyNumber(token, ownerID, userID)
+	if err != nil {
+		if err == service.ErrKeyStoreLocked {
+			c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, safetyNumber)
+}
+
+// VerifyKey 比对安全码后标记联系人公钥为已验证
+func (ctrl *KeyController) VerifyKey(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	ownerID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req VerifyKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	trust, err := ctrl.trustService.Verify(token, ownerID, userID, req.SafetyNumber)
+	if err != nil {
+		switch err {
+		case service.ErrSafetyNumberMismatch, service.ErrOwnKeyMismatch:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case service.ErrKeyStoreLocked:
+			c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"trust": trust})
+}
+
+// AcknowledgeKey 确认接受联系人变更后的公钥
+func (ctrl *KeyController) AcknowledgeKey(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	ownerID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	trust, err := ctrl.trustService.Acknowledge(token, ownerID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"trust": trust})
 }
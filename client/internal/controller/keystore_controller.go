@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"net/http"
+
+	"im-system/client/internal/service"
+	"im-system/client/pkg/crypto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyStoreController 本地密钥库控制器
+type KeyStoreController struct {
+	keyStoreService service.KeyStoreService
+	identityService service.IdentityService
+}
+
+// NewKeyStoreController 创建密钥库控制器实例
+func NewKeyStoreController(keyStoreService service.KeyStoreService, identityService service.IdentityService) *KeyStoreController {
+	return &KeyStoreController{
+		keyStoreService: keyStoreService,
+		identityService: identityService,
+	}
+}
+
+// UnlockKeyStoreRequest 解锁密钥库请求
+type UnlockKeyStoreRequest struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// ImportKeyRequest 导入私钥请求（用于迁移浏览器中保存的旧私钥）
+type ImportKeyRequest struct {
+	PrivateKey string `json:"private_key" binding:"required"`
+	Passphrase string `json:"passphrase" binding:"required"`
+	Replace    bool   `json:"replace"`
+}
+
+// ChangePassphraseRequest 修改密钥库口令请求
+type ChangePassphraseRequest struct {
+	OldPassphrase string `json:"old_passphrase" binding:"required"`
+	NewPassphrase string `json:"new_passphrase" binding:"required"`
+}
+
+// GetStatus 获取密钥库状态
+func (ctrl *KeyStoreController) GetStatus(c *gin.Context) {
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	status, err := ctrl.keyStoreService.Status(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Unlock 使用口令解锁密钥库
+func (ctrl *KeyStoreController) Unlock(c *gin.Context) {
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	var req UnlockKeyStoreRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := ctrl.keyStoreService.Unlock(userID, req.Passphrase); err != nil {
+		respondKeyStoreError(c, err)
+		return
+	}
+
+	status, err := ctrl.keyStoreService.Status(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Lock 锁定密钥库，清除内存中的私钥
+func (ctrl *KeyStoreController) Lock(c *gin.Context) {
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	ctrl.keyStoreService.Lock(userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Keystore locked"})
+}
+
+// Import 导入已有私钥到密钥库
+func (ctrl *KeyStoreController) Import(c *gin.Context) {
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	var req ImportKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	status, err := ctrl.keyStoreService.Status(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status.Exists && !req.Replace {
+		c.JSON(http.StatusConflict, gin.H{"error": "Keystore already exists"})
+		return
+	}
+
+	status, err = ctrl.keyStoreService.Store(userID, req.PrivateKey, req.Passphrase)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// ChangePassphrase 修改密钥库口令
+func (ctrl *KeyStoreController) ChangePassphrase(c *gin.Context) {
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
+		return
+	}
+
+	var req ChangePassphraseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := ctrl.keyStoreService.ChangePassphrase(userID, req.OldPassphrase, req.NewPassphrase); err != nil {
+		respondKeyStoreError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passphrase changed"})
+}
+
+// 辅助函数：将密钥库错误转换为 HTTP 响应
+func respondKeyStoreError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrKeyStoreNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case crypto.ErrInvalidPassphrase:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case service.ErrKeyStoreLocked:
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
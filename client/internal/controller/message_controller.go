@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"errors"
+	"log"
 	"net/http"
 
+	"im-system/client/internal/model"
 	"im-system/client/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -10,21 +13,30 @@ import (
 
 // MessageController 消息控制器
 type MessageController struct {
-	serverService service.ServerService
-	wsService     *service.WebSocketService
-	cryptoService service.CryptoService
+	serverService       service.ServerService
+	wsService           *service.WebSocketService
+	trustService        service.TrustService
+	keyStoreService     service.KeyStoreService
+	sealedSenderService service.SealedSenderService
+	identityService     service.IdentityService
 }
 
 // NewMessageController 创建消息控制器实例
 func NewMessageController(
 	serverService service.ServerService,
 	wsService *service.WebSocketService,
-	cryptoService service.CryptoService,
+	trustService service.TrustService,
+	keyStoreService service.KeyStoreService,
+	sealedSenderService service.SealedSenderService,
+	identityService service.IdentityService,
 ) *MessageController {
 	return &MessageController{
-		serverService: serverService,
-		wsService:     wsService,
-		cryptoService: cryptoService,
+		serverService:       serverService,
+		wsService:           wsService,
+		trustService:        trustService,
+		keyStoreService:     keyStoreService,
+		sealedSenderService: sealedSenderService,
+		identityService:     identityService,
 	}
 }
 
@@ -32,13 +44,15 @@ func NewMessageController(
 type SendMessageRequest struct {
 	ReceiverID int    `json:"receiver_id" binding:"required"`
 	Content    string `json:"content" binding:"required"`
+	// ClientMessageID 可选的客户端消息ID（UUID），重试时服务端返回已有消息
+	ClientMessageID string `json:"client_message_id"`
 }
 
 // SendMessage 发送消息
 func (ctrl *MessageController) SendMessage(c *gin.Context) {
 	token := getTokenFromHeader(c)
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
 		return
 	}
 
@@ -48,43 +62,74 @@ func (ctrl *MessageController) SendMessage(c *gin.Context) {
 		return
 	}
 
-	// 获取接收者公钥
-	publicKey, err := ctrl.serverService.GetPublicKey(token, req.ReceiverID)
+	// 获取接收者公钥并校验是否与固定的公钥一致
+	publicKey, trust, err := ctrl.trustService.ResolveContactKey(token, userID, req.ReceiverID)
+	if err == service.ErrKeyChanged {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"code":  "key_changed",
+			"trust": trust,
+		})
+		return
+	}
+	if errors.Is(err, service.ErrKeyTransparency) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+			"code":  "key_unverifiable",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get receiver's public key"})
 		return
 	}
 
-	// 加密消息
-	encryptedContent, err := ctrl.cryptoService.Encrypt(publicKey, req.Content)
+	// 已知接收方投递令牌时密封发送
+	messageID, sealed, err := ctrl.sealedSenderService.SendSealed(token, userID, req.ReceiverID, publicKey, req.Content)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt message"})
-		return
+		log.Printf("Failed to send sealed message: %v", err)
 	}
 
-	// 发送到服务端
-	messageID, err := ctrl.serverService.SendMessage(token, req.ReceiverID, encryptedContent)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	if !sealed {
+		// 加密消息
+		encryptedContent, err := ctrl.sealedSenderService.Encrypt(token, userID, req.ReceiverID, publicKey, req.Content)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt message"})
+			return
+		}
+
+		// 发送到服务端
+		messageID, err = ctrl.serverService.SendMessage(token, req.ReceiverID, encryptedContent, req.ClientMessageID)
+		if err != nil {
+			c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"message_id": messageID,
 		"status":     "sent",
-	})
+		"sealed":     sealed,
+	}
+	if req.ClientMessageID != "" {
+		resp["client_message_id"] = req.ClientMessageID
+	}
+	if trust.Status == model.KeyTrustChanged {
+		resp["warning"] = "Receiver's public key has changed"
+		resp["trust"] = trust
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 // GetUnreadMessages 获取未读消息
 func (ctrl *MessageController) GetUnreadMessages(c *gin.Context) {
 	token := getTokenFromHeader(c)
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+	userID, ok := getUserIDFromToken(c, ctrl.identityService)
+	if !ok {
 		return
 	}
 
-	privateKey := c.GetHeader("X-Private-Key")
-
 	// 获取未读消息
 	messages, err := ctrl.serverService.GetUnreadMessages(token)
 	if err != nil {
@@ -92,14 +137,22 @@ func (ctrl *MessageController) GetUnreadMessages(c *gin.Context) {
 		return
 	}
 
-	// 如果有私钥，解密消息
-	if privateKey != "" {
-		for i := range messages {
-			if messages[i].EncryptedContent != "" {
-				decrypted, err := ctrl.cryptoService.Decrypt(privateKey, messages[i].EncryptedContent)
-				if err == nil {
-					messages[i].Content = decrypted
-				}
+	// 使用本地密钥库中已解锁的私钥解密
+	if _, err := ctrl.keyStoreService.PrivateKey(userID); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"messages":        messages,
+			"keystore_locked": true,
+		})
+		return
+	}
+
+	for i := range messages {
+		msg := &messages[i]
+		if msg.EncryptedContent != "" {
+			content, senderID, err := ctrl.sealedSenderService.Open(userID, msg.Sealed, msg.SenderID, msg.EncryptedContent, msg.CreatedAt)
+			if err == nil {
+				msg.Content = content
+				msg.SenderID = senderID
 			}
 		}
 	}
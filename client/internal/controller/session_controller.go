@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"im-system/client/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionController 会话（设备）管理控制器
+type SessionController struct {
+	serverService service.ServerService
+}
+
+// NewSessionController 创建会话管理控制器实例
+func NewSessionController(serverService service.ServerService) *SessionController {
+	return &SessionController{
+		serverService: serverService,
+	}
+}
+
+// ListSessions 列出已登录的设备
+func (ctrl *SessionController) ListSessions(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	sessions, err := ctrl.serverService.ListSessions(token)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession 远程退出指定设备
+func (ctrl *SessionController) RevokeSession(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	if err := ctrl.serverService.RevokeSession(token, c.Param("id")); err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeOtherSessions 退出除当前设备外的所有设备
+func (ctrl *SessionController) RevokeOtherSessions(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	revoked, err := ctrl.serverService.RevokeOtherSessions(token)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
+
+// serverErrorStatus 透传服务端返回的 4xx 状态码，其他错误视为内部错误
+func serverErrorStatus(err error) int {
+	var serverErr *service.ServerError
+	if errors.As(err, &serverErr) && serverErr.StatusCode >= 400 && serverErr.StatusCode < 500 {
+		return serverErr.StatusCode
+	}
+	return http.StatusInternalServerError
+}
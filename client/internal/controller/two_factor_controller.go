@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"net/http"
+
+	"im-system/client/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorController 两步验证控制器
+type TwoFactorController struct {
+	serverService service.ServerService
+}
+
+// NewTwoFactorController 创建两步验证控制器实例
+func NewTwoFactorController(serverService service.ServerService) *TwoFactorController {
+	return &TwoFactorController{
+		serverService: serverService,
+	}
+}
+
+// TwoFactorCodeRequest 需要当前验证码的请求
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// GetStatus 获取两步验证状态
+func (ctrl *TwoFactorController) GetStatus(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	status, err := ctrl.serverService.GetTwoFactorStatus(token)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// Setup 生成新的两步验证密钥，激活前不生效
+func (ctrl *TwoFactorController) Setup(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	setup, err := ctrl.serverService.SetupTwoFactor(token)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// Activate 校验验证码后启用两步验证，返回一次性恢复码
+func (ctrl *TwoFactorController) Activate(c *gin.Context) {
+	ctrl.withCode(c, func(token, code string) (gin.H, error) {
+		codes, err := ctrl.serverService.ActivateTwoFactor(token, code)
+		return gin.H{"recovery_codes": codes}, err
+	})
+}
+
+// Disable 校验验证码后关闭两步验证
+func (ctrl *TwoFactorController) Disable(c *gin.Context) {
+	ctrl.withCode(c, func(token, code string) (gin.H, error) {
+		err := ctrl.serverService.DisableTwoFactor(token, code)
+		return gin.H{"message": "Two-factor authentication disabled"}, err
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部作废
+func (ctrl *TwoFactorController) RegenerateRecoveryCodes(c *gin.Context) {
+	ctrl.withCode(c, func(token, code string) (gin.H, error) {
+		codes, err := ctrl.serverService.RegenerateRecoveryCodes(token, code)
+		return gin.H{"recovery_codes": codes}, err
+	})
+}
+
+// withCode 解析令牌与验证码后调用服务端
+func (ctrl *TwoFactorController) withCode(c *gin.Context, call func(token, code string) (gin.H, error)) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	resp, err := call(token, req.Code)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
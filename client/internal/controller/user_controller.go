@@ -2,7 +2,9 @@ package controller
 
 import (
 	"net/http"
+	"strconv"
 
+	"im-system/client/internal/model"
 	"im-system/client/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -20,38 +22,142 @@ func NewUserController(serverService service.ServerService) *UserController {
 	}
 }
 
-// GetAllUsers 获取所有用户
-func (ctrl *UserController) GetAllUsers(c *gin.Context) {
+// GetOnlineUsers 获取在线的联系人
+func (ctrl *UserController) GetOnlineUsers(c *gin.Context) {
 	token := getTokenFromHeader(c)
 	if token == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
 		return
 	}
 
-	users, err := ctrl.serverService.GetAllUsers(token)
+	users, err := ctrl.serverService.GetOnlineUsers(token)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	c.JSON(http.StatusOK, gin.H{"online_users": users})
 }
 
-// GetOnlineUsers 获取在线用户
-func (ctrl *UserController) GetOnlineUsers(c *gin.Context) {
+// GetMe 获取当前用户的资料
+func (ctrl *UserController) GetMe(c *gin.Context) {
 	token := getTokenFromHeader(c)
 	if token == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
 		return
 	}
 
-	users, err := ctrl.serverService.GetOnlineUsers(token)
+	profile, err := ctrl.serverService.GetMyProfile(token)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"online_users": users})
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateMe 修改当前用户的资料
+func (ctrl *UserController) UpdateMe(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	var req model.ProfileUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	profile, err := ctrl.serverService.UpdateMyProfile(token, &req)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetUser 获取指定用户的资料
+func (ctrl *UserController) GetUser(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	profile, err := ctrl.serverService.GetUserProfile(token, userID)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// SearchUsers 按用户名或显示名称搜索用户
+func (ctrl *UserController) SearchUsers(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	page, err := ctrl.serverService.SearchUsers(token, c.Query("q"), c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetPrivacy 获取隐私设置
+func (ctrl *UserController) GetPrivacy(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	privacy, err := ctrl.serverService.GetPrivacy(token)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, privacy)
+}
+
+// UpdatePrivacy 修改隐私设置（谁可以发消息、是否可被搜索）
+func (ctrl *UserController) UpdatePrivacy(c *gin.Context) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return
+	}
+
+	var req model.PrivacyUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	privacy, err := ctrl.serverService.UpdatePrivacy(token, &req)
+	if err != nil {
+		c.JSON(serverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, privacy)
 }
 
 // 辅助函数：从header获取token
@@ -62,3 +168,23 @@ func getTokenFromHeader(c *gin.Context) string {
 	}
 	return token
 }
+
+// 辅助函数：通过服务端校验header中的token并得到用户ID，失败时直接返回错误响应
+func getUserIDFromToken(c *gin.Context, identityService service.IdentityService) (int, bool) {
+	token := getTokenFromHeader(c)
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
+		return 0, false
+	}
+
+	userID, err := identityService.UserID(token)
+	if err == service.ErrInvalidToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return 0, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify token with server"})
+		return 0, false
+	}
+	return userID, true
+}
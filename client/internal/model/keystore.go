@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"im-system/client/pkg/crypto"
+)
+
+// KeyStoreEntry 本地密钥库中的加密私钥
+type KeyStoreEntry struct {
+	UserID     int               `json:"user_id"`
+	PublicKey  string            `json:"public_key"`
+	PrivateKey *crypto.SealedBox `json:"private_key"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// KeyStoreStatus 密钥库状态
+type KeyStoreStatus struct {
+	UserID    int    `json:"user_id"`
+	Exists    bool   `json:"exists"`
+	Unlocked  bool   `json:"unlocked"`
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// KeyBundle 私钥备份中加密保存的密钥包
+type KeyBundle struct {
+	Version    int       `json:"version"`
+	UserID     int       `json:"user_id"`
+	PublicKey  string    `json:"public_key"`
+	PrivateKey string    `json:"private_key"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// KeyBackup 服务端保存的私钥备份（Backup 为 SealedBox 的 JSON 密文）
+type KeyBackup struct {
+	UserID    int       `json:"user_id"`
+	Backup    string    `json:"backup"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
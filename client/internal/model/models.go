@@ -2,21 +2,118 @@ package model
 
 // AuthRequest 认证请求
 type AuthRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name,omitempty"`
+	DeviceIP   string `json:"device_ip,omitempty"`
+}
+
+// DeviceInfo 浏览器所在设备的信息，转发给服务端记录在会话中
+type DeviceInfo struct {
+	Name      string
+	UserAgent string
+	IPAddress string
+}
+
+// Session 服务端记录的登录会话（设备）
+type Session struct {
+	ID         string `json:"id"`
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
+	ExpiresAt  string `json:"expires_at"`
+	Current    bool   `json:"current"`
 }
 
 // AuthResponse 认证响应
 type AuthResponse struct {
-	Token    string `json:"token"`
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	UserID       int    `json:"user_id"`
+	Username     string `json:"username"`
+
+	// 开启两步验证时只返回挑战令牌
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+// TwoFactorStatus 两步验证状态
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
 }
 
-// User 用户信息
+// TwoFactorSetup 两步验证密钥及供验证器应用扫描的 URI
+type TwoFactorSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TokenPair 刷新后的访问令牌与刷新令牌
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// User 用户信息及资料
 type User struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	DisplayName   string `json:"display_name"`
+	Bio           string `json:"bio"`
+	StatusMessage string `json:"status_message"`
+	AvatarRef     string `json:"avatar_ref"`
+}
+
+// PrivacySettings 隐私设置
+type PrivacySettings struct {
+	MessagePrivacy string `json:"message_privacy"`
+	Discoverable   bool   `json:"discoverable"`
+}
+
+// PrivacyUpdate 隐私设置修改请求，为 nil 的字段保持不变
+type PrivacyUpdate struct {
+	MessagePrivacy *string `json:"message_privacy,omitempty"`
+	Discoverable   *bool   `json:"discoverable,omitempty"`
+}
+
+// UserSearchPage 一页用户搜索结果
+type UserSearchPage struct {
+	Users      []User `json:"users"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ContactRequest 待处理的好友请求，User 为请求的另一方
+type ContactRequest struct {
+	ID         int    `json:"id"`
+	FromUserID int    `json:"from_user_id"`
+	ToUserID   int    `json:"to_user_id"`
+	User       *User  `json:"user,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// ContactRequests 收到与发出的好友请求
+type ContactRequests struct {
+	Incoming []ContactRequest `json:"incoming"`
+	Outgoing []ContactRequest `json:"outgoing"`
+}
+
+// ContactRequestResult 发送好友请求的结果，对方已发出请求时直接成为联系人
+type ContactRequestResult struct {
+	Accepted bool            `json:"accepted"`
+	Request  *ContactRequest `json:"request,omitempty"`
+}
+
+// ProfileUpdate 资料修改请求，为 nil 的字段保持不变
+type ProfileUpdate struct {
+	DisplayName   *string `json:"display_name,omitempty"`
+	Bio           *string `json:"bio,omitempty"`
+	StatusMessage *string `json:"status_message,omitempty"`
+	AvatarRef     *string `json:"avatar_ref,omitempty"`
 }
 
 // Message 消息
@@ -26,6 +123,7 @@ type Message struct {
 	ReceiverID       int    `json:"receiver_id"`
 	EncryptedContent string `json:"encrypted_content"`
 	Content          string `json:"content"` // 解密后的内容
+	Sealed           bool   `json:"sealed,omitempty"`
 	IsRead           bool   `json:"is_read"`
 	CreatedAt        string `json:"created_at"`
 }
@@ -36,6 +134,12 @@ type KeyPair struct {
 	PrivateKey string `json:"private_key"`
 }
 
+// PublicKeyBundle 服务端返回的用户公钥及其公布的加密套件
+type PublicKeyBundle struct {
+	PublicKey    string `json:"public_key"`
+	CipherSuites []int  `json:"cipher_suites"`
+}
+
 // WSMessage WebSocket 消息
 type WSMessage struct {
 	Type       string `json:"type"`
@@ -44,4 +148,11 @@ type WSMessage struct {
 	Content    string `json:"content,omitempty"`
 	MessageID  int    `json:"message_id,omitempty"`
 	Timestamp  string `json:"timestamp,omitempty"`
+	Sealed     bool   `json:"sealed,omitempty"`
+	// ClientMessageID 浏览器生成的消息ID（UUID），发送确认与错误原样带回
+	ClientMessageID string `json:"client_message_id,omitempty"`
+	// EventID 服务端发件箱事件的幂等键，同一事件可能重复推送
+	EventID string `json:"event_id,omitempty"`
+	// Profile profile_updated、contact_request、contact_added 事件携带的用户资料
+	Profile *User `json:"profile,omitempty"`
 }
@@ -0,0 +1,25 @@
+package model
+
+// SenderCertificateData 服务端签发的发送方证书内容
+type SenderCertificateData struct {
+	SenderID  int    `json:"sender_id"`
+	Username  string `json:"username"`
+	PublicKey string `json:"public_key"`
+	Expires   int64  `json:"expires"` // 毫秒时间戳
+}
+
+// SenderCertificate 带服务端签名的发送方证书
+type SenderCertificate struct {
+	Certificate []byte `json:"certificate"` // SenderCertificateData 的 JSON 编码
+	Signature   []byte `json:"signature"`
+}
+
+// Envelope 消息信封，加密后作为消息密文发送
+// 携带发送方的投递令牌，密封发送时还包含发送方证书和认证码
+type Envelope struct {
+	Version       int                `json:"im_envelope"`
+	Content       string             `json:"content"`
+	DeliveryToken string             `json:"delivery_token,omitempty"`
+	Certificate   *SenderCertificate `json:"certificate,omitempty"`
+	MAC           []byte             `json:"mac,omitempty"`
+}
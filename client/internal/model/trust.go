@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// PinnedKey 本地固定的联系人公钥（首次使用即信任）
+type PinnedKey struct {
+	ContactID          int        `json:"contact_id"`
+	PublicKey          string     `json:"public_key"`
+	Fingerprint        string     `json:"fingerprint"`
+	FirstSeenAt        time.Time  `json:"first_seen_at"`
+	Verified           bool       `json:"verified"`
+	VerifiedAt         *time.Time `json:"verified_at,omitempty"`
+	PendingKey         string     `json:"pending_key,omitempty"`
+	PendingFingerprint string     `json:"pending_fingerprint,omitempty"`
+	KeyChangedAt       *time.Time `json:"key_changed_at,omitempty"`
+}
+
+// 公钥信任状态
+const (
+	KeyTrustNew      = "new"      // 首次见到，已固定
+	KeyTrustTrusted  = "trusted"  // 与已固定的公钥一致
+	KeyTrustVerified = "verified" // 用户已比对安全码
+	KeyTrustChanged  = "changed"  // 公钥已变更，等待用户确认
+)
+
+// KeyTrust 联系人公钥的信任信息
+type KeyTrust struct {
+	ContactID   int    `json:"contact_id"`
+	Status      string `json:"status"`
+	Fingerprint string `json:"fingerprint"`
+	Verified    bool   `json:"verified"`
+}
+
+// SafetyNumber 安全码信息
+type SafetyNumber struct {
+	ContactID          int    `json:"contact_id"`
+	SafetyNumber       string `json:"safety_number"`
+	LocalFingerprint   string `json:"local_fingerprint"`
+	ContactFingerprint string `json:"contact_fingerprint"`
+	Status             string `json:"status"`
+	Verified           bool   `json:"verified"`
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// jsonFile 基于 JSON 文件的简单持久化
+type jsonFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+func newJSONFile(dir, name string) *jsonFile {
+	return &jsonFile{path: filepath.Join(dir, name)}
+}
+
+// load 读取文件内容到 v，文件不存在时保持 v 不变
+func (f *jsonFile) load(v interface{}) error {
+	data, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// save 原子地写入文件（先写临时文件再重命名）
+func (f *jsonFile) save(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
@@ -0,0 +1,76 @@
+package repository
+
+import "im-system/client/internal/model"
+
+// KeyLogRepository 公钥透明日志本地状态（签名公钥、已见过的最新树头）
+type KeyLogRepository interface {
+	GetLogPublicKey() (string, error)
+	SaveLogPublicKey(publicKey string) error
+	GetTreeHead() (*model.SignedTreeHead, error)
+	SaveTreeHead(sth *model.SignedTreeHead) error
+}
+
+type keyLogRepository struct {
+	file *jsonFile
+}
+
+type keyLogData struct {
+	LogPublicKey string                `json:"log_public_key,omitempty"`
+	TreeHead     *model.SignedTreeHead `json:"tree_head,omitempty"`
+}
+
+// NewKeyLogRepository 创建公钥透明日志本地状态仓库实例
+func NewKeyLogRepository(dataDir string) KeyLogRepository {
+	return &keyLogRepository{file: newJSONFile(dataDir, "keylog.json")}
+}
+
+func (r *keyLogRepository) GetLogPublicKey() (string, error) {
+	data, err := r.load()
+	if err != nil {
+		return "", err
+	}
+	return data.LogPublicKey, nil
+}
+
+func (r *keyLogRepository) SaveLogPublicKey(publicKey string) error {
+	return r.update(func(data *keyLogData) {
+		data.LogPublicKey = publicKey
+	})
+}
+
+func (r *keyLogRepository) GetTreeHead() (*model.SignedTreeHead, error) {
+	data, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	return data.TreeHead, nil
+}
+
+func (r *keyLogRepository) SaveTreeHead(sth *model.SignedTreeHead) error {
+	return r.update(func(data *keyLogData) {
+		data.TreeHead = sth
+	})
+}
+
+func (r *keyLogRepository) load() (*keyLogData, error) {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+
+	data := &keyLogData{}
+	if err := r.file.load(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *keyLogRepository) update(fn func(data *keyLogData)) error {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+
+	data := &keyLogData{}
+	if err := r.file.load(data); err != nil {
+		return err
+	}
+	fn(data)
+	return r.file.save(data)
+}
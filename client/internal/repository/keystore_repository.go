@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"im-system/client/internal/model"
+)
+
+// KeyStoreRepository 本地加密密钥库数据访问接口
+type KeyStoreRepository interface {
+	Get(userID int) (*model.KeyStoreEntry, error)
+	Save(entry *model.KeyStoreEntry) error
+	Delete(userID int) error
+}
+
+type keyStoreRepository struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewKeyStoreRepository 创建密钥库仓库实例（每个用户一个文件）
+func NewKeyStoreRepository(dataDir string) KeyStoreRepository {
+	return &keyStoreRepository{dir: filepath.Join(dataDir, "keystore")}
+}
+
+func (r *keyStoreRepository) Get(userID int) (*model.KeyStoreEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entry *model.KeyStoreEntry
+	if err := r.file(userID).load(&entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (r *keyStoreRepository) Save(entry *model.KeyStoreEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file(entry.UserID).save(entry)
+}
+
+func (r *keyStoreRepository) Delete(userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := os.Remove(r.file(userID).path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *keyStoreRepository) file(userID int) *jsonFile {
+	return newJSONFile(r.dir, strconv.Itoa(userID)+".json")
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"errors"
+	"strconv"
+
+	"im-system/client/internal/model"
+)
+
+// MaxOutboxMessages 每个用户发件箱中等待服务端确认的消息上限
+const MaxOutboxMessages = 500
+
+// ErrOutboxFull 等待确认的消息过多（长时间无法连接服务端）
+var ErrOutboxFull = errors.New("too many messages waiting to be sent")
+
+// OutboxRepository 等待服务端确认的加密消息，按加入顺序保存，收到服务端确认后删除
+type OutboxRepository interface {
+	// Append 加入消息，同一客户端消息ID已存在时忽略；达到上限时返回 ErrOutboxFull
+	Append(userID int, msg *model.WSMessage) error
+	List(userID int) ([]model.WSMessage, error)
+	// Remove 删除指定客户端消息ID的消息，不存在时忽略
+	Remove(userID int, clientMessageID string) error
+}
+
+type outboxRepository struct {
+	file *jsonFile
+	// data 首次访问时从文件加载，之后只在修改时写回
+	data   outboxData
+	loaded bool
+	// index 按本地用户ID与客户端消息ID索引，确认不在发件箱中的消息时不必遍历
+	index map[string]map[string]struct{}
+}
+
+// outboxData 按本地用户ID索引的待确认消息
+type outboxData map[string][]model.WSMessage
+
+// NewOutboxRepository 创建本地发件箱仓库实例
+func NewOutboxRepository(dataDir string) OutboxRepository {
+	return &outboxRepository{file: newJSONFile(dataDir, "outbox.json")}
+}
+
+// ensureLoaded 加载文件并建立索引，调用方持有 file.mu
+func (r *outboxRepository) ensureLoaded() error {
+	if r.loaded {
+		return nil
+	}
+
+	data := outboxData{}
+	if err := r.file.load(&data); err != nil {
+		return err
+	}
+
+	r.data = data
+	r.index = make(map[string]map[string]struct{})
+	for key, pending := range data {
+		ids := make(map[string]struct{}, len(pending))
+		for _, msg := range pending {
+			ids[msg.ClientMessageID] = struct{}{}
+		}
+		r.index[key] = ids
+	}
+	r.loaded = true
+	return nil
+}
+
+func (r *outboxRepository) Append(userID int, msg *model.WSMessage) error {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+
+	if err := r.ensureLoaded(); err != nil {
+		return err
+	}
+
+	key := strconv.Itoa(userID)
+	ids := r.index[key]
+	if _, ok := ids[msg.ClientMessageID]; ok {
+		return nil
+	}
+	if len(r.data[key]) >= MaxOutboxMessages {
+		return ErrOutboxFull
+	}
+
+	r.data[key] = append(r.data[key], *msg)
+	if ids == nil {
+		ids = make(map[string]struct{})
+		r.index[key] = ids
+	}
+	ids[msg.ClientMessageID] = struct{}{}
+	return r.file.save(r.data)
+}
+
+func (r *outboxRepository) List(userID int) ([]model.WSMessage, error) {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+
+	if err := r.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	pending := r.data[strconv.Itoa(userID)]
+	return append([]model.WSMessage(nil), pending...), nil
+}
+
+func (r *outboxRepository) Remove(userID int, clientMessageID string) error {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+
+	if err := r.ensureLoaded(); err != nil {
+		return err
+	}
+
+	key := strconv.Itoa(userID)
+	if _, ok := r.index[key][clientMessageID]; !ok {
+		return nil
+	}
+	delete(r.index[key], clientMessageID)
+
+	pending := r.data[key]
+	for i, msg := range pending {
+		if msg.ClientMessageID == clientMessageID {
+			pending = append(pending[:i], pending[i+1:]...)
+			break
+		}
+	}
+	if len(pending) == 0 {
+		delete(r.data, key)
+		delete(r.index, key)
+	} else {
+		r.data[key] = pending
+	}
+	return r.file.save(r.data)
+}
@@ -0,0 +1,128 @@
+package repository
+
+import "strconv"
+
+// SealedSenderRepository 密封发送本地状态（证书签名公钥、投递令牌）
+type SealedSenderRepository interface {
+	GetServerPublicKey() (string, error)
+	SaveServerPublicKey(publicKey string) error
+	GetDeliveryToken(userID int) (string, error)
+	SaveDeliveryToken(userID int, deliveryToken string) error
+	GetContactToken(ownerID, contactID int) (string, error)
+	SaveContactToken(ownerID, contactID int, deliveryToken string) error
+	DeleteContactToken(ownerID, contactID int) error
+}
+
+type sealedSenderRepository struct {
+	file *jsonFile
+}
+
+// sealedUserData 本地用户自己的投递令牌，以及从联系人信封中获知的投递令牌
+type sealedUserData struct {
+	DeliveryToken string            `json:"delivery_token,omitempty"`
+	ContactTokens map[string]string `json:"contact_tokens,omitempty"`
+}
+
+type sealedSenderData struct {
+	ServerPublicKey string                     `json:"server_public_key,omitempty"`
+	Users           map[string]*sealedUserData `json:"users,omitempty"`
+}
+
+// NewSealedSenderRepository 创建密封发送本地状态仓库实例
+func NewSealedSenderRepository(dataDir string) SealedSenderRepository {
+	return &sealedSenderRepository{file: newJSONFile(dataDir, "sealed_sender.json")}
+}
+
+func (r *sealedSenderRepository) GetServerPublicKey() (string, error) {
+	data, err := r.load()
+	if err != nil {
+		return "", err
+	}
+	return data.ServerPublicKey, nil
+}
+
+func (r *sealedSenderRepository) SaveServerPublicKey(publicKey string) error {
+	return r.update(func(data *sealedSenderData) {
+		data.ServerPublicKey = publicKey
+	})
+}
+
+func (r *sealedSenderRepository) GetDeliveryToken(userID int) (string, error) {
+	data, err := r.load()
+	if err != nil {
+		return "", err
+	}
+	user := data.Users[strconv.Itoa(userID)]
+	if user == nil {
+		return "", nil
+	}
+	return user.DeliveryToken, nil
+}
+
+func (r *sealedSenderRepository) SaveDeliveryToken(userID int, deliveryToken string) error {
+	return r.update(func(data *sealedSenderData) {
+		data.user(userID).DeliveryToken = deliveryToken
+	})
+}
+
+func (r *sealedSenderRepository) GetContactToken(ownerID, contactID int) (string, error) {
+	data, err := r.load()
+	if err != nil {
+		return "", err
+	}
+	user := data.Users[strconv.Itoa(ownerID)]
+	if user == nil {
+		return "", nil
+	}
+	return user.ContactTokens[strconv.Itoa(contactID)], nil
+}
+
+func (r *sealedSenderRepository) SaveContactToken(ownerID, contactID int, deliveryToken string) error {
+	return r.update(func(data *sealedSenderData) {
+		user := data.user(ownerID)
+		if user.ContactTokens == nil {
+			user.ContactTokens = make(map[string]string)
+		}
+		user.ContactTokens[strconv.Itoa(contactID)] = deliveryToken
+	})
+}
+
+func (r *sealedSenderRepository) DeleteContactToken(ownerID, contactID int) error {
+	return r.update(func(data *sealedSenderData) {
+		delete(data.user(ownerID).ContactTokens, strconv.Itoa(contactID))
+	})
+}
+
+func (d *sealedSenderData) user(userID int) *sealedUserData {
+	if d.Users == nil {
+		d.Users = make(map[string]*sealedUserData)
+	}
+	key := strconv.Itoa(userID)
+	if d.Users[key] == nil {
+		d.Users[key] = &sealedUserData{}
+	}
+	return d.Users[key]
+}
+
+func (r *sealedSenderRepository) load() (*sealedSenderData, error) {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+
+	data := &sealedSenderData{}
+	if err := r.file.load(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *sealedSenderRepository) update(fn func(data *sealedSenderData)) error {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+
+	data := &sealedSenderData{}
+	if err := r.file.load(data); err != nil {
+		return err
+	}
+	fn(data)
+	return r.file.save(data)
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"strconv"
+
+	"im-system/client/internal/model"
+)
+
+// TrustRepository 联系人公钥固定数据访问接口
+type TrustRepository interface {
+	Get(ownerID, contactID int) (*model.PinnedKey, error)
+	Save(ownerID int, pin *model.PinnedKey) error
+}
+
+type trustRepository struct {
+	file *jsonFile
+}
+
+// trustData 按本地用户ID、联系人ID索引的固定公钥
+type trustData map[string]map[string]*model.PinnedKey
+
+// NewTrustRepository 创建公钥固定仓库实例
+func NewTrustRepository(dataDir string) TrustRepository {
+	return &trustRepository{file: newJSONFile(dataDir, "trust.json")}
+}
+
+func (r *trustRepository) Get(ownerID, contactID int) (*model.PinnedKey, error) {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+
+	data := trustData{}
+	if err := r.file.load(&data); err != nil {
+		return nil, err
+	}
+
+	pins := data[strconv.Itoa(ownerID)]
+	if pins == nil {
+		return nil, nil
+	}
+	return pins[strconv.Itoa(contactID)], nil
+}
+
+func (r *trustRepository) Save(ownerID int, pin *model.PinnedKey) error {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+
+	data := trustData{}
+	if err := r.file.load(&data); err != nil {
+		return err
+	}
+
+	owner := strconv.Itoa(ownerID)
+	if data[owner] == nil {
+		data[owner] = make(map[string]*model.PinnedKey)
+	}
+	data[owner][strconv.Itoa(pin.ContactID)] = pin
+
+	return r.file.save(data)
+}
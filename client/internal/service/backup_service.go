@@ -0,0 +1,153 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"im-system/client/internal/model"
+	"im-system/client/pkg/crypto"
+)
+
+// minRecoveryPassphraseLength 恢复口令最小长度（备份密文保存在服务端，需能抵御离线猜测）
+const minRecoveryPassphraseLength = 12
+
+var (
+	// ErrWeakRecoveryPassphrase 恢复口令过短
+	ErrWeakRecoveryPassphrase = errors.New("recovery passphrase must be at least 12 characters")
+	// ErrBackupMismatch 备份不属于当前用户
+	ErrBackupMismatch = errors.New("key backup does not belong to this user")
+	// ErrBackupKeyMismatch 备份中的私钥与已发布的公钥不匹配
+	ErrBackupKeyMismatch = errors.New("key backup does not match the published public key")
+)
+
+// BackupService 私钥备份服务接口
+// 使用恢复口令加密密钥包后上传到服务端，在新设备上下载并解密恢复到本地密钥库
+type BackupService interface {
+	Backup(token string, userID int, recoveryPassphrase string) error
+	Restore(token string, userID int, recoveryPassphrase, passphrase string) (*model.KeyStoreStatus, error)
+	Delete(token string) error
+}
+
+type backupService struct {
+	serverService       ServerService
+	transparencyService TransparencyService
+	keyStoreService     KeyStoreService
+}
+
+// NewBackupService 创建私钥备份服务实例
+func NewBackupService(serverService ServerService, transparencyService TransparencyService, keyStoreService KeyStoreService) BackupService {
+	return &backupService{
+		serverService:       serverService,
+		transparencyService: transparencyService,
+		keyStoreService:     keyStoreService,
+	}
+}
+
+// backupAAD 将备份密文绑定到用户ID
+func backupAAD(userID int) []byte {
+	return []byte("im-key-backup-v1:" + strconv.Itoa(userID))
+}
+
+// Backup 加密当前已解锁的私钥并上传，覆盖服务端已有的备份
+func (s *backupService) Backup(token string, userID int, recoveryPassphrase string) error {
+	if len(recoveryPassphrase) < minRecoveryPassphraseLength {
+		return ErrWeakRecoveryPassphrase
+	}
+
+	privateKey, err := s.keyStoreService.PrivateKey(userID)
+	if err != nil {
+		return err
+	}
+	publicKey, err := crypto.PublicKeyFromPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := json.Marshal(&model.KeyBundle{
+		Version:    1,
+		UserID:     userID,
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	sealed, err := crypto.SealWithPassphrase(recoveryPassphrase, bundle, backupAAD(userID))
+	if err != nil {
+		return err
+	}
+	blob, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+
+	return s.serverService.UploadKeyBackup(token, string(blob))
+}
+
+// Restore 下载备份并使用恢复口令解密，再以本地口令保存到密钥库
+func (s *backupService) Restore(token string, userID int, recoveryPassphrase, passphrase string) (*model.KeyStoreStatus, error) {
+	backup, err := s.serverService.GetKeyBackup(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var sealed crypto.SealedBox
+	if err := json.Unmarshal([]byte(backup.Backup), &sealed); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := crypto.OpenWithPassphrase(recoveryPassphrase, &sealed, backupAAD(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle model.KeyBundle
+	if err := json.Unmarshal(plaintext, &bundle); err != nil {
+		return nil, err
+	}
+	if bundle.UserID != userID {
+		return nil, ErrBackupMismatch
+	}
+	if err := s.checkPublishedKey(token, userID, bundle.PrivateKey); err != nil {
+		return nil, err
+	}
+
+	return s.keyStoreService.Store(userID, bundle.PrivateKey, passphrase)
+}
+
+// checkPublishedKey 校验私钥与服务端发布且已记录在透明日志中的公钥一致，防止服务端替换备份
+func (s *backupService) checkPublishedKey(token string, userID int, privateKey string) error {
+	publicKey, err := crypto.PublicKeyFromPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	restored, err := crypto.Fingerprint(publicKey)
+	if err != nil {
+		return err
+	}
+
+	published, err := s.serverService.GetPublicKey(token, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.transparencyService.VerifyKey(token, userID, published.PublicKey); err != nil {
+		return err
+	}
+	expected, err := crypto.Fingerprint(published.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if restored != expected {
+		return ErrBackupKeyMismatch
+	}
+	return nil
+}
+
+func (s *backupService) Delete(token string) error {
+	return s.serverService.DeleteKeyBackup(token)
+}
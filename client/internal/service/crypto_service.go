@@ -3,29 +3,62 @@ package service
 import (
 	"encoding/base64"
 
+	"im-system/client/internal/config"
+	"im-system/client/internal/model"
 	"im-system/client/pkg/crypto"
 )
 
 // CryptoService 加密服务接口
 type CryptoService interface {
 	GenerateKeyPair() (publicKey, privateKey string, err error)
-	Encrypt(publicKeyPEM string, plaintext string) (string, error)
+	// CipherSuites 返回本地支持且与该公钥曲线匹配的加密套件，用于上传公钥时公布
+	CipherSuites(publicKey string) []int
+	Encrypt(recipient *model.PublicKeyBundle, plaintext string) (string, error)
 	Decrypt(privateKeyPEM string, ciphertext string) (string, error)
 }
 
-type cryptoService struct{}
+type cryptoService struct {
+	suites []crypto.SuiteID
+}
 
 // NewCryptoService 创建加密服务实例
-func NewCryptoService() CryptoService {
-	return &cryptoService{}
+func NewCryptoService(cfg *config.Config) CryptoService {
+	suites := crypto.ParseSuiteIDs(cfg.CipherSuites)
+	if len(suites) == 0 {
+		suites = []crypto.SuiteID{crypto.SuiteP256AES256GCM}
+	}
+	return &cryptoService{suites: suites}
 }
 
 func (s *cryptoService) GenerateKeyPair() (string, string, error) {
-	return crypto.GenerateECCKeyPair()
+	// 新密钥使用首选套件的曲线
+	return crypto.GenerateKeyPair(s.suites[0])
+}
+
+func (s *cryptoService) CipherSuites(publicKey string) []int {
+	available, err := crypto.SuitesForKey(publicKey)
+	if err != nil {
+		return nil
+	}
+
+	var result []int
+	for _, id := range s.suites {
+		for _, candidate := range available {
+			if id == candidate {
+				result = append(result, int(id))
+			}
+		}
+	}
+	return result
 }
 
-func (s *cryptoService) Encrypt(publicKeyPEM string, plaintext string) (string, error) {
-	encrypted, err := crypto.EncryptWithPublicKey(publicKeyPEM, []byte(plaintext))
+func (s *cryptoService) Encrypt(recipient *model.PublicKeyBundle, plaintext string) (string, error) {
+	suite, header, err := crypto.SelectSuite(recipient.PublicKey, crypto.ParseSuiteIDs(recipient.CipherSuites), s.suites)
+	if err != nil {
+		return "", err
+	}
+
+	encrypted, err := crypto.Seal(suite, recipient.PublicKey, []byte(plaintext), header)
 	if err != nil {
 		return "", err
 	}
@@ -41,7 +74,8 @@ func (s *cryptoService) Decrypt(privateKeyPEM string, ciphertext string) (string
 		return "", err
 	}
 
-	decrypted, err := crypto.DecryptWithPrivateKey(privateKeyPEM, encrypted)
+	// 根据密文头部选择套件，兼容旧版不带头部的密文
+	decrypted, err := crypto.Open(privateKeyPEM, encrypted)
 	if err != nil {
 		return "", err
 	}
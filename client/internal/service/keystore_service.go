@@ -0,0 +1,195 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"im-system/client/internal/model"
+	"im-system/client/internal/repository"
+	"im-system/client/pkg/crypto"
+)
+
+var (
+	// ErrKeyStoreLocked 密钥库尚未解锁
+	ErrKeyStoreLocked = errors.New("keystore is locked")
+	// ErrKeyStoreNotFound 本地没有该用户的密钥库
+	ErrKeyStoreNotFound = errors.New("keystore not found")
+)
+
+// KeyStoreService 本地加密密钥库服务接口
+// 私钥以口令加密的形式保存在磁盘上，解锁后仅保存在内存中，浏览器不再持有私钥
+type KeyStoreService interface {
+	Provision(token string, userID int, passphrase string) (*model.KeyStoreStatus, error)
+	Store(userID int, privateKeyPEM, passphrase string) (*model.KeyStoreStatus, error)
+	Unlock(userID int, passphrase string) error
+	Lock(userID int)
+	// Delete 锁定并删除本地密钥库（账户删除后调用）
+	Delete(userID int) error
+	ChangePassphrase(userID int, oldPassphrase, newPassphrase string) error
+	PrivateKey(userID int) (string, error)
+	Status(userID int) (*model.KeyStoreStatus, error)
+}
+
+type keyStoreService struct {
+	repo          repository.KeyStoreRepository
+	serverService ServerService
+	cryptoService CryptoService
+
+	// 已解锁的私钥，按用户ID索引
+	unlocked   map[int]string
+	unlockedMu sync.RWMutex
+}
+
+// NewKeyStoreService 创建密钥库服务实例
+func NewKeyStoreService(repo repository.KeyStoreRepository, serverService ServerService, cryptoService CryptoService) KeyStoreService {
+	return &keyStoreService{
+		repo:          repo,
+		serverService: serverService,
+		cryptoService: cryptoService,
+		unlocked:      make(map[int]string),
+	}
+}
+
+// keyStoreAAD 将密文绑定到用户ID，防止不同用户的密钥库文件被互换
+func keyStoreAAD(userID int) []byte {
+	return []byte("im-keystore-v1:" + strconv.Itoa(userID))
+}
+
+// Provision 在本地生成新的密钥对，上传公钥并将私钥保存到密钥库
+func (s *keyStoreService) Provision(token string, userID int, passphrase string) (*model.KeyStoreStatus, error) {
+	publicKey, privateKey, err := s.cryptoService.GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.serverService.UploadPublicKey(token, publicKey, s.cryptoService.CipherSuites(publicKey)); err != nil {
+		return nil, err
+	}
+
+	return s.Store(userID, privateKey, passphrase)
+}
+
+// Store 使用口令加密私钥并保存，已存在的密钥库会被覆盖
+func (s *keyStoreService) Store(userID int, privateKeyPEM, passphrase string) (*model.KeyStoreStatus, error) {
+	publicKey, err := crypto.PublicKeyFromPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := crypto.SealWithPassphrase(passphrase, []byte(privateKeyPEM), keyStoreAAD(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := &model.KeyStoreEntry{
+		UserID:     userID,
+		PublicKey:  publicKey,
+		PrivateKey: sealed,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.repo.Save(entry); err != nil {
+		return nil, err
+	}
+
+	s.unlockedMu.Lock()
+	s.unlocked[userID] = privateKeyPEM
+	s.unlockedMu.Unlock()
+
+	return s.Status(userID)
+}
+
+func (s *keyStoreService) Unlock(userID int, passphrase string) error {
+	privateKey, err := s.open(userID, passphrase)
+	if err != nil {
+		return err
+	}
+
+	s.unlockedMu.Lock()
+	s.unlocked[userID] = privateKey
+	s.unlockedMu.Unlock()
+
+	return nil
+}
+
+func (s *keyStoreService) Lock(userID int) {
+	s.unlockedMu.Lock()
+	delete(s.unlocked, userID)
+	s.unlockedMu.Unlock()
+}
+
+func (s *keyStoreService) Delete(userID int) error {
+	s.Lock(userID)
+	return s.repo.Delete(userID)
+}
+
+func (s *keyStoreService) ChangePassphrase(userID int, oldPassphrase, newPassphrase string) error {
+	privateKey, err := s.open(userID, oldPassphrase)
+	if err != nil {
+		return err
+	}
+
+	entry, err := s.repo.Get(userID)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := crypto.SealWithPassphrase(newPassphrase, []byte(privateKey), keyStoreAAD(userID))
+	if err != nil {
+		return err
+	}
+	entry.PrivateKey = sealed
+	entry.UpdatedAt = time.Now()
+
+	return s.repo.Save(entry)
+}
+
+// PrivateKey 返回已解锁的私钥，未解锁时返回 ErrKeyStoreLocked
+func (s *keyStoreService) PrivateKey(userID int) (string, error) {
+	s.unlockedMu.RLock()
+	defer s.unlockedMu.RUnlock()
+
+	privateKey, ok := s.unlocked[userID]
+	if !ok {
+		return "", ErrKeyStoreLocked
+	}
+	return privateKey, nil
+}
+
+func (s *keyStoreService) Status(userID int) (*model.KeyStoreStatus, error) {
+	entry, err := s.repo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &model.KeyStoreStatus{UserID: userID}
+	if entry != nil {
+		status.Exists = true
+		status.PublicKey = entry.PublicKey
+	}
+
+	s.unlockedMu.RLock()
+	_, status.Unlocked = s.unlocked[userID]
+	s.unlockedMu.RUnlock()
+
+	return status, nil
+}
+
+func (s *keyStoreService) open(userID int, passphrase string) (string, error) {
+	entry, err := s.repo.Get(userID)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", ErrKeyStoreNotFound
+	}
+
+	privateKey, err := crypto.OpenWithPassphrase(passphrase, entry.PrivateKey, keyStoreAAD(userID))
+	if err != nil {
+		return "", err
+	}
+	return string(privateKey), nil
+}
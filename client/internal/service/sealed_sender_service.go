@@ -0,0 +1,326 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"im-system/client/internal/config"
+	"im-system/client/internal/model"
+	"im-system/client/internal/repository"
+	"im-system/client/pkg/crypto"
+)
+
+// certificateRefreshBefore 发送方证书在到期前多久重新获取
+const certificateRefreshBefore = time.Hour
+
+var (
+	// ErrInvalidSealedMessage 密封消息的证书或认证码校验失败
+	ErrInvalidSealedMessage = errors.New("invalid sealed sender message")
+	// ErrSealedSenderKeyMismatch 服务端证书签名公钥与固定的不一致
+	ErrSealedSenderKeyMismatch = errors.New("sealed sender public key does not match the pinned key")
+)
+
+// SealedSenderService 密封发送服务接口
+// 启用后，消息以信封形式加密：信封中携带本地用户的投递令牌，联系人据此向本地用户密封发送；
+// 已知接收方投递令牌时，发送方身份和证书只出现在信封内，服务端只知道接收方
+type SealedSenderService interface {
+	Encrypt(token string, senderID, receiverID int, receiver *model.PublicKeyBundle, content string) (string, error)
+	SendSealed(token string, senderID, receiverID int, receiver *model.PublicKeyBundle, content string) (int, bool, error)
+	Open(ownerID int, sealed bool, senderID int, ciphertext, sentAt string) (string, int, error)
+	// ResetDeliveryToken 服务端吊销投递令牌后丢弃本地令牌，下一条消息生成并分发新令牌
+	ResetDeliveryToken(userID int) error
+}
+
+type sealedSenderService struct {
+	repo            repository.SealedSenderRepository
+	serverService   ServerService
+	cryptoService   CryptoService
+	keyStoreService KeyStoreService
+	config          *config.Config
+
+	// 发送方证书缓存，按用户ID索引
+	certificates   map[int]*model.SenderCertificate
+	certificatesMu sync.Mutex
+}
+
+// NewSealedSenderService 创建密封发送服务实例
+func NewSealedSenderService(
+	repo repository.SealedSenderRepository,
+	serverService ServerService,
+	cryptoService CryptoService,
+	keyStoreService KeyStoreService,
+	cfg *config.Config,
+) SealedSenderService {
+	return &sealedSenderService{
+		repo:            repo,
+		serverService:   serverService,
+		cryptoService:   cryptoService,
+		keyStoreService: keyStoreService,
+		config:          cfg,
+		certificates:    make(map[int]*model.SenderCertificate),
+	}
+}
+
+// Encrypt 加密普通（非密封）消息，启用密封发送时附带本地用户的投递令牌
+func (s *sealedSenderService) Encrypt(token string, senderID, receiverID int, receiver *model.PublicKeyBundle, content string) (string, error) {
+	if !s.config.SealedSender {
+		return s.cryptoService.Encrypt(receiver, content)
+	}
+
+	deliveryToken, err := s.ensureDeliveryToken(token, senderID)
+	if err != nil {
+		return "", err
+	}
+
+	return s.seal(receiver, &model.Envelope{
+		Version:       1,
+		Content:       content,
+		DeliveryToken: deliveryToken,
+	})
+}
+
+// SendSealed 尝试密封发送，未启用、未获知接收方投递令牌或令牌已失效时返回 false，由调用方改为普通发送
+func (s *sealedSenderService) SendSealed(token string, senderID, receiverID int, receiver *model.PublicKeyBundle, content string) (int, bool, error) {
+	if !s.config.SealedSender {
+		return 0, false, nil
+	}
+
+	receiverToken, err := s.repo.GetContactToken(senderID, receiverID)
+	if err != nil || receiverToken == "" {
+		return 0, false, err
+	}
+
+	// 计算认证码需要本地私钥，密钥库未解锁时退回普通发送
+	privateKey, err := s.keyStoreService.PrivateKey(senderID)
+	if err != nil {
+		return 0, false, nil
+	}
+
+	deliveryToken, err := s.ensureDeliveryToken(token, senderID)
+	if err != nil {
+		return 0, false, err
+	}
+	certificate, err := s.certificate(token, senderID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	envelope := &model.Envelope{
+		Version:       1,
+		Content:       content,
+		DeliveryToken: deliveryToken,
+		Certificate:   certificate,
+	}
+	// 双方密钥曲线不同时无法计算认证码，退回普通发送
+	envelope.MAC, err = crypto.SenderMAC(privateKey, receiver.PublicKey, envelopeMACInput(receiverID, envelope))
+	if err != nil {
+		return 0, false, nil
+	}
+
+	ciphertext, err := s.seal(receiver, envelope)
+	if err != nil {
+		return 0, false, err
+	}
+
+	messageID, err := s.serverService.SendSealedMessage(receiverID, receiverToken, ciphertext)
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) && serverErr.StatusCode == http.StatusUnauthorized {
+		// 接收方已轮换或被吊销投递令牌，等待其下一条消息带来新令牌
+		return 0, false, s.repo.DeleteContactToken(senderID, receiverID)
+	}
+	if errors.As(err, &serverErr) && serverErr.StatusCode == http.StatusForbidden {
+		// 接收方只接受联系人的消息，由普通发送校验联系人关系
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return messageID, true, nil
+}
+
+// Open 解密收到的消息并拆开信封，记录发送方的投递令牌
+// 密封消息的发送方由信封内的证书确定，返回解密后的内容与发送方ID
+func (s *sealedSenderService) Open(ownerID int, sealed bool, senderID int, ciphertext, sentAt string) (string, int, error) {
+	privateKey, err := s.keyStoreService.PrivateKey(ownerID)
+	if err != nil {
+		return "", senderID, err
+	}
+
+	plaintext, err := s.cryptoService.Decrypt(privateKey, ciphertext)
+	if err != nil {
+		return "", senderID, err
+	}
+
+	envelope, ok := parseEnvelope(plaintext)
+	if !ok {
+		if sealed {
+			return "", 0, ErrInvalidSealedMessage
+		}
+		return plaintext, senderID, nil
+	}
+
+	if sealed {
+		senderID, err = s.verifySender(ownerID, privateKey, envelope, sentAt)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	if envelope.DeliveryToken != "" && senderID != 0 {
+		if err := s.repo.SaveContactToken(ownerID, senderID, envelope.DeliveryToken); err != nil {
+			return "", senderID, err
+		}
+	}
+
+	return envelope.Content, senderID, nil
+}
+
+func (s *sealedSenderService) ResetDeliveryToken(userID int) error {
+	return s.repo.SaveDeliveryToken(userID, "")
+}
+
+// verifySender 校验信封内的发送方证书（服务端签名、有效期）与认证码，返回发送方ID
+func (s *sealedSenderService) verifySender(ownerID int, privateKey string, envelope *model.Envelope, sentAt string) (int, error) {
+	if envelope.Certificate == nil {
+		return 0, ErrInvalidSealedMessage
+	}
+
+	serverKey, err := s.serverPublicKey()
+	if err != nil {
+		return 0, err
+	}
+	if !ed25519.Verify(serverKey, envelope.Certificate.Certificate, envelope.Certificate.Signature) {
+		return 0, ErrInvalidSealedMessage
+	}
+
+	var data model.SenderCertificateData
+	if err := json.Unmarshal(envelope.Certificate.Certificate, &data); err != nil {
+		return 0, ErrInvalidSealedMessage
+	}
+
+	// 离线消息按服务端接收时间判断证书是否过期
+	sent := time.Now()
+	if t, err := time.Parse(time.RFC3339, sentAt); err == nil {
+		sent = t
+	}
+	if sent.UnixMilli() > data.Expires {
+		return 0, ErrInvalidSealedMessage
+	}
+
+	expected, err := crypto.SenderMAC(privateKey, data.PublicKey, envelopeMACInput(ownerID, envelope))
+	if err != nil || !hmac.Equal(expected, envelope.MAC) {
+		return 0, ErrInvalidSealedMessage
+	}
+
+	return data.SenderID, nil
+}
+
+// ensureDeliveryToken 返回本地用户的投递令牌，首次使用时生成并上传到服务端
+func (s *sealedSenderService) ensureDeliveryToken(token string, userID int) (string, error) {
+	deliveryToken, err := s.repo.GetDeliveryToken(userID)
+	if err != nil || deliveryToken != "" {
+		return deliveryToken, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	deliveryToken = base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := s.serverService.SetDeliveryToken(token, deliveryToken); err != nil {
+		return "", err
+	}
+	if err := s.repo.SaveDeliveryToken(userID, deliveryToken); err != nil {
+		return "", err
+	}
+	return deliveryToken, nil
+}
+
+// certificate 返回缓存的发送方证书，即将过期时重新获取
+func (s *sealedSenderService) certificate(token string, userID int) (*model.SenderCertificate, error) {
+	s.certificatesMu.Lock()
+	defer s.certificatesMu.Unlock()
+
+	if cached, ok := s.certificates[userID]; ok {
+		var data model.SenderCertificateData
+		if err := json.Unmarshal(cached.Certificate, &data); err == nil &&
+			time.Now().Add(certificateRefreshBefore).UnixMilli() < data.Expires {
+			return cached, nil
+		}
+	}
+
+	certificate, err := s.serverService.GetSenderCertificate(token)
+	if err != nil {
+		return nil, err
+	}
+	s.certificates[userID] = certificate
+	return certificate, nil
+}
+
+// serverPublicKey 获取证书签名公钥，首次使用即固定
+func (s *sealedSenderService) serverPublicKey() (ed25519.PublicKey, error) {
+	pinned, err := s.repo.GetServerPublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyPEM, err := s.serverService.GetSealedSenderPublicKey()
+	if err != nil {
+		if pinned == "" {
+			return nil, err
+		}
+		publicKeyPEM = pinned
+	}
+
+	if pinned == "" {
+		if err := s.repo.SaveServerPublicKey(publicKeyPEM); err != nil {
+			return nil, err
+		}
+	} else if pinned != publicKeyPEM {
+		return nil, ErrSealedSenderKeyMismatch
+	}
+
+	return crypto.ParseSigningPublicKey(publicKeyPEM)
+}
+
+func (s *sealedSenderService) seal(receiver *model.PublicKeyBundle, envelope *model.Envelope) (string, error) {
+	plaintext, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	return s.cryptoService.Encrypt(receiver, string(plaintext))
+}
+
+// envelopeMACInput 认证码覆盖接收方ID、证书、内容与投递令牌
+func envelopeMACInput(receiverID int, envelope *model.Envelope) []byte {
+	input, _ := json.Marshal([]interface{}{
+		receiverID,
+		envelope.Certificate,
+		envelope.Content,
+		envelope.DeliveryToken,
+	})
+	return input
+}
+
+// parseEnvelope 解析信封，不是信封格式的明文按普通消息处理
+func parseEnvelope(plaintext string) (*model.Envelope, bool) {
+	if !strings.HasPrefix(plaintext, `{"im_envelope":`) {
+		return nil, false
+	}
+
+	var envelope model.Envelope
+	if err := json.Unmarshal([]byte(plaintext), &envelope); err != nil || envelope.Version != 1 {
+		return nil, false
+	}
+	return &envelope, true
+}
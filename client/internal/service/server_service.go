@@ -6,21 +6,76 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"im-system/client/internal/config"
 	"im-system/client/internal/model"
 )
 
+// ServerError 服务端返回的非 200 响应
+type ServerError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error: %s", e.Body)
+}
+
 // ServerService 服务端通信服务接口
 type ServerService interface {
-	Register(username, password string) (*model.AuthResponse, error)
-	Login(username, password string) (*model.AuthResponse, error)
-	GetAllUsers(token string) ([]model.User, error)
+	Register(username, password string, device *model.DeviceInfo) (*model.AuthResponse, error)
+	Login(username, password string, device *model.DeviceInfo) (*model.AuthResponse, error)
+	RefreshToken(refreshToken string, device *model.DeviceInfo) (*model.TokenPair, error)
+	Logout(token string) error
+	VerifyTwoFactor(challengeToken, code string, device *model.DeviceInfo) (*model.AuthResponse, error)
+	GetTwoFactorStatus(token string) (*model.TwoFactorStatus, error)
+	SetupTwoFactor(token string) (*model.TwoFactorSetup, error)
+	ActivateTwoFactor(token, code string) ([]string, error)
+	DisableTwoFactor(token, code string) error
+	RegenerateRecoveryCodes(token, code string) ([]string, error)
+	ListSessions(token string) ([]model.Session, error)
+	RevokeSession(token, sessionID string) error
+	RevokeOtherSessions(token string) (int, error)
+	ChangePassword(token, currentPassword, newPassword string) error
+	DeleteAccount(token, password string, deleteSentMessages bool) error
+	// ExportAccount 返回服务端生成的 JSON 数据归档
+	ExportAccount(token string) ([]byte, error)
+	GetContacts(token string) ([]model.User, error)
+	RemoveContact(token string, contactID int) error
+	GetContactRequests(token string) (*model.ContactRequests, error)
+	// SendContactRequest 按用户ID或用户名发送好友请求
+	SendContactRequest(token string, userID int, username string) (*model.ContactRequestResult, error)
+	AcceptContactRequest(token string, requestID int) error
+	DeclineContactRequest(token string, requestID int) error
+	GetBlockedUsers(token string) ([]model.User, error)
+	BlockUser(token string, userID int) error
+	UnblockUser(token string, userID int) error
+	GetPrivacy(token string) (*model.PrivacySettings, error)
+	UpdatePrivacy(token string, update *model.PrivacyUpdate) (*model.PrivacySettings, error)
+	SearchUsers(token, query, cursor string, limit int) (*model.UserSearchPage, error)
 	GetOnlineUsers(token string) ([]int, error)
-	GetPublicKey(token string, userID int) (string, error)
+	GetMyProfile(token string) (*model.User, error)
+	UpdateMyProfile(token string, update *model.ProfileUpdate) (*model.User, error)
+	GetUserProfile(token string, userID int) (*model.User, error)
+	GetPublicKey(token string, userID int) (*model.PublicKeyBundle, error)
 	GenerateKeys(token string) (*model.KeyPair, error)
-	SendMessage(token string, receiverID int, encryptedContent string) (int, error)
+	UploadPublicKey(token string, publicKey string, cipherSuites []int) error
+	// SendMessage 发送加密消息，clientMessageID 可选，重试时服务端返回已有消息
+	SendMessage(token string, receiverID int, encryptedContent, clientMessageID string) (int, error)
 	GetUnreadMessages(token string) ([]model.Message, error)
+	GetKeyLogPublicKey(token string) (string, error)
+	GetSignedTreeHead(token string) (*model.SignedTreeHead, error)
+	GetInclusionProof(token string, userID int, treeSize int64) (*model.InclusionProof, error)
+	GetConsistencyProof(token string, first, second int64) (*model.ConsistencyProof, error)
+	UploadKeyBackup(token string, backup string) error
+	GetKeyBackup(token string) (*model.KeyBackup, error)
+	DeleteKeyBackup(token string) error
+	SetDeliveryToken(token string, deliveryToken string) error
+	GetSenderCertificate(token string) (*model.SenderCertificate, error)
+	GetSealedSenderPublicKey() (string, error)
+	SendSealedMessage(receiverID int, deliveryToken, encryptedContent string) (int, error)
 	GetServerWSURL() string
 }
 
@@ -37,13 +92,15 @@ func NewServerService(cfg *config.Config) ServerService {
 	}
 }
 
-func (s *serverService) Register(username, password string) (*model.AuthResponse, error) {
+func (s *serverService) Register(username, password string, device *model.DeviceInfo) (*model.AuthResponse, error) {
 	reqBody := model.AuthRequest{
-		Username: username,
-		Password: password,
+		Username:   username,
+		Password:   password,
+		DeviceName: device.Name,
+		DeviceIP:   device.IPAddress,
 	}
 
-	resp, err := s.post("/api/auth/register", "", reqBody)
+	resp, err := s.sendWithHeader("POST", "/api/auth/register", "", reqBody, deviceHeader(device))
 	if err != nil {
 		return nil, err
 	}
@@ -56,13 +113,15 @@ func (s *serverService) Register(username, password string) (*model.AuthResponse
 	return &authResp, nil
 }
 
-func (s *serverService) Login(username, password string) (*model.AuthResponse, error) {
+func (s *serverService) Login(username, password string, device *model.DeviceInfo) (*model.AuthResponse, error) {
 	reqBody := model.AuthRequest{
-		Username: username,
-		Password: password,
+		Username:   username,
+		Password:   password,
+		DeviceName: device.Name,
+		DeviceIP:   device.IPAddress,
 	}
 
-	resp, err := s.post("/api/auth/login", "", reqBody)
+	resp, err := s.sendWithHeader("POST", "/api/auth/login", "", reqBody, deviceHeader(device))
 	if err != nil {
 		return nil, err
 	}
@@ -75,8 +134,289 @@ func (s *serverService) Login(username, password string) (*model.AuthResponse, e
 	return &authResp, nil
 }
 
-func (s *serverService) GetAllUsers(token string) ([]model.User, error) {
-	resp, err := s.get("/api/users", token)
+func (s *serverService) RefreshToken(refreshToken string, device *model.DeviceInfo) (*model.TokenPair, error) {
+	reqBody := map[string]interface{}{
+		"refresh_token": refreshToken,
+		"device_ip":     device.IPAddress,
+	}
+
+	resp, err := s.sendWithHeader("POST", "/api/auth/refresh", "", reqBody, deviceHeader(device))
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens model.TokenPair
+	if err := json.Unmarshal(resp, &tokens); err != nil {
+		return nil, err
+	}
+
+	return &tokens, nil
+}
+
+func (s *serverService) Logout(token string) error {
+	_, err := s.post("/api/auth/logout", token, nil)
+	return err
+}
+
+func (s *serverService) VerifyTwoFactor(challengeToken, code string, device *model.DeviceInfo) (*model.AuthResponse, error) {
+	reqBody := map[string]interface{}{
+		"challenge_token": challengeToken,
+		"code":            code,
+		"device_name":     device.Name,
+		"device_ip":       device.IPAddress,
+	}
+
+	resp, err := s.sendWithHeader("POST", "/api/auth/2fa/verify", "", reqBody, deviceHeader(device))
+	if err != nil {
+		return nil, err
+	}
+
+	var authResp model.AuthResponse
+	if err := json.Unmarshal(resp, &authResp); err != nil {
+		return nil, err
+	}
+
+	return &authResp, nil
+}
+
+func (s *serverService) GetTwoFactorStatus(token string) (*model.TwoFactorStatus, error) {
+	resp, err := s.get("/api/2fa", token)
+	if err != nil {
+		return nil, err
+	}
+
+	var status model.TwoFactorStatus
+	if err := json.Unmarshal(resp, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+func (s *serverService) SetupTwoFactor(token string) (*model.TwoFactorSetup, error) {
+	resp, err := s.post("/api/2fa/setup", token, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var setup model.TwoFactorSetup
+	if err := json.Unmarshal(resp, &setup); err != nil {
+		return nil, err
+	}
+
+	return &setup, nil
+}
+
+func (s *serverService) ActivateTwoFactor(token, code string) ([]string, error) {
+	return s.recoveryCodes("/api/2fa/activate", token, code)
+}
+
+func (s *serverService) DisableTwoFactor(token, code string) error {
+	_, err := s.post("/api/2fa/disable", token, map[string]interface{}{"code": code})
+	return err
+}
+
+func (s *serverService) RegenerateRecoveryCodes(token, code string) ([]string, error) {
+	return s.recoveryCodes("/api/2fa/recovery-codes", token, code)
+}
+
+// recoveryCodes 提交验证码并返回服务端生成的恢复码
+func (s *serverService) recoveryCodes(path, token, code string) ([]string, error) {
+	resp, err := s.post(path, token, map[string]interface{}{"code": code})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, err
+	}
+
+	return result.RecoveryCodes, nil
+}
+
+func (s *serverService) ListSessions(token string) ([]model.Session, error) {
+	resp, err := s.get("/api/sessions", token)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Sessions []model.Session `json:"sessions"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, err
+	}
+
+	return result.Sessions, nil
+}
+
+func (s *serverService) RevokeSession(token, sessionID string) error {
+	_, err := s.send("DELETE", "/api/sessions/"+url.PathEscape(sessionID), token, nil)
+	return err
+}
+
+func (s *serverService) RevokeOtherSessions(token string) (int, error) {
+	resp, err := s.send("DELETE", "/api/sessions", token, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Revoked int `json:"revoked"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return 0, err
+	}
+
+	return result.Revoked, nil
+}
+
+func (s *serverService) ChangePassword(token, currentPassword, newPassword string) error {
+	reqBody := map[string]interface{}{
+		"current_password": currentPassword,
+		"new_password":     newPassword,
+	}
+	_, err := s.send("PUT", "/api/account/password", token, reqBody)
+	return err
+}
+
+func (s *serverService) DeleteAccount(token, password string, deleteSentMessages bool) error {
+	reqBody := map[string]interface{}{
+		"password":             password,
+		"delete_sent_messages": deleteSentMessages,
+	}
+	_, err := s.send("DELETE", "/api/account", token, reqBody)
+	return err
+}
+
+func (s *serverService) ExportAccount(token string) ([]byte, error) {
+	return s.get("/api/account/export", token)
+}
+
+// deviceHeader 将浏览器的 User-Agent 转发给服务端，用于记录登录设备；IP 通过请求体的 device_ip 字段转发
+func deviceHeader(device *model.DeviceInfo) http.Header {
+	header := http.Header{}
+	if device.UserAgent != "" {
+		header.Set("User-Agent", device.UserAgent)
+	}
+	return header
+}
+
+func (s *serverService) GetContacts(token string) ([]model.User, error) {
+	return s.users(s.get("/api/contacts", token))
+}
+
+func (s *serverService) RemoveContact(token string, contactID int) error {
+	_, err := s.send("DELETE", fmt.Sprintf("/api/contacts/%d", contactID), token, nil)
+	return err
+}
+
+func (s *serverService) GetContactRequests(token string) (*model.ContactRequests, error) {
+	resp, err := s.get("/api/contacts/requests", token)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests model.ContactRequests
+	if err := json.Unmarshal(resp, &requests); err != nil {
+		return nil, err
+	}
+
+	return &requests, nil
+}
+
+func (s *serverService) SendContactRequest(token string, userID int, username string) (*model.ContactRequestResult, error) {
+	reqBody := map[string]interface{}{
+		"user_id":  userID,
+		"username": username,
+	}
+	resp, err := s.post("/api/contacts/requests", token, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var result model.ContactRequestResult
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (s *serverService) AcceptContactRequest(token string, requestID int) error {
+	_, err := s.post(fmt.Sprintf("/api/contacts/requests/%d/accept", requestID), token, nil)
+	return err
+}
+
+func (s *serverService) DeclineContactRequest(token string, requestID int) error {
+	_, err := s.post(fmt.Sprintf("/api/contacts/requests/%d/decline", requestID), token, nil)
+	return err
+}
+
+func (s *serverService) GetBlockedUsers(token string) ([]model.User, error) {
+	return s.users(s.get("/api/blocks", token))
+}
+
+func (s *serverService) BlockUser(token string, userID int) error {
+	_, err := s.send("PUT", fmt.Sprintf("/api/blocks/%d", userID), token, nil)
+	return err
+}
+
+func (s *serverService) UnblockUser(token string, userID int) error {
+	_, err := s.send("DELETE", fmt.Sprintf("/api/blocks/%d", userID), token, nil)
+	return err
+}
+
+func (s *serverService) GetPrivacy(token string) (*model.PrivacySettings, error) {
+	return s.privacy(s.get("/api/users/me/privacy", token))
+}
+
+func (s *serverService) UpdatePrivacy(token string, update *model.PrivacyUpdate) (*model.PrivacySettings, error) {
+	return s.privacy(s.send("PUT", "/api/users/me/privacy", token, update))
+}
+
+func (s *serverService) SearchUsers(token, query, cursor string, limit int) (*model.UserSearchPage, error) {
+	params := url.Values{}
+	params.Set("q", query)
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	resp, err := s.get("/api/users/search?"+params.Encode(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	var page model.UserSearchPage
+	if err := json.Unmarshal(resp, &page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// privacy 解析服务端返回的隐私设置
+func (s *serverService) privacy(resp []byte, err error) (*model.PrivacySettings, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	var privacy model.PrivacySettings
+	if err := json.Unmarshal(resp, &privacy); err != nil {
+		return nil, err
+	}
+
+	return &privacy, nil
+}
+
+// users 解析服务端返回的用户列表
+func (s *serverService) users(resp []byte, err error) ([]model.User, error) {
 	if err != nil {
 		return nil, err
 	}
@@ -107,20 +447,44 @@ func (s *serverService) GetOnlineUsers(token string) ([]int, error) {
 	return result.OnlineUsers, nil
 }
 
-func (s *serverService) GetPublicKey(token string, userID int) (string, error) {
-	resp, err := s.get(fmt.Sprintf("/api/keys/%d", userID), token)
+func (s *serverService) GetMyProfile(token string) (*model.User, error) {
+	return s.profile(s.get("/api/users/me", token))
+}
+
+func (s *serverService) UpdateMyProfile(token string, update *model.ProfileUpdate) (*model.User, error) {
+	return s.profile(s.send("PATCH", "/api/users/me", token, update))
+}
+
+func (s *serverService) GetUserProfile(token string, userID int) (*model.User, error) {
+	return s.profile(s.get(fmt.Sprintf("/api/users/%d", userID), token))
+}
+
+// profile 解析服务端返回的用户资料
+func (s *serverService) profile(resp []byte, err error) (*model.User, error) {
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var result struct {
-		PublicKey string `json:"public_key"`
+	var user model.User
+	if err := json.Unmarshal(resp, &user); err != nil {
+		return nil, err
 	}
+
+	return &user, nil
+}
+
+func (s *serverService) GetPublicKey(token string, userID int) (*model.PublicKeyBundle, error) {
+	resp, err := s.get(fmt.Sprintf("/api/keys/%d", userID), token)
+	if err != nil {
+		return nil, err
+	}
+
+	var result model.PublicKeyBundle
 	if err := json.Unmarshal(resp, &result); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return result.PublicKey, nil
+	return &result, nil
 }
 
 func (s *serverService) GenerateKeys(token string) (*model.KeyPair, error) {
@@ -137,11 +501,24 @@ func (s *serverService) GenerateKeys(token string) (*model.KeyPair, error) {
 	return &keyPair, nil
 }
 
-func (s *serverService) SendMessage(token string, receiverID int, encryptedContent string) (int, error) {
+func (s *serverService) UploadPublicKey(token string, publicKey string, cipherSuites []int) error {
+	reqBody := map[string]interface{}{
+		"public_key":    publicKey,
+		"cipher_suites": cipherSuites,
+	}
+
+	_, err := s.post("/api/keys/upload", token, reqBody)
+	return err
+}
+
+func (s *serverService) SendMessage(token string, receiverID int, encryptedContent, clientMessageID string) (int, error) {
 	reqBody := map[string]interface{}{
 		"receiver_id": receiverID,
 		"content":     encryptedContent,
 	}
+	if clientMessageID != "" {
+		reqBody["client_message_id"] = clientMessageID
+	}
 
 	resp, err := s.post("/api/messages/send", token, reqBody)
 	if err != nil {
@@ -174,6 +551,148 @@ func (s *serverService) GetUnreadMessages(token string) ([]model.Message, error)
 	return result.Messages, nil
 }
 
+func (s *serverService) GetKeyLogPublicKey(token string) (string, error) {
+	resp, err := s.get("/api/keylog/public-key", token)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		PublicKey string `json:"public_key"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return "", err
+	}
+
+	return result.PublicKey, nil
+}
+
+func (s *serverService) GetSignedTreeHead(token string) (*model.SignedTreeHead, error) {
+	resp, err := s.get("/api/keylog/sth", token)
+	if err != nil {
+		return nil, err
+	}
+
+	var sth model.SignedTreeHead
+	if err := json.Unmarshal(resp, &sth); err != nil {
+		return nil, err
+	}
+
+	return &sth, nil
+}
+
+func (s *serverService) GetInclusionProof(token string, userID int, treeSize int64) (*model.InclusionProof, error) {
+	resp, err := s.get(fmt.Sprintf("/api/keylog/inclusion/%d?tree_size=%d", userID, treeSize), token)
+	if err != nil {
+		return nil, err
+	}
+
+	var proof model.InclusionProof
+	if err := json.Unmarshal(resp, &proof); err != nil {
+		return nil, err
+	}
+
+	return &proof, nil
+}
+
+func (s *serverService) GetConsistencyProof(token string, first, second int64) (*model.ConsistencyProof, error) {
+	resp, err := s.get(fmt.Sprintf("/api/keylog/consistency?first=%d&second=%d", first, second), token)
+	if err != nil {
+		return nil, err
+	}
+
+	var proof model.ConsistencyProof
+	if err := json.Unmarshal(resp, &proof); err != nil {
+		return nil, err
+	}
+
+	return &proof, nil
+}
+
+func (s *serverService) UploadKeyBackup(token string, backup string) error {
+	_, err := s.send("PUT", "/api/keys/backup", token, map[string]string{
+		"backup": backup,
+	})
+	return err
+}
+
+func (s *serverService) GetKeyBackup(token string) (*model.KeyBackup, error) {
+	body, err := s.get("/api/keys/backup", token)
+	if err != nil {
+		return nil, err
+	}
+
+	var backup model.KeyBackup
+	if err := json.Unmarshal(body, &backup); err != nil {
+		return nil, err
+	}
+
+	return &backup, nil
+}
+
+func (s *serverService) DeleteKeyBackup(token string) error {
+	_, err := s.send("DELETE", "/api/keys/backup", token, nil)
+	return err
+}
+
+func (s *serverService) SetDeliveryToken(token string, deliveryToken string) error {
+	_, err := s.send("PUT", "/api/sealed/delivery-token", token, map[string]string{
+		"delivery_token": deliveryToken,
+	})
+	return err
+}
+
+func (s *serverService) GetSenderCertificate(token string) (*model.SenderCertificate, error) {
+	body, err := s.get("/api/sealed/certificate", token)
+	if err != nil {
+		return nil, err
+	}
+
+	var certificate model.SenderCertificate
+	if err := json.Unmarshal(body, &certificate); err != nil {
+		return nil, err
+	}
+
+	return &certificate, nil
+}
+
+func (s *serverService) GetSealedSenderPublicKey() (string, error) {
+	body, err := s.get("/api/sealed/public-key", "")
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		PublicKey string `json:"public_key"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+
+	return result.PublicKey, nil
+}
+
+// SendSealedMessage 凭接收方投递令牌发送密封消息，不携带 JWT
+func (s *serverService) SendSealedMessage(receiverID int, deliveryToken, encryptedContent string) (int, error) {
+	body, err := s.post("/api/sealed/messages", "", map[string]interface{}{
+		"receiver_id":    receiverID,
+		"delivery_token": deliveryToken,
+		"content":        encryptedContent,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		MessageID int `json:"message_id"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, err
+	}
+
+	return result.MessageID, nil
+}
+
 func (s *serverService) GetServerWSURL() string {
 	return s.config.GetServerWSURL() + "/api/ws"
 }
@@ -202,13 +721,22 @@ func (s *serverService) get(path, token string) ([]byte, error) {
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server error: %s", string(body))
+		return nil, &ServerError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	return body, nil
 }
 
 func (s *serverService) post(path, token string, data interface{}) ([]byte, error) {
+	return s.send("POST", path, token, data)
+}
+
+func (s *serverService) send(method, path, token string, data interface{}) ([]byte, error) {
+	return s.sendWithHeader(method, path, token, data, nil)
+}
+
+// sendWithHeader 发送请求并附加额外的请求头
+func (s *serverService) sendWithHeader(method, path, token string, data interface{}, header http.Header) ([]byte, error) {
 	url := s.config.GetServerURL() + path
 
 	var reqBody []byte
@@ -220,11 +748,14 @@ func (s *serverService) post(path, token string, data interface{}) ([]byte, erro
 		}
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, err
 	}
 
+	for key, values := range header {
+		req.Header[key] = values
+	}
 	req.Header.Set("Content-Type", "application/json")
 	if token != "" {
 		req.Header.Set("Authorization", "Bearer "+token)
@@ -242,7 +773,7 @@ func (s *serverService) post(path, token string, data interface{}) ([]byte, erro
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server error: %s", string(body))
+		return nil, &ServerError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	return body, nil
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken 令牌格式错误或被服务端拒绝
+var ErrInvalidToken = errors.New("invalid token")
+
+// identityCacheTTL 服务端校验结果的缓存时间，缓存不超过令牌本身的有效期
+const identityCacheTTL = time.Minute
+
+// IdentityService 校验访问令牌并得到本地用户ID，读取或修改本地密钥库等状态前必须经过校验
+type IdentityService interface {
+	// UserID 通过服务端（GET /api/users/me）校验令牌签名与会话后返回用户ID，结果短暂缓存
+	UserID(token string) (int, error)
+}
+
+type identityEntry struct {
+	userID  int
+	expires time.Time
+}
+
+type identityService struct {
+	serverService ServerService
+	cache         map[[sha256.Size]byte]identityEntry
+	mu            sync.Mutex
+}
+
+// NewIdentityService 创建令牌校验服务实例
+func NewIdentityService(serverService ServerService) IdentityService {
+	return &identityService{
+		serverService: serverService,
+		cache:         make(map[[sha256.Size]byte]identityEntry),
+	}
+}
+
+func (s *identityService) UserID(token string) (int, error) {
+	// 格式错误的令牌不必请求服务端
+	expiresAt, err := tokenExpiry(token)
+	if err != nil {
+		return 0, err
+	}
+
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.userID, nil
+	}
+
+	user, err := s.serverService.GetMyProfile(token)
+	if err != nil {
+		var serverErr *ServerError
+		if errors.As(err, &serverErr) && serverErr.StatusCode == 401 {
+			return 0, ErrInvalidToken
+		}
+		return 0, err
+	}
+
+	// 签名已由服务端校验，载荷中的过期时间可信
+	expires := now.Add(identityCacheTTL)
+	if !expiresAt.IsZero() && expiresAt.Before(expires) {
+		expires = expiresAt
+	}
+
+	s.mu.Lock()
+	for k, e := range s.cache {
+		if !now.Before(e.expires) {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = identityEntry{userID: user.ID, expires: expires}
+	s.mu.Unlock()
+	return user.ID, nil
+}
+
+// tokenExpiry 读取 JWT 载荷中的过期时间，只解析不校验签名
+func tokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, ErrInvalidToken
+	}
+
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, ErrInvalidToken
+	}
+	if claims.ExpiresAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(claims.ExpiresAt, 0), nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sync"
+
+	"im-system/client/internal/config"
+	"im-system/client/internal/model"
+	"im-system/client/internal/repository"
+	"im-system/client/pkg/crypto"
+	"im-system/shared/merkle"
+)
+
+// ErrKeyTransparency 公钥透明日志校验失败
+var ErrKeyTransparency = errors.New("key transparency verification failed")
+
+// TransparencyService 公钥透明日志校验服务接口
+type TransparencyService interface {
+	VerifyKey(token string, userID int, publicKey string) error
+}
+
+type transparencyService struct {
+	repo          repository.KeyLogRepository
+	serverService ServerService
+	config        *config.Config
+	mu            sync.Mutex
+}
+
+// NewTransparencyService 创建公钥透明日志校验服务实例
+func NewTransparencyService(repo repository.KeyLogRepository, serverService ServerService, cfg *config.Config) TransparencyService {
+	return &transparencyService{
+		repo:          repo,
+		serverService: serverService,
+		config:        cfg,
+	}
+}
+
+// keyLogLeafData 构造日志叶子数据（与服务端 KeyLogLeafData 保持一致）
+func keyLogLeafData(userID int, publicKey string) []byte {
+	return []byte(fmt.Sprintf("%d\n%s", userID, publicKey))
+}
+
+// VerifyKey 校验服务端返回的公钥确实是日志中该用户的最新公钥
+func (s *transparencyService) VerifyKey(token string, userID int, publicKey string) error {
+	sth, err := s.verifiedTreeHead(token)
+	if err != nil {
+		return err
+	}
+
+	proof, err := s.serverService.GetInclusionProof(token, userID, sth.TreeSize)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrKeyTransparency, err)
+	}
+	if proof.UserID != userID || proof.PublicKey != publicKey {
+		return fmt.Errorf("%w: served key is not the latest logged key", ErrKeyTransparency)
+	}
+
+	leafHash := merkle.LeafHash(keyLogLeafData(userID, publicKey))
+	if !merkle.VerifyInclusion(proof.LeafIndex, sth.TreeSize, leafHash, proof.AuditPath, sth.RootHash) {
+		return fmt.Errorf("%w: invalid inclusion proof", ErrKeyTransparency)
+	}
+
+	return nil
+}
+
+// verifiedTreeHead 获取最新树头，校验签名以及与之前见过的树头之间的一致性
+func (s *transparencyService) verifiedTreeHead(token string) (*model.SignedTreeHead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logKey, err := s.logPublicKey(token)
+	if err != nil {
+		return nil, err
+	}
+
+	sth, err := s.serverService.GetSignedTreeHead(token)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(logKey, merkle.TreeHeadSignatureInput(sth.TreeSize, sth.Timestamp, sth.RootHash), sth.Signature) {
+		return nil, fmt.Errorf("%w: invalid tree head signature", ErrKeyTransparency)
+	}
+
+	last, err := s.repo.GetTreeHead()
+	if err != nil {
+		return nil, err
+	}
+
+	if last != nil {
+		switch {
+		case sth.TreeSize < last.TreeSize:
+			return nil, fmt.Errorf("%w: tree head rolled back", ErrKeyTransparency)
+		case sth.TreeSize == last.TreeSize:
+			if !bytes.Equal(sth.RootHash, last.RootHash) {
+				return nil, fmt.Errorf("%w: conflicting tree heads", ErrKeyTransparency)
+			}
+		case last.TreeSize > 0:
+			proof, err := s.serverService.GetConsistencyProof(token, last.TreeSize, sth.TreeSize)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrKeyTransparency, err)
+			}
+			if !merkle.VerifyConsistency(last.TreeSize, sth.TreeSize, proof.Proof, last.RootHash, sth.RootHash) {
+				return nil, fmt.Errorf("%w: inconsistent tree heads", ErrKeyTransparency)
+			}
+		}
+	}
+
+	if last == nil || sth.TreeSize > last.TreeSize {
+		if err := s.repo.SaveTreeHead(sth); err != nil {
+			return nil, err
+		}
+	}
+
+	return sth, nil
+}
+
+// logPublicKey 优先使用配置的日志签名公钥，否则首次使用时从服务端获取并固定
+func (s *transparencyService) logPublicKey(token string) (ed25519.PublicKey, error) {
+	if s.config.KeyLogPublicKey != "" {
+		return crypto.ParseSigningPublicKey(s.config.KeyLogPublicKey)
+	}
+
+	pinned, err := s.repo.GetLogPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if pinned == "" {
+		pinned, err = s.serverService.GetKeyLogPublicKey(token)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.repo.SaveLogPublicKey(pinned); err != nil {
+			return nil, err
+		}
+	}
+
+	return crypto.ParseSigningPublicKey(pinned)
+}
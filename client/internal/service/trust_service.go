@@ -0,0 +1,320 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"im-system/client/internal/config"
+	"im-system/client/internal/model"
+	"im-system/client/internal/repository"
+	"im-system/client/pkg/crypto"
+)
+
+var (
+	// ErrKeyChanged 联系人公钥已变更且尚未确认
+	ErrKeyChanged = errors.New("contact public key has changed, re-verify before sending")
+	// ErrSafetyNumberMismatch 用户提交的安全码与当前公钥不一致
+	ErrSafetyNumberMismatch = errors.New("safety number does not match")
+	// ErrOwnKeyMismatch 服务端返回的本人公钥与本地密钥库中的公钥不一致
+	ErrOwnKeyMismatch = errors.New("server copy of own public key does not match local keystore")
+)
+
+// TrustService 联系人公钥信任服务接口（首次使用即信任 + 安全码校验）
+type TrustService interface {
+	// ownerID 为已通过 IdentityService 校验的本地用户ID
+	ResolveContactKey(token string, ownerID, contactID int) (*model.PublicKeyBundle, *model.KeyTrust, error)
+	GetSafetyNumber(token string, ownerID, contactID int) (*model.SafetyNumber, error)
+	Verify(token string, ownerID, contactID int, safetyNumber string) (*model.KeyTrust, error)
+	Acknowledge(token string, ownerID, contactID int) (*model.KeyTrust, error)
+}
+
+type trustService struct {
+	repo                repository.TrustRepository
+	serverService       ServerService
+	transparencyService TransparencyService
+	keyStoreService     KeyStoreService
+	config              *config.Config
+	// resolved 本进程中最近通过透明日志校验的联系人公钥，服务端不可达时用于加密待发送的消息
+	resolved   map[string]*model.PublicKeyBundle
+	resolvedMu sync.Mutex
+}
+
+// NewTrustService 创建公钥信任服务实例
+func NewTrustService(
+	repo repository.TrustRepository,
+	serverService ServerService,
+	transparencyService TransparencyService,
+	keyStoreService KeyStoreService,
+	cfg *config.Config,
+) TrustService {
+	return &trustService{
+		repo:                repo,
+		serverService:       serverService,
+		transparencyService: transparencyService,
+		keyStoreService:     keyStoreService,
+		config:              cfg,
+		resolved:            make(map[string]*model.PublicKeyBundle),
+	}
+}
+
+// ResolveContactKey 获取联系人公钥并与本地固定的公钥比对
+// 公钥变更且策略为 block 时返回 ErrKeyChanged
+func (s *trustService) ResolveContactKey(token string, ownerID, contactID int) (*model.PublicKeyBundle, *model.KeyTrust, error) {
+	key := strconv.Itoa(ownerID) + ":" + strconv.Itoa(contactID)
+	bundle, err := s.fetchKey(token, contactID)
+	if err != nil {
+		// 服务端不可达（如重启中）时使用已校验过的公钥，消息加密后进入本地发件箱；仍与固定的公钥比对
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			return nil, nil, err
+		}
+		s.resolvedMu.Lock()
+		cached := s.resolved[key]
+		s.resolvedMu.Unlock()
+		if cached == nil {
+			return nil, nil, err
+		}
+		bundle = cached
+	} else {
+		s.resolvedMu.Lock()
+		s.resolved[key] = bundle
+		s.resolvedMu.Unlock()
+	}
+
+	trust, err := s.checkKey(ownerID, contactID, bundle.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if trust.Status == model.KeyTrustChanged && s.config.KeyChangePolicy != "warn" {
+		return bundle, trust, ErrKeyChanged
+	}
+
+	return bundle, trust, nil
+}
+
+func (s *trustService) GetSafetyNumber(token string, ownerID, contactID int) (*model.SafetyNumber, error) {
+	number, _, err := s.safetyNumber(token, ownerID, contactID)
+	return number, err
+}
+
+// Verify 用户比对安全码后确认联系人当前公钥
+// 服务端返回的本人公钥与本地不一致时返回 ErrOwnKeyMismatch（服务端可能向所有人替换了本人公钥）
+func (s *trustService) Verify(token string, ownerID, contactID int, safetyNumber string) (*model.KeyTrust, error) {
+	current, contactKey, err := s.safetyNumber(token, ownerID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	published, err := s.fetchKey(token, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	publishedFingerprint, err := crypto.Fingerprint(published.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if publishedFingerprint != current.LocalFingerprint {
+		return nil, ErrOwnKeyMismatch
+	}
+	if normalizeDigits(safetyNumber) != normalizeDigits(current.SafetyNumber) {
+		return nil, ErrSafetyNumberMismatch
+	}
+
+	now := time.Now()
+	pin := &model.PinnedKey{
+		ContactID:   contactID,
+		PublicKey:   contactKey,
+		Fingerprint: current.ContactFingerprint,
+		FirstSeenAt: now,
+		Verified:    true,
+		VerifiedAt:  &now,
+	}
+	if existing, err := s.repo.Get(ownerID, contactID); err == nil && existing != nil {
+		pin.FirstSeenAt = existing.FirstSeenAt
+	}
+
+	if err := s.repo.Save(ownerID, pin); err != nil {
+		return nil, err
+	}
+
+	return trustFromPin(pin, model.KeyTrustVerified), nil
+}
+
+// Acknowledge 用户确认接受联系人的新公钥（未比对安全码）
+func (s *trustService) Acknowledge(token string, ownerID, contactID int) (*model.KeyTrust, error) {
+	pin, err := s.repo.Get(ownerID, contactID)
+	if err != nil {
+		return nil, err
+	}
+	if pin == nil {
+		_, trust, err := s.ResolveContactKey(token, ownerID, contactID)
+		return trust, err
+	}
+	if pin.PendingKey == "" {
+		return trustFromPin(pin, pinStatus(pin)), nil
+	}
+
+	pin.PublicKey = pin.PendingKey
+	pin.Fingerprint = pin.PendingFingerprint
+	pin.Verified = false
+	pin.VerifiedAt = nil
+	pin.PendingKey = ""
+	pin.PendingFingerprint = ""
+	pin.KeyChangedAt = nil
+
+	if err := s.repo.Save(ownerID, pin); err != nil {
+		return nil, err
+	}
+
+	return trustFromPin(pin, model.KeyTrustTrusted), nil
+}
+
+// safetyNumber 基于本地密钥库中的本人公钥与服务端返回的联系人公钥计算安全码
+// 本人公钥不取自服务端，否则服务端向双方返回同一个伪造的公钥时安全码仍会一致
+func (s *trustService) safetyNumber(token string, ownerID, contactID int) (*model.SafetyNumber, string, error) {
+	privateKey, err := s.keyStoreService.PrivateKey(ownerID)
+	if err != nil {
+		return nil, "", err
+	}
+	localKey, err := crypto.PublicKeyFromPrivateKey(privateKey)
+	if err != nil {
+		return nil, "", err
+	}
+	contact, err := s.fetchKey(token, contactID)
+	if err != nil {
+		return nil, "", err
+	}
+	contactKey := contact.PublicKey
+
+	trust, err := s.checkKey(ownerID, contactID, contactKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	number, err := crypto.SafetyNumber(ownerID, localKey, contactID, contactKey)
+	if err != nil {
+		return nil, "", err
+	}
+	localFingerprint, err := crypto.Fingerprint(localKey)
+	if err != nil {
+		return nil, "", err
+	}
+	contactFingerprint, err := crypto.Fingerprint(contactKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &model.SafetyNumber{
+		ContactID:          contactID,
+		SafetyNumber:       number,
+		LocalFingerprint:   localFingerprint,
+		ContactFingerprint: contactFingerprint,
+		Status:             trust.Status,
+		Verified:           trust.Verified,
+	}, contactKey, nil
+}
+
+// fetchKey 从服务端获取公钥，并校验其已记录在公钥透明日志中
+// 加密套件列表不记录在日志中，只用于协商，密文安全性仍由公钥保证
+func (s *trustService) fetchKey(token string, userID int) (*model.PublicKeyBundle, error) {
+	bundle, err := s.serverService.GetPublicKey(token, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.transparencyService.VerifyKey(token, userID, bundle.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+// checkKey 首次见到的公钥直接固定，之后与固定的公钥比对
+func (s *trustService) checkKey(ownerID, contactID int, publicKey string) (*model.KeyTrust, error) {
+	fingerprint, err := crypto.Fingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pin, err := s.repo.Get(ownerID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	if pin == nil {
+		pin = &model.PinnedKey{
+			ContactID:   contactID,
+			PublicKey:   publicKey,
+			Fingerprint: fingerprint,
+			FirstSeenAt: time.Now(),
+		}
+		if err := s.repo.Save(ownerID, pin); err != nil {
+			return nil, err
+		}
+		return trustFromPin(pin, model.KeyTrustNew), nil
+	}
+
+	// 旧版本按 PEM 原始字节计算指纹，同一公钥换用标准编码后需重新计算
+	if pinned, err := crypto.Fingerprint(pin.PublicKey); err == nil && pinned != pin.Fingerprint {
+		pin.Fingerprint = pinned
+		if err := s.repo.Save(ownerID, pin); err != nil {
+			return nil, err
+		}
+	}
+
+	if pin.Fingerprint == fingerprint {
+		// 服务端已恢复为固定的公钥，丢弃待确认的变更
+		if pin.PendingKey != "" {
+			pin.PendingKey = ""
+			pin.PendingFingerprint = ""
+			pin.KeyChangedAt = nil
+			if err := s.repo.Save(ownerID, pin); err != nil {
+				return nil, err
+			}
+		}
+		return trustFromPin(pin, pinStatus(pin)), nil
+	}
+
+	// 公钥与固定的不一致，记录待确认的新公钥
+	if pin.PendingFingerprint != fingerprint {
+		now := time.Now()
+		pin.PendingKey = publicKey
+		pin.PendingFingerprint = fingerprint
+		pin.KeyChangedAt = &now
+		if err := s.repo.Save(ownerID, pin); err != nil {
+			return nil, err
+		}
+	}
+
+	return &model.KeyTrust{
+		ContactID:   contactID,
+		Status:      model.KeyTrustChanged,
+		Fingerprint: fingerprint,
+		Verified:    false,
+	}, nil
+}
+
+func pinStatus(pin *model.PinnedKey) string {
+	if pin.Verified {
+		return model.KeyTrustVerified
+	}
+	return model.KeyTrustTrusted
+}
+
+func trustFromPin(pin *model.PinnedKey, status string) *model.KeyTrust {
+	return &model.KeyTrust{
+		ContactID:   pin.ContactID,
+		Status:      status,
+		Fingerprint: pin.Fingerprint,
+		Verified:    pin.Verified,
+	}
+}
+
+func normalizeDigits(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
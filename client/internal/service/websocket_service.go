@@ -1,39 +1,83 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"log"
+	"math/rand"
 	"net/http"
 	"sync"
+	"time"
 
 	"im-system/client/internal/model"
+	"im-system/client/internal/repository"
+	"im-system/client/internal/wire"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 // WebSocketService WebSocket服务
 type WebSocketService struct {
-	serverService ServerService
-	cryptoService CryptoService
-	clients       map[*websocket.Conn]*ClientInfo
-	clientsMutex  sync.RWMutex
-	upgrader      websocket.Upgrader
+	serverService       ServerService
+	identityService     IdentityService
+	trustService        TrustService
+	sealedSenderService SealedSenderService
+	outboxRepo          repository.OutboxRepository
+	clients             map[*websocket.Conn]*ClientInfo
+	clientsMutex        sync.RWMutex
+	upgrader            websocket.Upgrader
+	// draining 关闭中不再接受新连接，conns 跟踪尚未清理的连接
+	draining bool
+	conns    sync.WaitGroup
+}
+
+// closeWriteWait 关闭时写出关闭帧的超时
+const closeWriteWait = time.Second
+
+// shutdownCloseReason 关闭时发给浏览器的原因，浏览器收到 1001 going away 后重新连接
+const shutdownCloseReason = "client backend is shutting down, please reconnect"
+
+// 重连服务端的退避时间：从 reconnectBaseDelay 开始每次翻倍，最长 reconnectMaxDelay
+const (
+	reconnectBaseDelay = 500 * time.Millisecond
+	reconnectMaxDelay  = 30 * time.Second
+)
+
+// serverDialer 连接服务端时优先协商 Protobuf 编码（密文以原始字节传输），旧服务端不支持时使用 JSON
+var serverDialer = &websocket.Dialer{
+	Proxy:            http.ProxyFromEnvironment,
+	HandshakeTimeout: 45 * time.Second,
+	Subprotocols:     wire.Subprotocols,
 }
 
 // ClientInfo 客户端信息
 type ClientInfo struct {
-	Token      string
-	PrivateKey string
+	Token  string
+	UserID int
+	// ServerConn 当前到服务端的连接，断开重连期间为 nil，由 serverMu 保护
 	ServerConn *websocket.Conn
+	serverMu   sync.Mutex
+	// done 浏览器连接关闭后关闭，重连协程随之退出
+	done chan struct{}
 }
 
 // NewWebSocketService 创建WebSocket服务实例
-func NewWebSocketService(serverService ServerService, cryptoService CryptoService) *WebSocketService {
+func NewWebSocketService(
+	serverService ServerService,
+	identityService IdentityService,
+	trustService TrustService,
+	sealedSenderService SealedSenderService,
+	outboxRepo repository.OutboxRepository,
+) *WebSocketService {
 	return &WebSocketService{
-		serverService: serverService,
-		cryptoService: cryptoService,
-		clients:       make(map[*websocket.Conn]*ClientInfo),
+		serverService:       serverService,
+		identityService:     identityService,
+		trustService:        trustService,
+		sealedSenderService: sealedSenderService,
+		outboxRepo:          outboxRepo,
+		clients:             make(map[*websocket.Conn]*ClientInfo),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true
@@ -44,7 +88,7 @@ func NewWebSocketService(serverService ServerService, cryptoService CryptoServic
 
 // HandleWebSocket 处理WebSocket连接
 func (s *WebSocketService) HandleWebSocket(c *gin.Context) {
-	// 从查询参数或header获取token和privateKey
+	// 从查询参数或header获取token（私钥由本地密钥库提供，不再由浏览器传入）
 	token := c.Query("token")
 	if token == "" {
 		token = c.GetHeader("Authorization")
@@ -53,54 +97,190 @@ func (s *WebSocketService) HandleWebSocket(c *gin.Context) {
 		}
 	}
 
-	privateKey := c.Query("privateKey")
-	if privateKey == "" {
-		privateKey = c.GetHeader("X-Private-Key")
-	}
-
 	if token == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
 		return
 	}
 
-	// 升级到WebSocket
-	clientConn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
+	userID, err := s.identityService.UserID(token)
+	if err == ErrInvalidToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify token with server"})
+		return
+	}
+
+	if s.isDraining() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Client backend is shutting down"})
 		return
 	}
 
-	// 连接到服务端WebSocket
-	serverWSURL := s.serverService.GetServerWSURL() + "?token=" + token
-	serverConn, _, err := websocket.DefaultDialer.Dial(serverWSURL, nil)
+	// 升级到WebSocket
+	clientConn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("Failed to connect to server WebSocket: %v", err)
-		clientConn.Close()
+		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 
-	// 保存客户端信息
+	// 保存客户端信息，到服务端的连接由 maintainServerConn 建立并在断开后重连
 	clientInfo := &ClientInfo{
-		Token:      token,
-		PrivateKey: privateKey,
-		ServerConn: serverConn,
+		Token:  token,
+		UserID: userID,
+		done:   make(chan struct{}),
 	}
 
 	s.clientsMutex.Lock()
+	if s.draining {
+		s.clientsMutex.Unlock()
+		closeConn(clientConn, websocket.CloseGoingAway, shutdownCloseReason)
+		return
+	}
 	s.clients[clientConn] = clientInfo
+	s.conns.Add(1)
 	s.clientsMutex.Unlock()
 
 	log.Printf("WebSocket connection established")
 
 	// 启动消息转发
-	go s.forwardFromClient(clientConn, serverConn, clientInfo)
-	go s.forwardFromServer(serverConn, clientConn, clientInfo)
+	go s.forwardFromClient(clientConn, clientInfo)
+	go s.maintainServerConn(clientConn, clientInfo)
+}
+
+// maintainServerConn 保持到服务端的连接：断开后按指数退避加随机抖动重连，浏览器连接保持不变；
+// 连接建立后先按顺序发送本地发件箱中的消息。浏览器连接关闭或本进程关闭时退出
+func (s *WebSocketService) maintainServerConn(clientConn *websocket.Conn, info *ClientInfo) {
+	// 跨重连去重，重连后服务端可能重新推送未确认的事件
+	recent := newRecentEvents(recentEventsSize)
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-info.done:
+				return
+			case <-time.After(reconnectDelay(attempt)):
+			}
+		}
+		if s.isDraining() {
+			return
+		}
+
+		serverWSURL := s.serverService.GetServerWSURL() + "?token=" + info.Token
+		serverConn, resp, err := serverDialer.Dial(serverWSURL, nil)
+		if err != nil {
+			// 令牌被拒绝（如已过期）时重试没有意义，关闭浏览器连接，由浏览器使用新令牌重新连接
+			if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+				closeConn(clientConn, websocket.ClosePolicyViolation, "token rejected by server, please reconnect")
+				return
+			}
+			log.Printf("Failed to connect to server WebSocket (attempt %d): %v", attempt+1, err)
+			continue
+		}
+
+		if !s.attachServerConn(info, serverConn) {
+			serverConn.Close()
+			continue
+		}
+		log.Printf("Connected to server WebSocket")
+		attempt = 0
+
+		s.forwardFromServer(serverConn, clientConn, info, recent)
+		s.detachServerConn(info, serverConn)
+	}
+}
+
+// attachServerConn 按顺序发送本地发件箱中的消息后启用新连接；发件箱中的消息收到服务端确认后才删除，
+// 重复发送由服务端按客户端消息ID去重
+func (s *WebSocketService) attachServerConn(info *ClientInfo, serverConn *websocket.Conn) bool {
+	info.serverMu.Lock()
+	defer info.serverMu.Unlock()
+
+	select {
+	case <-info.done:
+		return false
+	default:
+	}
+
+	pending, err := s.outboxRepo.List(info.UserID)
+	if err != nil {
+		log.Printf("Failed to load outbox: %v", err)
+	}
+	codec := wire.ForSubprotocol(serverConn.Subprotocol())
+	for i := range pending {
+		if err := wire.WriteMessage(serverConn, codec, &pending[i]); err != nil {
+			log.Printf("Failed to flush outbox: %v", err)
+			return false
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("Flushed %d queued messages to server", len(pending))
+	}
+
+	info.ServerConn = serverConn
+	return true
+}
+
+// detachServerConn 连接断开后停用，之后发送的消息进入本地发件箱
+func (s *WebSocketService) detachServerConn(info *ClientInfo, serverConn *websocket.Conn) {
+	info.serverMu.Lock()
+	if info.ServerConn == serverConn {
+		info.ServerConn = nil
+	}
+	info.serverMu.Unlock()
+	serverConn.Close()
+}
+
+// sendToServer 聊天消息先加入本地发件箱再发送，收到服务端确认后删除；
+// 写出后、确认前连接断开的消息在重连后重新发送，由服务端按客户端消息ID去重
+func (s *WebSocketService) sendToServer(info *ClientInfo, msg *model.WSMessage) error {
+	info.serverMu.Lock()
+	defer info.serverMu.Unlock()
+
+	if msg.Type == "message" {
+		// 没有客户端消息ID无法对应确认，生成一个随确认返回
+		if msg.ClientMessageID == "" {
+			msg.ClientMessageID = uuid.New().String()
+		}
+		if err := s.outboxRepo.Append(info.UserID, msg); err != nil {
+			return err
+		}
+	}
+
+	// 未连接时等待重连后发送；其他消息（如 ping）断开期间没有意义，直接丢弃
+	if info.ServerConn == nil {
+		return nil
+	}
+	if err := wire.WriteMessage(info.ServerConn, wire.ForSubprotocol(info.ServerConn.Subprotocol()), msg); err != nil {
+		log.Printf("Failed to forward to server: %v", err)
+		// 关闭连接使 forwardFromServer 退出并重连
+		info.ServerConn.Close()
+		info.ServerConn = nil
+	}
+	return nil
+}
+
+// reconnectDelay 第 attempt 次重连前的等待时间：指数退避，在其一半到全部之间随机取值，避免大量连接同时重连
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectMaxDelay
+	if attempt < 16 {
+		if d := reconnectBaseDelay << (attempt - 1); d < delay {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (s *WebSocketService) isDraining() bool {
+	s.clientsMutex.RLock()
+	defer s.clientsMutex.RUnlock()
+	return s.draining
 }
 
 // forwardFromClient 从客户端转发消息到服务端
-func (s *WebSocketService) forwardFromClient(clientConn, serverConn *websocket.Conn, info *ClientInfo) {
+func (s *WebSocketService) forwardFromClient(clientConn *websocket.Conn, info *ClientInfo) {
 	defer func() {
-		s.cleanup(clientConn, serverConn)
+		s.cleanup(clientConn, info)
 	}()
 
 	for {
@@ -115,24 +295,70 @@ func (s *WebSocketService) forwardFromClient(clientConn, serverConn *websocket.C
 
 		// 如果是消息类型，需要加密
 		if msg.Type == "message" && msg.Content != "" {
-			// 获取接收者公钥
-			publicKey, err := s.serverService.GetPublicKey(info.Token, msg.ReceiverID)
+			// 获取接收者公钥并校验是否与固定的公钥一致
+			publicKey, trust, err := s.trustService.ResolveContactKey(info.Token, info.UserID, msg.ReceiverID)
+			if err == ErrKeyChanged {
+				clientConn.WriteJSON(model.WSMessage{
+					Type:            "key_changed",
+					ReceiverID:      msg.ReceiverID,
+					Content:         err.Error(),
+					ClientMessageID: msg.ClientMessageID,
+				})
+				continue
+			}
+			if errors.Is(err, ErrKeyTransparency) {
+				log.Printf("Receiver's public key failed transparency check: %v", err)
+				clientConn.WriteJSON(model.WSMessage{
+					Type:            "key_unverifiable",
+					ReceiverID:      msg.ReceiverID,
+					Content:         err.Error(),
+					ClientMessageID: msg.ClientMessageID,
+				})
+				continue
+			}
 			if err != nil {
 				log.Printf("Failed to get public key: %v", err)
 				clientConn.WriteJSON(model.WSMessage{
-					Type:    "error",
-					Content: "Failed to get receiver's public key",
+					Type:            "error",
+					Content:         "Failed to get receiver's public key",
+					ClientMessageID: msg.ClientMessageID,
+				})
+				continue
+			}
+
+			if trust.Status == model.KeyTrustChanged {
+				clientConn.WriteJSON(model.WSMessage{
+					Type:            "key_warning",
+					ReceiverID:      msg.ReceiverID,
+					Content:         "Receiver's public key has changed",
+					ClientMessageID: msg.ClientMessageID,
+				})
+			}
+
+			// 已知接收方投递令牌时密封发送，服务端不经过本连接获知发送方
+			messageID, sealed, err := s.sealedSenderService.SendSealed(info.Token, info.UserID, msg.ReceiverID, publicKey, msg.Content)
+			if err != nil {
+				log.Printf("Failed to send sealed message: %v", err)
+			}
+			if sealed {
+				clientConn.WriteJSON(model.WSMessage{
+					Type:            "message_sent",
+					Content:         "Message sent successfully",
+					MessageID:       messageID,
+					Sealed:          true,
+					ClientMessageID: msg.ClientMessageID,
 				})
 				continue
 			}
 
 			// 加密消息
-			encrypted, err := s.cryptoService.Encrypt(publicKey, msg.Content)
+			encrypted, err := s.sealedSenderService.Encrypt(info.Token, info.UserID, msg.ReceiverID, publicKey, msg.Content)
 			if err != nil {
 				log.Printf("Failed to encrypt message: %v", err)
 				clientConn.WriteJSON(model.WSMessage{
-					Type:    "error",
-					Content: "Failed to encrypt message",
+					Type:            "error",
+					Content:         "Failed to encrypt message",
+					ClientMessageID: msg.ClientMessageID,
 				})
 				continue
 			}
@@ -140,20 +366,25 @@ func (s *WebSocketService) forwardFromClient(clientConn, serverConn *websocket.C
 			msg.Content = encrypted
 		}
 
-		// 转发到服务端
-		if err := serverConn.WriteJSON(msg); err != nil {
-			log.Printf("Failed to forward to server: %v", err)
-			return
+		// 经本地发件箱转发到服务端，断开期间等待重连
+		if err := s.sendToServer(info, &msg); err != nil {
+			log.Printf("Failed to queue message: %v", err)
+			content := "Failed to queue message, message was not sent"
+			if err == repository.ErrOutboxFull {
+				content = "Too many messages waiting for the server, message was not sent"
+			}
+			clientConn.WriteJSON(model.WSMessage{
+				Type:            "error",
+				Content:         content,
+				ClientMessageID: msg.ClientMessageID,
+			})
 		}
 	}
 }
 
-// forwardFromServer 从服务端转发消息到客户端
-func (s *WebSocketService) forwardFromServer(serverConn, clientConn *websocket.Conn, info *ClientInfo) {
-	defer func() {
-		s.cleanup(clientConn, serverConn)
-	}()
-
+// forwardFromServer 从服务端转发消息到客户端，服务端连接断开时返回（由 maintainServerConn 重连）
+func (s *WebSocketService) forwardFromServer(serverConn, clientConn *websocket.Conn, info *ClientInfo, recent *recentEvents) {
+	codec := wire.ForSubprotocol(serverConn.Subprotocol())
 	for {
 		_, message, err := serverConn.ReadMessage()
 		if err != nil {
@@ -164,37 +395,145 @@ func (s *WebSocketService) forwardFromServer(serverConn, clientConn *websocket.C
 		}
 
 		var msg model.WSMessage
-		if err := json.Unmarshal(message, &msg); err != nil {
+		if err := codec.Unmarshal(message, &msg); err != nil {
 			log.Printf("Failed to unmarshal message: %v", err)
 			continue
 		}
 
-		// 如果是消息类型且有私钥，需要解密
-		if msg.Type == "message" && msg.Content != "" && info.PrivateKey != "" {
-			decrypted, err := s.cryptoService.Decrypt(info.PrivateKey, msg.Content)
+		// 服务端推送失败重试时同一事件可能重复到达
+		if msg.EventID != "" && recent.seen(msg.EventID) {
+			continue
+		}
+
+		if msg.Type == "delivery_token_revoked" {
+			if err := s.sealedSenderService.ResetDeliveryToken(info.UserID); err != nil {
+				log.Printf("Failed to reset delivery token: %v", err)
+			}
+			continue
+		}
+
+		// 服务端确认或拒绝后从本地发件箱删除
+		if (msg.Type == "message_sent" || msg.Type == "error") && msg.ClientMessageID != "" {
+			if err := s.outboxRepo.Remove(info.UserID, msg.ClientMessageID); err != nil {
+				log.Printf("Failed to remove message from outbox: %v", err)
+			}
+		}
+
+		// 如果是消息类型且密钥库已解锁，需要解密；密封消息的发送方从信封中得到
+		if (msg.Type == "message" || msg.Type == "sealed_message") && msg.Content != "" {
+			sealed := msg.Type == "sealed_message"
+			content, senderID, err := s.sealedSenderService.Open(info.UserID, sealed, msg.SenderID, msg.Content, msg.Timestamp)
 			if err != nil {
 				log.Printf("Failed to decrypt message: %v", err)
 				// 即使解密失败，也转发原始消息
 			} else {
-				msg.Content = decrypted
+				msg.Content = content
+				msg.SenderID = senderID
 			}
+			msg.Type = "message"
+			msg.Sealed = sealed
 		}
 
-		// 转发到客户端
+		// 转发到客户端，失败时关闭浏览器连接，由 forwardFromClient 清理
 		if err := clientConn.WriteJSON(msg); err != nil {
 			log.Printf("Failed to forward to client: %v", err)
+			clientConn.Close()
 			return
 		}
 	}
 }
 
-// cleanup 清理连接
-func (s *WebSocketService) cleanup(clientConn, serverConn *websocket.Conn) {
+// cleanup 浏览器连接关闭后清理，并停止重连
+func (s *WebSocketService) cleanup(clientConn *websocket.Conn, info *ClientInfo) {
 	s.clientsMutex.Lock()
 	delete(s.clients, clientConn)
 	s.clientsMutex.Unlock()
 
+	close(info.done)
+	info.serverMu.Lock()
+	if info.ServerConn != nil {
+		info.ServerConn.Close()
+		info.ServerConn = nil
+	}
+	info.serverMu.Unlock()
+
 	clientConn.Close()
-	serverConn.Close()
+	s.conns.Done()
 	log.Printf("WebSocket connection closed")
 }
+
+// Shutdown 停止接受新连接，向浏览器发送 going away 关闭帧并关闭到服务端的连接，
+// 等待所有连接清理完毕或 ctx 结束
+func (s *WebSocketService) Shutdown(ctx context.Context) error {
+	s.clientsMutex.Lock()
+	s.draining = true
+	clients := make(map[*websocket.Conn]*ClientInfo, len(s.clients))
+	for clientConn, info := range s.clients {
+		clients[clientConn] = info
+	}
+	s.clientsMutex.Unlock()
+
+	// 关闭帧发出后对端回复关闭帧，转发协程读到关闭后清理连接，重连协程不再重连
+	for clientConn, info := range clients {
+		clientConn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, shutdownCloseReason), time.Now().Add(closeWriteWait))
+		info.serverMu.Lock()
+		if info.ServerConn != nil {
+			info.ServerConn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(closeWriteWait))
+		}
+		info.serverMu.Unlock()
+	}
+	log.Printf("Closing %d WebSocket connections for shutdown", len(clients))
+
+	done := make(chan struct{})
+	go func() {
+		s.conns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// 超时未回复关闭帧的浏览器连接直接关闭，由 forwardFromClient 清理
+		for clientConn := range clients {
+			clientConn.Close()
+		}
+		return ctx.Err()
+	}
+}
+
+// closeConn 发送关闭帧后关闭连接
+func closeConn(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(closeWriteWait))
+	conn.Close()
+}
+
+// recentEventsSize 每个连接记住的最近事件数，用于丢弃重复推送
+const recentEventsSize = 256
+
+// recentEvents 最近收到的事件ID，超过容量时淘汰最早的
+type recentEvents struct {
+	ids   map[string]bool
+	order []string
+	next  int
+}
+
+func newRecentEvents(size int) *recentEvents {
+	return &recentEvents{
+		ids:   make(map[string]bool, size),
+		order: make([]string, size),
+	}
+}
+
+// seen 返回事件是否已收到过，未收到过时记录下来
+func (r *recentEvents) seen(id string) bool {
+	if r.ids[id] {
+		return true
+	}
+	delete(r.ids, r.order[r.next])
+	r.order[r.next] = id
+	r.ids[id] = true
+	r.next = (r.next + 1) % len(r.order)
+	return false
+}
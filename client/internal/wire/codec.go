@@ -0,0 +1,66 @@
+package wire
+
+import (
+	"encoding/json"
+
+	"im-system/client/internal/model"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket 子协议，名称中带 schema 版本
+const (
+	SubprotocolProtobuf = "im.v1.proto"
+	SubprotocolJSON     = "im.v1.json"
+)
+
+// Subprotocols 按优先级排列的可协商子协议
+var Subprotocols = []string{SubprotocolProtobuf, SubprotocolJSON}
+
+// Codec WebSocket 帧的编解码
+type Codec interface {
+	Marshal(msg *model.WSMessage) ([]byte, error)
+	Unmarshal(data []byte, msg *model.WSMessage) error
+	// FrameType 写出时使用的帧类型（文本或二进制）
+	FrameType() int
+}
+
+// ForSubprotocol 按握手协商的子协议选择编解码，未协商时（旧客户端）使用 JSON
+func ForSubprotocol(subprotocol string) Codec {
+	if subprotocol == SubprotocolProtobuf {
+		return protobufCodec{}
+	}
+	return jsonCodec{}
+}
+
+// ReadMessage 读取一帧并解码
+func ReadMessage(conn *websocket.Conn, codec Codec, msg *model.WSMessage) error {
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, msg)
+}
+
+// WriteMessage 编码后写出一帧
+func WriteMessage(conn *websocket.Conn, codec Codec, msg *model.WSMessage) error {
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(codec.FrameType(), data)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(msg *model.WSMessage) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) Unmarshal(data []byte, msg *model.WSMessage) error {
+	return json.Unmarshal(data, msg)
+}
+
+func (jsonCodec) FrameType() int {
+	return websocket.TextMessage
+}
@@ -0,0 +1,103 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"im-system/client/internal/model"
+	"im-system/shared/wsproto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var codecTestMessages = []struct {
+	name string
+	msg  model.WSMessage
+}{
+	{"empty", model.WSMessage{}},
+	{"ack", model.WSMessage{Type: "message_sent", ReceiverID: 7, MessageID: 42, ClientMessageID: "0b5c3f0e-8f5e-4c1a-9a57-3b1f2f1b6c11", EventID: "message_sent:42"}},
+	{"message", model.WSMessage{Type: "message", SenderID: 3, ReceiverID: 7, MessageID: 42, Timestamp: "2024-05-01T12:00:00Z", Content: base64.StdEncoding.EncodeToString([]byte{0, 1, 2, 0xff, 0xfe})}},
+	{"sealed message", model.WSMessage{Type: "sealed_message", ReceiverID: 7, Content: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xab}, 300))}},
+	{"non-canonical base64", model.WSMessage{Type: "message", ReceiverID: 7, Content: "not base64!"}},
+	{"error", model.WSMessage{Type: "error", ReceiverID: 7, Content: "cannot send messages to this user"}},
+	{"negative id", model.WSMessage{Type: "contact_removed", SenderID: -1}},
+	{"profile", model.WSMessage{Type: "profile_updated", SenderID: 3, Profile: &model.User{
+		ID: 3, Username: "alice", DisplayName: "Alice", Bio: "你好", StatusMessage: "busy", AvatarRef: "avatars/3",
+	}}},
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, subprotocol := range Subprotocols {
+		codec := ForSubprotocol(subprotocol)
+		for _, tt := range codecTestMessages {
+			t.Run(subprotocol+"/"+tt.name, func(t *testing.T) {
+				data, err := codec.Marshal(&tt.msg)
+				if err != nil {
+					t.Fatalf("Marshal: %v", err)
+				}
+				var got model.WSMessage
+				if err := codec.Unmarshal(data, &got); err != nil {
+					t.Fatalf("Unmarshal: %v", err)
+				}
+				if !reflect.DeepEqual(got, tt.msg) {
+					t.Errorf("round trip = %+v, want %+v", got, tt.msg)
+				}
+			})
+		}
+	}
+}
+
+func TestProtobufMatchesJSON(t *testing.T) {
+	jsonCodec := ForSubprotocol(SubprotocolJSON)
+	protoCodec := ForSubprotocol(SubprotocolProtobuf)
+	for _, tt := range codecTestMessages {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonData, err := jsonCodec.Marshal(&tt.msg)
+			if err != nil {
+				t.Fatalf("JSON Marshal: %v", err)
+			}
+			protoData, err := protoCodec.Marshal(&tt.msg)
+			if err != nil {
+				t.Fatalf("Protobuf Marshal: %v", err)
+			}
+
+			var fromJSON, fromProto model.WSMessage
+			if err := jsonCodec.Unmarshal(jsonData, &fromJSON); err != nil {
+				t.Fatalf("JSON Unmarshal: %v", err)
+			}
+			if err := protoCodec.Unmarshal(protoData, &fromProto); err != nil {
+				t.Fatalf("Protobuf Unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(fromJSON, fromProto) {
+				t.Errorf("JSON decodes to %+v, Protobuf decodes to %+v", fromJSON, fromProto)
+			}
+		})
+	}
+}
+
+func TestProtobufCiphertextIsRaw(t *testing.T) {
+	raw := []byte{0, 1, 2, 0xff}
+	msg := model.WSMessage{Type: "message", ReceiverID: 7, Content: base64.StdEncoding.EncodeToString(raw)}
+
+	data, err := ForSubprotocol(SubprotocolProtobuf).Marshal(&msg)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var frame wsproto.WSMessage
+	if err := proto.Unmarshal(data, &frame); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if frame.Content != "" || !bytes.Equal(frame.Ciphertext, raw) {
+		t.Errorf("content = %q, ciphertext = %x, want raw ciphertext %x", frame.Content, frame.Ciphertext, raw)
+	}
+}
+
+func TestProtobufRejectsMalformed(t *testing.T) {
+	var msg model.WSMessage
+	// 字段 1（长度分隔）声明 10 字节，实际只有 1 字节
+	if err := ForSubprotocol(SubprotocolProtobuf).Unmarshal([]byte{0x0a, 0x0a, 'x'}, &msg); err == nil {
+		t.Error("Unmarshal of truncated frame succeeded")
+	}
+}
@@ -0,0 +1,91 @@
+package wire
+
+import (
+	"encoding/base64"
+
+	"im-system/client/internal/model"
+	"im-system/shared/wsproto"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+)
+
+// protobufCodec 二进制编码，密文以原始字节传输，省去 Base64 约三分之一的开销
+type protobufCodec struct{}
+
+func (protobufCodec) Marshal(msg *model.WSMessage) ([]byte, error) {
+	frame := &wsproto.WSMessage{
+		Type:            msg.Type,
+		ReceiverId:      int64(msg.ReceiverID),
+		SenderId:        int64(msg.SenderID),
+		MessageId:       int64(msg.MessageID),
+		Timestamp:       msg.Timestamp,
+		ClientMessageId: msg.ClientMessageID,
+		EventId:         msg.EventID,
+	}
+	if ciphertext, ok := rawCiphertext(msg); ok {
+		frame.Ciphertext = ciphertext
+	} else {
+		frame.Content = msg.Content
+	}
+	if profile := msg.Profile; profile != nil {
+		frame.Profile = &wsproto.UserProfile{
+			Id:            int64(profile.ID),
+			Username:      profile.Username,
+			DisplayName:   profile.DisplayName,
+			Bio:           profile.Bio,
+			StatusMessage: profile.StatusMessage,
+			AvatarRef:     profile.AvatarRef,
+		}
+	}
+	return proto.Marshal(frame)
+}
+
+func (protobufCodec) Unmarshal(data []byte, msg *model.WSMessage) error {
+	var frame wsproto.WSMessage
+	if err := proto.Unmarshal(data, &frame); err != nil {
+		return err
+	}
+
+	*msg = model.WSMessage{
+		Type:            frame.Type,
+		ReceiverID:      int(frame.ReceiverId),
+		SenderID:        int(frame.SenderId),
+		Content:         frame.Content,
+		MessageID:       int(frame.MessageId),
+		Timestamp:       frame.Timestamp,
+		ClientMessageID: frame.ClientMessageId,
+		EventID:         frame.EventId,
+	}
+	if frame.Ciphertext != nil {
+		msg.Content = base64.StdEncoding.EncodeToString(frame.Ciphertext)
+	}
+	if profile := frame.Profile; profile != nil {
+		msg.Profile = &model.User{
+			ID:            int(profile.Id),
+			Username:      profile.Username,
+			DisplayName:   profile.DisplayName,
+			Bio:           profile.Bio,
+			StatusMessage: profile.StatusMessage,
+			AvatarRef:     profile.AvatarRef,
+		}
+	}
+	return nil
+}
+
+func (protobufCodec) FrameType() int {
+	return websocket.BinaryMessage
+}
+
+// rawCiphertext message、sealed_message 的内容是 Base64 编码的密文，解码为原始字节；
+// 只有规范编码才能在接收端还原为相同的字符串，其他内容仍按文本传输
+func rawCiphertext(msg *model.WSMessage) ([]byte, bool) {
+	if (msg.Type != "message" && msg.Type != "sealed_message") || msg.Content == "" {
+		return nil, false
+	}
+	raw, err := base64.StdEncoding.DecodeString(msg.Content)
+	if err != nil || base64.StdEncoding.EncodeToString(raw) != msg.Content {
+		return nil, false
+	}
+	return raw, true
+}
@@ -0,0 +1,101 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"im-system/shared/keyencoding"
+)
+
+// 安全码迭代次数与版本号（与 Signal 的数字指纹方案保持一致）
+const (
+	safetyNumberIterations = 5200
+	safetyNumberVersion    = 0
+)
+
+// Fingerprint 计算公钥指纹（SHA-256，按 4 字节分组的十六进制）
+func Fingerprint(publicKeyPEM string) (string, error) {
+	keyBytes, err := publicKeyBytes(publicKeyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(keyBytes)
+	encoded := hex.EncodeToString(hash[:])
+
+	groups := make([]string, 0, len(encoded)/8)
+	for i := 0; i < len(encoded); i += 8 {
+		groups = append(groups, encoded[i:i+8])
+	}
+	return strings.Join(groups, " "), nil
+}
+
+// SafetyNumber 根据双方的身份公钥计算安全码（60 位数字）
+// 双方计算结果相同，可通过当面比对或扫码确认没有被中间人替换公钥
+func SafetyNumber(localID int, localKeyPEM string, remoteID int, remoteKeyPEM string) (string, error) {
+	localKey, err := publicKeyBytes(localKeyPEM)
+	if err != nil {
+		return "", err
+	}
+	remoteKey, err := publicKeyBytes(remoteKeyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	local := displayableFingerprint(localKey, localID)
+	remote := displayableFingerprint(remoteKey, remoteID)
+
+	// 按固定顺序拼接，保证双方看到的安全码一致
+	var digits string
+	if local <= remote {
+		digits = local + remote
+	} else {
+		digits = remote + local
+	}
+
+	groups := make([]string, 0, len(digits)/5)
+	for i := 0; i < len(digits); i += 5 {
+		groups = append(groups, digits[i:i+5])
+	}
+	return strings.Join(groups, " "), nil
+}
+
+// displayableFingerprint 计算单方的 30 位数字指纹
+func displayableFingerprint(keyBytes []byte, userID int) string {
+	version := make([]byte, 2)
+	binary.BigEndian.PutUint16(version, safetyNumberVersion)
+
+	input := append(version, keyBytes...)
+	input = append(input, []byte(strconv.Itoa(userID))...)
+
+	hash := sha512.Sum512(input)
+	for i := 1; i < safetyNumberIterations; i++ {
+		hash = sha512.Sum512(append(hash[:], keyBytes...))
+	}
+
+	var sb strings.Builder
+	for i := 0; i < 30; i += 5 {
+		chunk := uint64(hash[i])<<32 | uint64(hash[i+1])<<24 | uint64(hash[i+2])<<16 |
+			uint64(hash[i+3])<<8 | uint64(hash[i+4])
+		sb.WriteString(padDigits(chunk % 100000))
+	}
+	return sb.String()
+}
+
+func padDigits(n uint64) string {
+	s := strconv.FormatUint(n, 10)
+	return strings.Repeat("0", 5-len(s)) + s
+}
+
+// publicKeyBytes 返回公钥的未压缩点编码，同一公钥的不同编码格式得到相同的指纹
+func publicKeyBytes(publicKeyPEM string) ([]byte, error) {
+	key, err := keyencoding.ParsePublicKey(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return key.Bytes(), nil
+}
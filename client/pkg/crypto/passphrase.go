@@ -0,0 +1,106 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt 参数（N=2^15, r=8, p=1，约 32MB 内存）
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltSize     = 16
+)
+
+// ErrInvalidPassphrase 口令错误或数据被篡改
+var ErrInvalidPassphrase = errors.New("invalid passphrase")
+
+// SealedBox 口令加密的数据（scrypt 派生密钥 + AES-256-GCM）
+type SealedBox struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// SealWithPassphrase 使用口令加密数据，additionalData 用于绑定上下文（如用户ID）
+func SealWithPassphrase(passphrase string, plaintext, additionalData []byte) (*SealedBox, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	box := &SealedBox{
+		Version: 1,
+		KDF:     "scrypt",
+		Salt:    salt,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+	}
+
+	gcm, err := box.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	box.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(box.Nonce); err != nil {
+		return nil, err
+	}
+	box.Ciphertext = gcm.Seal(nil, box.Nonce, plaintext, additionalData)
+
+	return box, nil
+}
+
+// OpenWithPassphrase 使用口令解密数据
+// 只接受固定的 scrypt 参数，备份数据来自服务端，过大的参数会耗尽本机内存和 CPU
+func OpenWithPassphrase(passphrase string, box *SealedBox, additionalData []byte) ([]byte, error) {
+	if box == nil || box.KDF != "scrypt" {
+		return nil, errors.New("unsupported sealed box")
+	}
+	if box.N != scryptN || box.R != scryptR || box.P != scryptP {
+		return nil, errors.New("unsupported scrypt parameters")
+	}
+
+	gcm, err := box.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(box.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+
+	plaintext, err := gcm.Open(nil, box.Nonce, box.Ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrInvalidPassphrase
+	}
+	return plaintext, nil
+}
+
+func (b *SealedBox) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), b.Salt, b.N, b.R, b.P, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,31 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"im-system/shared/keyencoding"
+)
+
+// SenderMAC 使用发送方私钥与接收方公钥的静态 ECDH 共享密钥计算消息认证码
+// 接收方用自己的私钥与证书中的发送方公钥计算同一个值，证明信封确实来自证书持有者
+func SenderMAC(privateKeyPEM, peerPublicKeyPEM string, data []byte) ([]byte, error) {
+	privateKey, err := keyencoding.ParsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	peerPublicKey, err := keyencoding.ParsePublicKey(peerPublicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedSecret, err := privateKey.ECDH(peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := sha256.Sum256(append([]byte("im-sealed-sender-v1"), sharedSecret...))
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
@@ -2,6 +2,7 @@ import React, { useState, useEffect } from 'react'
 import './App.css'
 import AuthPage from './pages/AuthPage'
 import ChatPage from './pages/ChatPage'
+import { authAPI } from './services/api'
 function App() {
   const [isLoggedIn, setIsLoggedIn] = useState(false)
   const [user, setUser] = useState(null)
@@ -16,17 +17,23 @@ function App() {
     }
   }, [])
 
-  const handleLogin = (token, userData) => {
+  const handleLogin = (token, refreshToken, userData) => {
     localStorage.setItem('token', token)
+    localStorage.setItem('refreshToken', refreshToken)
     localStorage.setItem('user', JSON.stringify(userData))
     setIsLoggedIn(true)
     setUser(userData)
   }
 
   const handleLogout = () => {
+    // 退出时吊销服务端会话并锁定客户端后端的密钥库
+    const token = localStorage.getItem('token')
+    if (token) {
+      authAPI.logout(token).catch(() => {})
+    }
     localStorage.removeItem('token')
+    localStorage.removeItem('refreshToken')
     localStorage.removeItem('user')
-    localStorage.removeItem('privateKey')
     setIsLoggedIn(false)
     setUser(null)
   }
@@ -81,7 +81,7 @@ function ChatWindow({ selectedUser, messages, currentUser, onSendMessage, loadin
             {messages.map((msg, index) => (
               <div
                 key={index}
-                className={`message ${msg.is_own || msg.sender_id === currentUser.user_id ? 'own' : 'other'}`}
+                className={`message ${msg.is_own || msg.sender_id === currentUser.user_id ? 'own' : 'other'} ${msg.status || ''}`}
               >
                 {!(msg.is_own || msg.sender_id === currentUser.user_id) && (
                   <div className="message-avatar">
@@ -90,11 +90,13 @@ function ChatWindow({ selectedUser, messages, currentUser, onSendMessage, loadin
                 )}
                 <div className="message-content">
                   <div className="message-text">{msg.content}</div>
-                  <div className="message-time">
+                  <div className="message-time" title={msg.error}>
                     {new Date(msg.timestamp || msg.created_at).toLocaleTimeString('zh-CN', {
                       hour: '2-digit',
                       minute: '2-digit',
                     })}
+                    {msg.status === 'pending' && ' · 发送中'}
+                    {msg.status === 'failed' && ' · 发送失败'}
                   </div>
                 </div>
               </div>
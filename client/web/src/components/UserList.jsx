@@ -1,31 +1,106 @@
 import React, { useState, useEffect } from 'react'
-import { userAPI } from '../services/api'
+import { contactAPI, userAPI } from '../services/api'
 import './UserList.css'
-function UserList({ currentUser, onlineUsers, onSelectUser, selectedUser, onLogout }) {
+function UserList({ currentUser, onlineUsers, updatedProfile, contactEvent, onSelectUser, selectedUser, onLogout }) {
   const [allUsers, setAllUsers] = useState([])
+  const [incomingRequests, setIncomingRequests] = useState([])
   const [searchTerm, setSearchTerm] = useState('')
+  const [findQuery, setFindQuery] = useState('')
+  const [findResults, setFindResults] = useState(null)
+  const [findCursor, setFindCursor] = useState('')
+  const [addStatus, setAddStatus] = useState('')
   const [loading, setLoading] = useState(true)
   const token = localStorage.getItem('token')
 
   useEffect(() => {
     fetchAllUsers()
+    fetchRequests()
   }, [])
 
+  // 收到好友请求或联系人变化时刷新
+  useEffect(() => {
+    if (!contactEvent) return
+    if (contactEvent.type !== 'contact_request') {
+      fetchAllUsers()
+    }
+    fetchRequests()
+  }, [contactEvent])
+
+  // 收到 profile_updated 事件时更新对应用户的资料
+  useEffect(() => {
+    if (!updatedProfile) return
+    setAllUsers((prev) =>
+      prev.map((user) => (user.id === updatedProfile.id ? { ...user, ...updatedProfile } : user))
+    )
+  }, [updatedProfile])
+
   const fetchAllUsers = async () => {
     try {
-      const response = await userAPI.getAllUsers()
+      const response = await contactAPI.list()
       setAllUsers(response.data.users || [])
     } catch (err) {
-      console.error('Failed to fetch users:', err)
+      console.error('Failed to fetch contacts:', err)
     } finally {
       setLoading(false)
     }
   }
 
+  const fetchRequests = async () => {
+    try {
+      const response = await contactAPI.listRequests()
+      setIncomingRequests(response.data.incoming || [])
+    } catch (err) {
+      console.error('Failed to fetch contact requests:', err)
+    }
+  }
+
+  // 搜索用户目录，cursor 不为空时加载下一页
+  const handleFindUsers = async (e, cursor = '') => {
+    e?.preventDefault()
+    const query = findQuery.trim()
+    if (!query) {
+      setFindResults(null)
+      return
+    }
+    try {
+      const response = await userAPI.search(query, cursor || undefined)
+      const users = response.data.users || []
+      setFindResults((prev) => (cursor ? [...(prev || []), ...users] : users))
+      setFindCursor(response.data.next_cursor || '')
+      setAddStatus('')
+    } catch (err) {
+      setAddStatus(err.response?.data?.error || '搜索失败')
+    }
+  }
+
+  const handleAddContact = async (username) => {
+    try {
+      const response = await contactAPI.sendRequest(username)
+      setAddStatus(response.data.accepted ? '已添加为联系人' : '已发送好友请求')
+    } catch (err) {
+      setAddStatus(err.response?.data?.error || '发送好友请求失败')
+    }
+  }
+
+  const handleRequest = async (requestID, accept) => {
+    try {
+      if (accept) {
+        await contactAPI.acceptRequest(requestID)
+      } else {
+        await contactAPI.declineRequest(requestID)
+      }
+      setIncomingRequests((prev) => prev.filter((request) => request.id !== requestID))
+    } catch (err) {
+      console.error('Failed to handle contact request:', err)
+    }
+  }
+
   const filteredUsers = allUsers.filter((user) => {
-    const username = user.username.toLowerCase()
     const search = searchTerm.toLowerCase()
-    return username.includes(search)
+    return (
+      user.username.toLowerCase().includes(search) ||
+      (user.display_name || '').toLowerCase().includes(search)
+    )
   })
 
   const isUserOnline = (userId) => {
@@ -52,24 +127,72 @@ function UserList({ currentUser, onlineUsers, onSelectUser, selectedUser, onLogo
       <div className="user-list-search">
         <input
           type="text"
-          placeholder="搜索用户..."
+          placeholder="搜索联系人..."
           value={searchTerm}
           onChange={(e) => setSearchTerm(e.target.value)}
           className="search-input"
         />
       </div>
 
+      <form className="user-list-search" onSubmit={handleFindUsers}>
+        <input
+          type="text"
+          placeholder="搜索用户名或昵称添加联系人"
+          value={findQuery}
+          onChange={(e) => setFindQuery(e.target.value)}
+          className="search-input"
+        />
+        {addStatus && <div className="add-contact-status">{addStatus}</div>}
+        {findResults && (
+          <div className="find-results">
+            {findResults.length === 0 && <div className="add-contact-status">没有找到用户</div>}
+            {findResults.map((result) => (
+              <div key={result.id} className="contact-request-item">
+                <div className="user-item-name">
+                  {result.display_name || result.username}
+                  {result.display_name && <small> @{result.username}</small>}
+                </div>
+                <div className="contact-request-actions">
+                  <button type="button" onClick={() => handleAddContact(result.username)}>添加</button>
+                </div>
+              </div>
+            ))}
+            {findCursor && (
+              <button type="button" className="find-more" onClick={() => handleFindUsers(null, findCursor)}>
+                加载更多
+              </button>
+            )}
+          </div>
+        )}
+      </form>
+
       <div className="user-list-content">
+        {incomingRequests.length > 0 && (
+          <div className="contact-requests-section">
+            <div className="section-title">好友请求 ({incomingRequests.length})</div>
+            {incomingRequests.map((request) => (
+              <div key={request.id} className="contact-request-item">
+                <div className="user-item-name">
+                  {request.user?.display_name || request.user?.username}
+                </div>
+                <div className="contact-request-actions">
+                  <button onClick={() => handleRequest(request.id, true)}>接受</button>
+                  <button onClick={() => handleRequest(request.id, false)}>拒绝</button>
+                </div>
+              </div>
+            ))}
+          </div>
+        )}
         <div className="online-users-section">
           <div className="section-title">
-            所有用户 ({filteredUsers.length})
+            联系人 ({filteredUsers.length})
           </div>
           {loading ? (
             <div className="loading">加载中...</div>
           ) : filteredUsers.length === 0 ? (
             <div className="empty-state">
-              <p>暂无用户</p>
-              <small>邀请朋友加入聊天</small>
+              <p>暂无联系人</p>
+              <small>输入用户名发送好友请求</small>
             </div>
           ) : (
             <div className="users-list">
@@ -82,12 +205,13 @@ function UserList({ currentUser, onlineUsers, onSelectUser, selectedUser, onLogo
                     onClick={() => onSelectUser(user)}
                   >
                     <div className="user-item-avatar">
-                      {user.username.charAt(0).toUpperCase()}
+                      {(user.display_name || user.username).charAt(0).toUpperCase()}
                     </div>
                     <div className="user-item-info">
-                      <div className="user-item-name">{user.username}</div>
+                      <div className="user-item-name">{user.display_name || user.username}</div>
                       <div className={`user-item-status ${online ? 'online' : 'offline'}`}>
                         {online ? '在线' : '离线'}
+                        {user.status_message && ` · ${user.status_message}`}
                       </div>
                     </div>
                     {online && <div className="user-item-indicator"></div>}
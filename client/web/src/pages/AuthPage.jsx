@@ -1,12 +1,16 @@
 import React, { useState } from 'react'
-import { authAPI, keyAPI } from '../services/api'
+import { authAPI, keystoreAPI } from '../services/api'
 import './AuthPage.css'
 function AuthPage({ onLogin }) {
   const [isLogin, setIsLogin] = useState(true)
   const [username, setUsername] = useState('')
   const [password, setPassword] = useState('')
+  const [passphrase, setPassphrase] = useState('')
   const [loading, setLoading] = useState(false)
   const [error, setError] = useState('')
+  // 开启两步验证的账户登录后需要输入验证码
+  const [challengeToken, setChallengeToken] = useState('')
+  const [code, setCode] = useState('')
 
   const handleSubmit = async (e) => {
     e.preventDefault()
@@ -15,48 +19,46 @@ function AuthPage({ onLogin }) {
 
     try {
       // 调用客户端后端API
-      const apiCall = isLogin ? authAPI.login : authAPI.register
-      const response = await apiCall(username, password)
+      let response
+      if (challengeToken) {
+        response = await authAPI.verifyTwoFactor(challengeToken, code.trim(), passphrase)
+      } else {
+        const apiCall = isLogin ? authAPI.login : authAPI.register
+        response = await apiCall(username, password, passphrase)
+      }
+
+      if (response.data.two_factor_required) {
+        setChallengeToken(response.data.challenge_token)
+        return
+      }
 
-      const { token, user_id, username: userName } = response.data
+      const { token, refresh_token, user_id, username: userName } = response.data
 
-      // 在客户端生成密钥对（更安全，私钥不经过网络传输）
-      if (!isLogin) {
-        // 注册时生成新密钥对
+      // 密钥对由客户端后端生成，私钥使用口令加密保存在本地密钥库中
+      // 旧版本保存在浏览器中的私钥迁移到密钥库后删除
+      const legacyPrivateKey = localStorage.getItem('privateKey')
+      if (legacyPrivateKey && isLogin && !response.data.keystore?.exists) {
+        localStorage.setItem('token', token)
         try {
-          const { generateKeyPair } = await import('../utils/crypto')
-          const { publicKey, privateKey } = await generateKeyPair()
-          
-          // 保存私钥到本地
-          localStorage.setItem('privateKey', privateKey)
-          
-          // 上传公钥到服务端
-          await keyAPI.uploadPublicKey(publicKey)
+          await keystoreAPI.importKey(legacyPrivateKey, passphrase)
+          localStorage.removeItem('privateKey')
         } catch (err) {
-          console.error('Failed to generate keys:', err)
-          setError('密钥生成失败，请重试')
-          return
-        }
-      } else {
-        // 登录时检查是否有私钥
-        const existingPrivateKey = localStorage.getItem('privateKey')
-        if (!existingPrivateKey) {
-          // 如果没有私钥，生成新的
-          try {
-            const { generateKeyPair } = await import('../utils/crypto')
-            const { publicKey, privateKey } = await generateKeyPair()
-            localStorage.setItem('privateKey', privateKey)
-            await keyAPI.uploadPublicKey(publicKey)
-          } catch (err) {
-            console.error('Failed to generate keys:', err)
-          }
+          console.error('Failed to migrate private key:', err)
         }
       }
 
-      onLogin(token, { user_id, username: userName })
+      onLogin(token, refresh_token, { user_id, username: userName })
       setUsername('')
       setPassword('')
+      setPassphrase('')
+      setChallengeToken('')
+      setCode('')
     } catch (err) {
+      // 挑战令牌过期后需要重新输入密码
+      if (challengeToken && err.response?.data?.error?.includes('challenge token')) {
+        setChallengeToken('')
+        setCode('')
+      }
       setError(err.response?.data?.error || 'An error occurred')
     } finally {
       setLoading(false)
@@ -98,10 +100,39 @@ function AuthPage({ onLogin }) {
             />
           </div>
 
+          <div className="form-group">
+            <label htmlFor="passphrase">密钥库口令</label>
+            <input
+              id="passphrase"
+              type="password"
+              value={passphrase}
+              onChange={(e) => setPassphrase(e.target.value)}
+              placeholder="用于加密本地私钥，不会发送到服务端"
+              required
+              disabled={loading}
+            />
+          </div>
+
+          {challengeToken && (
+            <div className="form-group">
+              <label htmlFor="code">验证码</label>
+              <input
+                id="code"
+                type="text"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                placeholder="输入验证器应用中的 6 位验证码或恢复码"
+                autoComplete="one-time-code"
+                required
+                disabled={loading}
+              />
+            </div>
+          )}
+
           {error && <div className="error-message">{error}</div>}
 
           <button type="submit" className="submit-btn" disabled={loading}>
-            {loading ? '处理中...' : isLogin ? '登录' : '注册'}
+            {loading ? '处理中...' : challengeToken ? '验证' : isLogin ? '登录' : '注册'}
           </button>
         </form>
 
@@ -114,6 +145,8 @@ function AuthPage({ onLogin }) {
               onClick={() => {
                 setIsLogin(!isLogin)
                 setError('')
+                setChallengeToken('')
+                setCode('')
               }}
               disabled={loading}
             >
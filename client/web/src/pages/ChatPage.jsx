@@ -1,5 +1,5 @@
 import React, { useState, useEffect, useRef } from 'react'
-import { userAPI } from '../services/api'
+import { userAPI, refreshAccessToken } from '../services/api'
 import './ChatPage.css'
 import UserList from '../components/UserList'
 import ChatWindow from '../components/ChatWindow'
@@ -8,9 +8,12 @@ function ChatPage({ user, onLogout }) {
   const [selectedUser, setSelectedUser] = useState(null)
   const [messages, setMessages] = useState({})
   const [onlineUsers, setOnlineUsers] = useState([])
+  // 最近一次收到的资料更新，由用户列表合并
+  const [updatedProfile, setUpdatedProfile] = useState(null)
+  // 最近一次收到的联系人事件，用户列表据此刷新联系人与好友请求
+  const [contactEvent, setContactEvent] = useState(null)
   const [loading, setLoading] = useState(true)
   const wsRef = useRef(null)
-  const token = localStorage.getItem('token')
 
   useEffect(() => {
     // 初始化 WebSocket 连接
@@ -26,9 +29,10 @@ function ChatPage({ user, onLogout }) {
   }, [])
 
   const initWebSocket = () => {
+    // 每次连接读取最新的访问令牌（刷新后会更新）
+    const token = localStorage.getItem('token')
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:'
-    const privateKey = localStorage.getItem('privateKey') || ''
-    const wsUrl = `${protocol}//${window.location.host}/api/ws?token=${token}&privateKey=${encodeURIComponent(privateKey)}`
+    const wsUrl = `${protocol}//${window.location.host}/api/ws?token=${token}`
 
     wsRef.current = new WebSocket(wsUrl)
 
@@ -46,8 +50,12 @@ function ChatPage({ user, onLogout }) {
       console.error('WebSocket error:', error)
     }
 
-    wsRef.current.onclose = () => {
+    wsRef.current.onclose = (event) => {
       console.log('WebSocket disconnected')
+      // 客户端后端与服务端断开时自行重连并保持本连接；只有令牌被服务端拒绝（1008）时先刷新令牌
+      if (event.code === 1008) {
+        refreshAccessToken().catch((err) => console.error('Failed to refresh token:', err))
+      }
       // 尝试重新连接
       setTimeout(initWebSocket, 3000)
     }
@@ -62,12 +70,40 @@ function ChatPage({ user, onLogout }) {
         ...prev,
         [senderID]: [...(prev[senderID] || []), message],
       }))
+    } else if (message.type === 'message_sent' && message.client_message_id) {
+      // 发送确认，更新本地添加的消息
+      updateOwnMessage(message.client_message_id, { status: 'sent', message_id: message.message_id })
+    } else if (['error', 'key_changed', 'key_unverifiable'].includes(message.type) && message.client_message_id) {
+      updateOwnMessage(message.client_message_id, { status: 'failed', error: message.content })
+    } else if (message.type === 'profile_updated' && message.profile) {
+      setUpdatedProfile(message.profile)
+      setSelectedUser((prev) => (prev?.id === message.profile.id ? { ...prev, ...message.profile } : prev))
+    } else if (['contact_request', 'contact_added', 'contact_removed'].includes(message.type)) {
+      setContactEvent({ ...message, receivedAt: Date.now() })
+      if (message.type === 'contact_added') {
+        fetchOnlineUsers()
+      } else if (message.type === 'contact_removed') {
+        setSelectedUser((prev) => (prev?.id === message.sender_id ? null : prev))
+      }
     } else if (message.type === 'pong') {
       // 心跳响应
       console.log('Pong received')
     }
   }
 
+  // updateOwnMessage 按客户端消息ID更新本地添加的消息
+  const updateOwnMessage = (clientMessageID, patch) => {
+    setMessages((prev) => {
+      const next = {}
+      for (const [userID, list] of Object.entries(prev)) {
+        next[userID] = list.map((msg) =>
+          msg.client_message_id === clientMessageID ? { ...msg, ...patch } : msg
+        )
+      }
+      return next
+    })
+  }
+
   const fetchOnlineUsers = async () => {
     try {
       const response = await userAPI.getOnlineUsers()
@@ -79,12 +115,14 @@ function ChatPage({ user, onLogout }) {
 
   const sendMessage = (receiverID, content) => {
     if (wsRef.current && wsRef.current.readyState === WebSocket.OPEN) {
-      // 发送明文消息（客户端后端会加密）
+      // 发送明文消息（客户端后端会加密），确认与错误带回 client_message_id
+      const clientMessageID = crypto.randomUUID()
       wsRef.current.send(
         JSON.stringify({
           type: 'message',
           receiver_id: receiverID,
           content: content,
+          client_message_id: clientMessageID,
         })
       )
 
@@ -99,6 +137,8 @@ function ChatPage({ user, onLogout }) {
             sender_id: user.user_id,
             timestamp: new Date().toISOString(),
             is_own: true,
+            client_message_id: clientMessageID,
+            status: 'pending',
           },
         ],
       }))
@@ -118,6 +158,8 @@ function ChatPage({ user, onLogout }) {
         <UserList
           currentUser={user}
           onlineUsers={onlineUsers}
+          updatedProfile={updatedProfile}
+          contactEvent={contactEvent}
           onSelectUser={setSelectedUser}
           selectedUser={selectedUser}
           onLogout={handleLogout}
@@ -19,13 +19,7 @@ api.interceptors.request.use(
       config.headers.Authorization = `Bearer ${token}`
     }
 
-    // 如果需要私钥（用于解密）
-    const privateKey = localStorage.getItem('privateKey')
-    if (privateKey && config.headers['X-Need-Private-Key']) {
-      config.headers['X-Private-Key'] = privateKey
-      delete config.headers['X-Need-Private-Key']
-    }
-
+    // 私钥保存在客户端后端的加密密钥库中，请求不再携带私钥
     return config
   },
   (error) => {
@@ -33,18 +27,50 @@ api.interceptors.request.use(
   }
 )
 
+// 正在进行的刷新请求，并发的 401 请求共用同一次刷新
+let refreshing = null
+
+// refreshAccessToken 使用刷新令牌换取新的访问令牌（刷新令牌同时轮换）
+export const refreshAccessToken = () => {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem('refreshToken')
+    refreshing = (refreshToken
+      ? axios.post(`${API_BASE_URL}/api/auth/refresh`, { refresh_token: refreshToken })
+      : Promise.reject(new Error('No refresh token'))
+    )
+      .then((response) => {
+        localStorage.setItem('token', response.data.token)
+        localStorage.setItem('refreshToken', response.data.refresh_token)
+        return response.data.token
+      })
+      .finally(() => {
+        refreshing = null
+      })
+  }
+  return refreshing
+}
+
 // 响应拦截器 - 处理错误
 api.interceptors.response.use(
   (response) => {
     return response
   },
-  (error) => {
-    if (error.response?.status === 401) {
-      // Token过期，清除本地存储并跳转到登录页
-      localStorage.removeItem('token')
-      localStorage.removeItem('user')
-      localStorage.removeItem('privateKey')
-      window.location.href = '/'
+  async (error) => {
+    const original = error.config
+    if (error.response?.status === 401 && original && !original._retried && !original.url?.startsWith('/api/auth/')) {
+      // 访问令牌过期，刷新后重试一次
+      original._retried = true
+      try {
+        const token = await refreshAccessToken()
+        original.headers.Authorization = `Bearer ${token}`
+        return api(original)
+      } catch (refreshError) {
+        // 刷新失败，清除本地存储并跳转到登录页
+        localStorage.removeItem('token')
+        localStorage.removeItem('refreshToken')
+        localStorage.removeItem('user')
+        window.location.href = '/'
+      }
     }
     return Promise.reject(error)
   }
@@ -52,32 +78,101 @@ api.interceptors.response.use(
 
 // 认证API
 export const authAPI = {
-  register: (username, password) =>
-    api.post('/api/auth/register', { username, password }),
-  login: (username, password) =>
-    api.post('/api/auth/login', { username, password }),
+  register: (username, password, passphrase) =>
+    api.post('/api/auth/register', { username, password, passphrase }),
+  login: (username, password, passphrase) =>
+    api.post('/api/auth/login', { username, password, passphrase }),
+  verifyTwoFactor: (challengeToken, code, passphrase) =>
+    api.post('/api/auth/2fa/verify', { challenge_token: challengeToken, code, passphrase }),
+  logout: (token) =>
+    api.post('/api/auth/logout', null, { headers: { Authorization: `Bearer ${token}` } }),
+}
+
+// 账户API
+export const accountAPI = {
+  changePassword: (currentPassword, newPassword) =>
+    api.put('/api/account/password', { current_password: currentPassword, new_password: newPassword }),
+  deleteAccount: (password, deleteSentMessages = false) =>
+    api.delete('/api/account', { data: { password, delete_sent_messages: deleteSentMessages } }),
+  exportData: () => api.get('/api/account/export', { responseType: 'blob' }),
+}
+
+// 两步验证API
+export const twoFactorAPI = {
+  status: () => api.get('/api/2fa'),
+  setup: () => api.post('/api/2fa/setup'),
+  activate: (code) => api.post('/api/2fa/activate', { code }),
+  disable: (code) => api.post('/api/2fa/disable', { code }),
+  regenerateRecoveryCodes: (code) => api.post('/api/2fa/recovery-codes', { code }),
+}
+
+// 会话（设备）管理API
+export const sessionAPI = {
+  list: () => api.get('/api/sessions'),
+  revoke: (sessionID) => api.delete(`/api/sessions/${sessionID}`),
+  revokeOthers: () => api.delete('/api/sessions'),
 }
 
 // 用户API
 export const userAPI = {
-  getAllUsers: () => api.get('/api/users'),
   getOnlineUsers: () => api.get('/api/users/online'),
+  getMe: () => api.get('/api/users/me'),
+  updateMe: (profile) => api.patch('/api/users/me', profile),
+  getUser: (userID) => api.get(`/api/users/${userID}`),
+  // 按用户名或显示名称搜索，cursor 为上一页返回的 next_cursor
+  search: (q, cursor) => api.get('/api/users/search', { params: { q, cursor } }),
+  // settings: { message_privacy: 'everyone' | 'contacts', discoverable: bool }，只修改出现的字段
+  getPrivacy: () => api.get('/api/users/me/privacy'),
+  updatePrivacy: (settings) => api.put('/api/users/me/privacy', settings),
+}
+
+// 联系人、好友请求与黑名单API
+export const contactAPI = {
+  list: () => api.get('/api/contacts'),
+  remove: (userID) => api.delete(`/api/contacts/${userID}`),
+  listRequests: () => api.get('/api/contacts/requests'),
+  sendRequest: (username) => api.post('/api/contacts/requests', { username }),
+  acceptRequest: (requestID) => api.post(`/api/contacts/requests/${requestID}/accept`),
+  declineRequest: (requestID) => api.post(`/api/contacts/requests/${requestID}/decline`),
+  listBlocked: () => api.get('/api/blocks'),
+  block: (userID) => api.put(`/api/blocks/${userID}`),
+  unblock: (userID) => api.delete(`/api/blocks/${userID}`),
 }
 
 // 密钥API
 export const keyAPI = {
   uploadPublicKey: (publicKey) => api.post('/api/keys/upload', { public_key: publicKey }),
   getPublicKey: (userID) => api.get(`/api/keys/${userID}`),
+  getSafetyNumber: (userID) => api.get(`/api/keys/${userID}/safety-number`),
+  verifyKey: (userID, safetyNumber) =>
+    api.post(`/api/keys/${userID}/verify`, { safety_number: safetyNumber }),
+  acknowledgeKey: (userID) => api.post(`/api/keys/${userID}/acknowledge`),
 }
 
 // 消息API
 export const messageAPI = {
-  sendMessage: (receiverID, content) =>
-    api.post('/api/messages/send', { receiver_id: receiverID, content }),
-  getUnreadMessages: () =>
-    api.get('/api/messages/unread', {
-      headers: { 'X-Need-Private-Key': 'true' },
-    }),
+  // clientMessageID 可选，重试时服务端返回已有消息
+  sendMessage: (receiverID, content, clientMessageID) =>
+    api.post('/api/messages/send', { receiver_id: receiverID, content, client_message_id: clientMessageID }),
+  getUnreadMessages: () => api.get('/api/messages/unread'),
+}
+
+// 本地密钥库API
+export const keystoreAPI = {
+  getStatus: () => api.get('/api/keystore'),
+  unlock: (passphrase) => api.post('/api/keystore/unlock', { passphrase }),
+  lock: () => api.post('/api/keystore/lock'),
+  importKey: (privateKey, passphrase) =>
+    api.post('/api/keystore/import', { private_key: privateKey, passphrase }),
+}
+
+// 私钥备份API
+export const backupAPI = {
+  create: (recoveryPassphrase) =>
+    api.post('/api/keys/backup', { recovery_passphrase: recoveryPassphrase }),
+  restore: (recoveryPassphrase, passphrase) =>
+    api.post('/api/keys/backup/restore', { recovery_passphrase: recoveryPassphrase, passphrase }),
+  remove: () => api.delete('/api/keys/backup'),
 }
 
 export default api
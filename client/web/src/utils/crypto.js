@@ -17,11 +17,11 @@ export async function generateKeyPair() {
 
     // 导出公钥为 SPKI 格式
     const publicKeyBuffer = await window.crypto.subtle.exportKey('spki', keyPair.publicKey)
-    const publicKeyPEM = arrayBufferToPEM(publicKeyBuffer, 'EC PUBLIC KEY')
+    const publicKeyPEM = arrayBufferToPEM(publicKeyBuffer, 'PUBLIC KEY')
 
     // 导出私钥为 PKCS8 格式
     const privateKeyBuffer = await window.crypto.subtle.exportKey('pkcs8', keyPair.privateKey)
-    const privateKeyPEM = arrayBufferToPEM(privateKeyBuffer, 'EC PRIVATE KEY')
+    const privateKeyPEM = arrayBufferToPEM(privateKeyBuffer, 'PRIVATE KEY')
 
     return {
       publicKey: publicKeyPEM,
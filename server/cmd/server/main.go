@@ -1,15 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"im-system/server/internal/broker"
 	"im-system/server/internal/config"
+	"im-system/server/internal/queue"
 	"im-system/server/internal/repository"
 	"im-system/server/internal/router"
 	"im-system/server/internal/service"
 	"im-system/server/pkg/logger"
+	"im-system/server/pkg/ratelimit"
+
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -30,19 +44,92 @@ func main() {
 	}
 	defer db.Close()
 
+	// 后台任务在关闭时最后停止，等待处理中的消息写入数据库
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	runWorker := func(run func(ctx context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workerCtx)
+		}()
+	}
+
 	// 初始化 Repository 层
 	userRepo := repository.NewUserRepository(db)
 	messageRepo := repository.NewMessageRepository(db)
 	keyRepo := repository.NewKeyRepository(db)
+	keyLogRepo := repository.NewKeyLogRepository(db)
+	signingKeyRepo := repository.NewSigningKeyRepository(db)
+	keyBackupRepo := repository.NewKeyBackupRepository(db)
+	deliveryTokenRepo := repository.NewDeliveryTokenRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	jwtKeyRepo := repository.NewJWTKeyRepository(db)
+	contactRepo := repository.NewContactRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+
+	// 多实例部署（MESSAGE_BUS=redis）时消息总线、在线状态与限流计数共用 Redis
+	redisClient, err := newRedisClient(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	limits := ratelimit.NewMemoryStore()
+	if redisClient != nil {
+		limits = ratelimit.NewRedisStore(redisClient)
+	}
 
 	// 初始化 Service 层
-	userService := service.NewUserService(userRepo, cfg)
-	messageService := service.NewMessageService(messageRepo, userRepo)
+	jwtKeyService, err := service.NewJWTKeyService(jwtKeyRepo, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT signing keys: %v", err)
+	}
+	runWorker(jwtKeyService.Run)
+	userService := service.NewUserService(userRepo, sessionRepo, twoFactorRepo, auditRepo, jwtKeyService, limits, cfg)
+	outboxDispatcher := service.NewOutboxDispatcher(outboxRepo)
+	messageService := service.NewMessageService(messageRepo, userRepo, contactRepo, outboxDispatcher)
+	keyLogService, err := service.NewKeyLogService(keyLogRepo, signingKeyRepo, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize key log: %v", err)
+	}
+	if err := keyLogService.Backfill(); err != nil {
+		log.Fatalf("Failed to backfill key log: %v", err)
+	}
 	keyService := service.NewKeyService(keyRepo, userRepo)
-	wsService := service.NewWebSocketService(messageService, userService)
+	keyBackupService := service.NewKeyBackupService(keyBackupRepo, limits, cfg)
+	sealedSenderService, err := service.NewSealedSenderService(deliveryTokenRepo, keyRepo, userRepo, signingKeyRepo, messageService, limits, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize sealed sender: %v", err)
+	}
+	messageBroker, presence := newMessageBus(cfg, redisClient)
+	defer messageBroker.Close()
+	messageQueue, err := newMessageQueue(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize message queue: %v", err)
+	}
+	defer messageQueue.Close()
+	messagePipeline := service.NewMessagePipeline(messageQueue, messageService)
+	wsService := service.NewWebSocketService(messagePipeline, userService, messageBroker, presence, cfg)
+	messagePipeline.OnDeliver(wsService.SendToUser)
+	outboxDispatcher.OnDeliver(wsService.Deliver)
+	expvar.Publish("websocket", expvar.Func(func() interface{} { return wsService.Stats() }))
+	runWorker(wsService.Run)
+	runWorker(messagePipeline.Run)
+	runWorker(outboxDispatcher.Run)
+	userService.OnSessionRevoked(wsService.DisconnectSession)
+	sessionService := service.NewSessionService(sessionRepo, userService)
+	profileService := service.NewProfileService(userRepo, contactRepo, sealedSenderService, wsService)
+	contactService := service.NewContactService(contactRepo, userRepo, sealedSenderService, wsService)
+	accountService := service.NewAccountService(userRepo, keyRepo, keyBackupRepo, twoFactorRepo, sessionRepo, messageService, sessionService, userService)
+	twoFactorService := service.NewTwoFactorService(twoFactorRepo, userRepo, userService, limits, cfg)
 
 	// 初始化路由
-	r := router.SetupRouter(cfg, userService, messageService, keyService, wsService)
+	r, err := router.SetupRouter(cfg, userService, messageService, keyService, keyLogService, keyBackupService, sealedSenderService, sessionService, accountService, profileService, contactService, twoFactorService, jwtKeyService, wsService, limits)
+	if err != nil {
+		log.Fatalf("Failed to set up router: %v", err)
+	}
 
 	// 启动服务器
 	port := os.Getenv("PORT")
@@ -50,8 +137,109 @@ func main() {
 		port = "8080"
 	}
 
-	logger.Info(fmt.Sprintf("🚀 IM Server starting on port %s", port))
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Server error: %v", err)
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+	adminSrv := &http.Server{
+		Addr:    cfg.AdminAddr,
+		Handler: router.SetupAdminRouter(),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		logger.Info(fmt.Sprintf("🚀 IM Server starting on port %s", port))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+	go func() {
+		logger.Info(fmt.Sprintf("Admin endpoints listening on %s", cfg.AdminAddr))
+		if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Admin server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	logger.Info("Shutting down IM Server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	// 拒绝新的 WebSocket 连接，写出各连接发送队列后发送 going away 关闭帧，客户端随即重连
+	if err := wsService.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Timed out closing WebSocket connections: %v", err)
+	}
+	// 停止监听并等待处理中的 HTTP 请求
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Timed out waiting for HTTP requests: %v", err)
+	}
+	if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Timed out waiting for admin requests: %v", err)
+	}
+	// 停止后台任务，消息队列中已接收的消息写入数据库后返回
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Printf("Timed out waiting for background workers: %v", shutdownCtx.Err())
+	}
+
+	// 返回后依次关闭消息队列、消息总线与数据库
+	logger.Info("IM Server stopped")
+}
+
+// newRedisClient MESSAGE_BUS=redis 时连接 Redis，单实例部署返回 nil
+func newRedisClient(cfg *config.Config) (*redis.Client, error) {
+	if cfg.MessageBus != "redis" {
+		return nil, nil
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     net.JoinHostPort(cfg.RedisHost, cfg.RedisPort),
+		Password: cfg.RedisPassword,
+		DB:       cfg.RedisDB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
 	}
+	return client, nil
+}
+
+// newMessageBus 按 MESSAGE_BUS 创建实例间消息总线与在线状态登记，Redis 总线关闭时关闭 client
+func newMessageBus(cfg *config.Config, client *redis.Client) (broker.Broker, broker.Presence) {
+	if client == nil {
+		return broker.NewMemoryBroker(), broker.NewMemoryPresence()
+	}
+
+	logger.Info(fmt.Sprintf("Using Redis message bus as node %s", cfg.NodeID))
+	return broker.NewRedisBroker(client), broker.NewRedisPresence(client, service.PresenceTTL)
+}
+
+// newMessageQueue 按 MESSAGE_QUEUE 创建消息队列
+func newMessageQueue(cfg *config.Config) (queue.Queue, error) {
+	if cfg.MessageQueue != "kafka" {
+		return queue.NewMemoryQueue(cfg.MessageQueuePartitions, cfg.MessageQueueBuffer), nil
+	}
+
+	brokers := []string{net.JoinHostPort(cfg.KafkaHost, cfg.KafkaPort)}
+	q, err := queue.NewKafkaQueue(brokers, cfg.KafkaTopic, cfg.KafkaGroup, cfg.MessageQueueBuffer)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info(fmt.Sprintf("Using Kafka message queue %s (topic %s, group %s)", brokers[0], cfg.KafkaTopic, cfg.KafkaGroup))
+	return q, nil
 }
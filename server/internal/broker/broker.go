@@ -0,0 +1,51 @@
+package broker
+
+import (
+	"context"
+
+	"im-system/server/internal/model"
+)
+
+// 实例间事件类型
+const (
+	// EventDeliver 推送消息给用户在目标节点上的连接
+	EventDeliver = "deliver"
+	// EventDisconnectSession 断开使用该会话建立的连接（会话可能在任一节点上）
+	EventDisconnectSession = "disconnect_session"
+)
+
+// Event 实例间传递的事件
+type Event struct {
+	Type      string           `json:"type"`
+	Origin    string           `json:"origin"` // 发出事件的节点
+	UserID    int              `json:"user_id,omitempty"`
+	SessionID string           `json:"session_id,omitempty"`
+	Message   *model.WSMessage `json:"message,omitempty"`
+	// EventID 推送事件的幂等键，转发失败重试时不变，订阅方据此丢弃已处理过的事件
+	EventID string `json:"event_id,omitempty"`
+}
+
+// Broker 实例间的消息总线
+type Broker interface {
+	// Publish 发送事件给指定节点
+	Publish(ctx context.Context, nodeID string, event *Event) error
+	// Broadcast 发送事件给所有节点（包括自己）
+	Broadcast(ctx context.Context, event *Event) error
+	// Subscribe 接收发给本节点及广播的事件，阻塞直到 ctx 结束
+	Subscribe(ctx context.Context, nodeID string, handler func(*Event)) error
+	Close() error
+}
+
+// Presence 分布式在线状态登记：记录每个用户在哪些节点上有连接
+type Presence interface {
+	// Add 记录用户在节点上线
+	Add(ctx context.Context, userID int, nodeID string) error
+	// Remove 用户在节点上的最后一个连接断开
+	Remove(ctx context.Context, userID int, nodeID string) error
+	// Refresh 续期节点上所有在线用户的记录，节点异常退出后记录随之过期
+	Refresh(ctx context.Context, nodeID string, userIDs []int) error
+	// Nodes 用户有连接的节点
+	Nodes(ctx context.Context, userID int) ([]string, error)
+	// FilterOnline 返回 userIDs 中在任一节点在线的用户
+	FilterOnline(ctx context.Context, userIDs []int) ([]int, error)
+}
@@ -0,0 +1,139 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryBroker 进程内消息总线，用于单实例部署与测试（同一进程内可模拟多个节点）
+type memoryBroker struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*subscription]bool
+}
+
+type subscription struct {
+	handler func(*Event)
+}
+
+// NewMemoryBroker 创建进程内消息总线
+func NewMemoryBroker() Broker {
+	return &memoryBroker{subscribers: make(map[string]map[*subscription]bool)}
+}
+
+func (b *memoryBroker) Publish(ctx context.Context, nodeID string, event *Event) error {
+	for _, sub := range b.snapshot(nodeID) {
+		sub.handler(event)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Broadcast(ctx context.Context, event *Event) error {
+	for _, sub := range b.snapshot("") {
+		sub.handler(event)
+	}
+	return nil
+}
+
+// snapshot 复制节点（为空时所有节点）的订阅，在锁外调用处理函数
+func (b *memoryBroker) snapshot(nodeID string) []*subscription {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var subs []*subscription
+	for node, nodeSubs := range b.subscribers {
+		if nodeID != "" && node != nodeID {
+			continue
+		}
+		for sub := range nodeSubs {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+func (b *memoryBroker) Subscribe(ctx context.Context, nodeID string, handler func(*Event)) error {
+	sub := &subscription{handler: handler}
+
+	b.mu.Lock()
+	if b.subscribers[nodeID] == nil {
+		b.subscribers[nodeID] = make(map[*subscription]bool)
+	}
+	b.subscribers[nodeID][sub] = true
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.subscribers[nodeID], sub)
+	if len(b.subscribers[nodeID]) == 0 {
+		delete(b.subscribers, nodeID)
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *memoryBroker) Close() error {
+	return nil
+}
+
+// memoryPresence 进程内在线状态登记
+type memoryPresence struct {
+	mu    sync.RWMutex
+	nodes map[int]map[string]bool
+}
+
+// NewMemoryPresence 创建进程内在线状态登记
+func NewMemoryPresence() Presence {
+	return &memoryPresence{nodes: make(map[int]map[string]bool)}
+}
+
+func (p *memoryPresence) Add(ctx context.Context, userID int, nodeID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.nodes[userID] == nil {
+		p.nodes[userID] = make(map[string]bool)
+	}
+	p.nodes[userID][nodeID] = true
+	return nil
+}
+
+func (p *memoryPresence) Remove(ctx context.Context, userID int, nodeID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.nodes[userID], nodeID)
+	if len(p.nodes[userID]) == 0 {
+		delete(p.nodes, userID)
+	}
+	return nil
+}
+
+// Refresh 进程内记录不会过期
+func (p *memoryPresence) Refresh(ctx context.Context, nodeID string, userIDs []int) error {
+	return nil
+}
+
+func (p *memoryPresence) Nodes(ctx context.Context, userID int) ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	nodes := make([]string, 0, len(p.nodes[userID]))
+	for nodeID := range p.nodes[userID] {
+		nodes = append(nodes, nodeID)
+	}
+	return nodes, nil
+}
+
+func (p *memoryPresence) FilterOnline(ctx context.Context, userIDs []int) ([]int, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	online := []int{}
+	for _, userID := range userIDs {
+		if len(p.nodes[userID]) > 0 {
+			online = append(online, userID)
+		}
+	}
+	return online, nil
+}
@@ -0,0 +1,170 @@
+package broker
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder 记录订阅收到的事件ID
+type recorder struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (r *recorder) handle(event *Event) {
+	r.mu.Lock()
+	r.ids = append(r.ids, event.EventID)
+	r.mu.Unlock()
+}
+
+func (r *recorder) events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ids...)
+}
+
+// subscribe 在后台订阅节点，等待订阅生效后返回取消函数，取消后等待 Subscribe 返回
+func subscribe(t *testing.T, b Broker, nodeID string, r *recorder) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	before := len(b.(*memoryBroker).snapshot(nodeID))
+	go func() {
+		defer close(done)
+		if err := b.Subscribe(ctx, nodeID, r.handle); err != nil {
+			t.Errorf("Subscribe: %v", err)
+		}
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for len(b.(*memoryBroker).snapshot(nodeID)) == before {
+		if time.Now().After(deadline) {
+			t.Fatalf("subscription to %s not registered", nodeID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestMemoryBrokerRouting(t *testing.T) {
+	tests := []struct {
+		name  string
+		send  func(ctx context.Context, b Broker) error
+		wantA []string
+		wantB []string
+	}{
+		{
+			name: "publish to one node in order",
+			send: func(ctx context.Context, b Broker) error {
+				for _, id := range []string{"1", "2", "3"} {
+					if err := b.Publish(ctx, "a", &Event{Type: EventDeliver, EventID: id}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			wantA: []string{"1", "2", "3"},
+		},
+		{
+			name: "publish to unknown node",
+			send: func(ctx context.Context, b Broker) error {
+				return b.Publish(ctx, "c", &Event{Type: EventDeliver, EventID: "1"})
+			},
+		},
+		{
+			name: "broadcast reaches every node",
+			send: func(ctx context.Context, b Broker) error {
+				return b.Broadcast(ctx, &Event{Type: EventDisconnectSession, EventID: "1"})
+			},
+			wantA: []string{"1"},
+			wantB: []string{"1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBroker()
+			defer b.Close()
+
+			var a, other recorder
+			stopA := subscribe(t, b, "a", &a)
+			defer stopA()
+			stopB := subscribe(t, b, "b", &other)
+			defer stopB()
+
+			if err := tt.send(context.Background(), b); err != nil {
+				t.Fatal(err)
+			}
+			// 进程内总线同步调用处理函数，返回时事件已处理
+			if got := a.events(); !reflect.DeepEqual(got, tt.wantA) {
+				t.Errorf("node a received %v, want %v", got, tt.wantA)
+			}
+			if got := other.events(); !reflect.DeepEqual(got, tt.wantB) {
+				t.Errorf("node b received %v, want %v", got, tt.wantB)
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerUnsubscribe(t *testing.T) {
+	b := NewMemoryBroker()
+	var first, second recorder
+	stopFirst := subscribe(t, b, "a", &first)
+	stopSecond := subscribe(t, b, "a", &second)
+	defer stopSecond()
+
+	ctx := context.Background()
+	b.Publish(ctx, "a", &Event{EventID: "1"})
+	stopFirst()
+	b.Publish(ctx, "a", &Event{EventID: "2"})
+
+	if got := first.events(); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("cancelled subscription received %v, want [1]", got)
+	}
+	if got := second.events(); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("remaining subscription received %v, want [1 2]", got)
+	}
+}
+
+func TestMemoryPresence(t *testing.T) {
+	ctx := context.Background()
+	p := NewMemoryPresence()
+	p.Add(ctx, 1, "a")
+	p.Add(ctx, 1, "b")
+	p.Add(ctx, 2, "a")
+	p.Remove(ctx, 2, "a")
+	p.Remove(ctx, 3, "a")
+
+	tests := []struct {
+		userID int
+		want   []string
+	}{
+		{1, []string{"a", "b"}},
+		{2, []string{}},
+		{3, []string{}},
+	}
+	for _, tt := range tests {
+		nodes, err := p.Nodes(ctx, tt.userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(nodes)
+		if !reflect.DeepEqual(nodes, tt.want) {
+			t.Errorf("Nodes(%d) = %v, want %v", tt.userID, nodes, tt.want)
+		}
+	}
+
+	online, err := p.FilterOnline(ctx, []int{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(online, []int{1}) {
+		t.Errorf("FilterOnline = %v, want [1]", online)
+	}
+}
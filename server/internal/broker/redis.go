@@ -0,0 +1,155 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis 键与频道
+const (
+	redisBroadcastChannel = "im:broadcast"
+	redisNodeChannel      = "im:node:"
+	redisPresenceKey      = "im:presence:"
+)
+
+// redisBroker 基于 Redis pub/sub 的消息总线，每个节点订阅自己的频道与广播频道
+type redisBroker struct {
+	client *redis.Client
+}
+
+// NewRedisBroker 创建 Redis 消息总线，Close 时关闭 client
+func NewRedisBroker(client *redis.Client) Broker {
+	return &redisBroker{client: client}
+}
+
+func (b *redisBroker) Publish(ctx context.Context, nodeID string, event *Event) error {
+	return b.publish(ctx, redisNodeChannel+nodeID, event)
+}
+
+func (b *redisBroker) Broadcast(ctx context.Context, event *Event) error {
+	return b.publish(ctx, redisBroadcastChannel, event)
+}
+
+func (b *redisBroker) publish(ctx context.Context, channel string, event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, channel, payload).Err()
+}
+
+// Subscribe 连接断开时 go-redis 自动重连并重新订阅，期间发布的事件会丢失
+func (b *redisBroker) Subscribe(ctx context.Context, nodeID string, handler func(*Event)) error {
+	pubsub := b.client.Subscribe(ctx, redisNodeChannel+nodeID, redisBroadcastChannel)
+	defer pubsub.Close()
+
+	// 等待订阅确认，Redis 不可用时立即返回错误
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				log.Printf("Invalid broker event on %s: %v", msg.Channel, err)
+				continue
+			}
+			handler(&event)
+		}
+	}
+}
+
+func (b *redisBroker) Close() error {
+	return b.client.Close()
+}
+
+// redisPresence 基于 Redis 有序集合的在线状态登记：每个用户一个键，成员为节点ID，分数为过期时间
+type redisPresence struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisPresence 创建 Redis 在线状态登记，节点需要在 ttl 内调用 Refresh 续期
+func NewRedisPresence(client *redis.Client, ttl time.Duration) Presence {
+	return &redisPresence{client: client, ttl: ttl}
+}
+
+func (p *redisPresence) Add(ctx context.Context, userID int, nodeID string) error {
+	return p.Refresh(ctx, nodeID, []int{userID})
+}
+
+func (p *redisPresence) Remove(ctx context.Context, userID int, nodeID string) error {
+	return p.client.ZRem(ctx, presenceKey(userID), nodeID).Err()
+}
+
+func (p *redisPresence) Refresh(ctx context.Context, nodeID string, userIDs []int) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	expiresAt := float64(time.Now().Add(p.ttl).UnixMilli())
+	_, err := p.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range userIDs {
+			key := presenceKey(userID)
+			pipe.ZAdd(ctx, key, redis.Z{Score: expiresAt, Member: nodeID})
+			pipe.PExpire(ctx, key, p.ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (p *redisPresence) Nodes(ctx context.Context, userID int) ([]string, error) {
+	return p.client.ZRangeByScore(ctx, presenceKey(userID), &redis.ZRangeBy{
+		Min: "(" + nowMillis(),
+		Max: "+inf",
+	}).Result()
+}
+
+func (p *redisPresence) FilterOnline(ctx context.Context, userIDs []int) ([]int, error) {
+	online := []int{}
+	if len(userIDs) == 0 {
+		return online, nil
+	}
+
+	now := "(" + nowMillis()
+	counts := make([]*redis.IntCmd, len(userIDs))
+	_, err := p.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, userID := range userIDs {
+			counts[i] = pipe.ZCount(ctx, presenceKey(userID), now, "+inf")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, count := range counts {
+		if count.Val() > 0 {
+			online = append(online, userIDs[i])
+		}
+	}
+	return online, nil
+}
+
+func presenceKey(userID int) string {
+	return fmt.Sprintf("%s%d", redisPresenceKey, userID)
+}
+
+func nowMillis() string {
+	return strconv.FormatInt(time.Now().UnixMilli(), 10)
+}
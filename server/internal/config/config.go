@@ -1,8 +1,15 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 )
 
@@ -14,19 +21,83 @@ type Config struct {
 	DBPassword string
 	DBName     string
 
-	// Kafka 配置
-	KafkaHost string
-	KafkaPort string
+	// Kafka 配置（MESSAGE_QUEUE=kafka 时使用）
+	KafkaHost  string
+	KafkaPort  string
+	KafkaTopic string
+	// 写入数据库的消费组，同一组内的实例分担 topic 的分区
+	KafkaGroup string
 
-	// JWT 配置
-	JWTSecret string
+	// 消息队列：memory（进程内）或 kafka
+	MessageQueue string
+	// 进程内队列的分区数；每个分区（Kafka 为生产者）积压消息的上限
+	MessageQueuePartitions int
+	MessageQueueBuffer     int
+
+	// 运行环境：development 或 production
+	AppEnv string
+
+	// JWT 配置：ES256/EdDSA 使用数据库中定期轮换的密钥，HS256 使用 JWTSecret（兼容旧部署）
+	JWTAlgorithm        string
+	JWTKeyRotationHours int
+	JWTSecret           string
+	// 加密数据库中签名私钥的 AES-256 密钥（base64 编码的 32 字节）
+	JWTKeyEncryptionKey string
+	// 访问令牌有效期（分钟）与刷新令牌有效期（天）
+	AccessTokenTTLMinutes int
+	RefreshTokenTTLDays   int
+
+	// 两步验证在验证器应用中显示的发行方名称
+	TOTPIssuer string
+
+	// 登录/注册接口每个 IP 与用户名每分钟允许的请求数
+	AuthRequestsPerMinute int
+	// 连续登录失败多少次后锁定账户，首次锁定时长（秒），锁定时长上限（分钟）
+	LoginLockoutThreshold  int
+	LoginLockoutSeconds    int
+	LoginLockoutMaxMinutes int
 
 	// Redis 配置
-	RedisHost string
-	RedisPort string
+	RedisHost     string
+	RedisPort     string
+	RedisPassword string
+	RedisDB       int
+
+	// 实例间消息总线：memory（单实例）或 redis（多实例部署）
+	MessageBus string
+	// 本实例的节点ID，多实例部署时必须互不相同，为空时启动时随机生成
+	NodeID string
+
+	// 每个 WebSocket 连接发送队列的长度
+	WSSendBuffer int
+	// 发送队列已满（慢消费者）时的处理：disconnect（断开连接）或 drop（丢弃该条推送）
+	WSSlowConsumerPolicy string
+	// WebSocket 心跳：发送 ping 的间隔，超过 WSPongTimeoutSeconds 未收到 pong 或任何消息时断开（秒）
+	WSPingIntervalSeconds int
+	WSPongTimeoutSeconds  int
+	// 写出一条消息的超时（秒）
+	WSWriteTimeoutSeconds int
+	// 客户端发来的单条消息大小上限（字节）
+	WSMaxMessageBytes int
+
+	// 收到 SIGTERM/SIGINT 后等待连接关闭与消息写入完成的最长时间（秒）
+	ShutdownTimeoutSeconds int
 
 	// 服务器配置
 	ServerPort string
+	// 可信反向代理的 IP 或 CIDR，只有来自这些地址的请求才采用 X-Forwarded-For；默认为空，使用连接的对端地址
+	TrustedProxies []string
+	// 管理接口（/debug/vars）的监听地址，默认只监听本机回环地址
+	AdminAddr string
+
+	// 公钥透明日志签名私钥（PKCS#8 PEM 格式的 Ed25519 私钥）
+	KeyLogSigningKey string
+
+	// 密封发送证书签名私钥（PKCS#8 PEM 格式的 Ed25519 私钥）
+	SealedSenderSigningKey string
+
+	// 私钥备份每小时允许下载的次数
+	KeyBackupRetrievalsPerHour int
 }
 
 // Load 加载配置
@@ -35,7 +106,8 @@ func Load() (*Config, error) {
 	_ = godotenv.Load("../../.env")
 	_ = godotenv.Load(".env")
 
-	return &Config{
+	cfg := &Config{
+		AppEnv:     getEnv("APP_ENV", "development"),
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBPort:     getEnv("DB_PORT", "5432"),
 		DBUser:     getEnv("DB_USER", "postgres"),
@@ -43,11 +115,114 @@ func Load() (*Config, error) {
 		DBName:     getEnv("DB_NAME", "im_db"),
 		KafkaHost:  getEnv("KAFKA_HOST", "localhost"),
 		KafkaPort:  getEnv("KAFKA_PORT", "9092"),
-		JWTSecret:  getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		KafkaTopic: getEnv("KAFKA_TOPIC", "im-messages"),
+		KafkaGroup: getEnv("KAFKA_GROUP", "im-message-writers"),
+		JWTSecret:  getEnv("JWT_SECRET", defaultJWTSecret),
 		RedisHost:  getEnv("REDIS_HOST", "localhost"),
 		RedisPort:  getEnv("REDIS_PORT", "6379"),
+		MessageBus: getEnv("MESSAGE_BUS", "memory"),
+		NodeID:     getEnv("NODE_ID", uuid.New().String()),
 		ServerPort: getEnv("PORT", "8080"),
-	}, nil
+
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+		AdminAddr:      getEnv("ADMIN_ADDR", "127.0.0.1:9090"),
+
+		WSSendBuffer:         getEnvInt("WS_SEND_BUFFER", 256),
+		WSSlowConsumerPolicy: getEnv("WS_SLOW_CONSUMER_POLICY", "disconnect"),
+
+		WSPingIntervalSeconds: getEnvInt("WS_PING_INTERVAL_SECONDS", 30),
+		WSPongTimeoutSeconds:  getEnvInt("WS_PONG_TIMEOUT_SECONDS", 60),
+		WSWriteTimeoutSeconds: getEnvInt("WS_WRITE_TIMEOUT_SECONDS", 10),
+		WSMaxMessageBytes:     getEnvInt("WS_MAX_MESSAGE_BYTES", 256<<10),
+
+		ShutdownTimeoutSeconds: getEnvInt("SHUTDOWN_TIMEOUT_SECONDS", 30),
+
+		MessageQueue:           getEnv("MESSAGE_QUEUE", "memory"),
+		MessageQueuePartitions: getEnvInt("MESSAGE_QUEUE_PARTITIONS", 16),
+		MessageQueueBuffer:     getEnvInt("MESSAGE_QUEUE_BUFFER", 1024),
+
+		RedisPassword: getEnv("REDIS_PASSWORD", ""),
+		RedisDB:       getEnvInt("REDIS_DB", 0),
+
+		KeyLogSigningKey: getEnv("KEYLOG_SIGNING_KEY", ""),
+
+		SealedSenderSigningKey: getEnv("SEALED_SENDER_SIGNING_KEY", ""),
+
+		KeyBackupRetrievalsPerHour: getEnvInt("KEY_BACKUP_RETRIEVALS_PER_HOUR", 5),
+
+		AccessTokenTTLMinutes: getEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15),
+		RefreshTokenTTLDays:   getEnvInt("REFRESH_TOKEN_TTL_DAYS", 30),
+		TOTPIssuer:            getEnv("TOTP_ISSUER", "IM System"),
+
+		AuthRequestsPerMinute:  getEnvInt("AUTH_REQUESTS_PER_MINUTE", 10),
+		LoginLockoutThreshold:  getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+		LoginLockoutSeconds:    getEnvInt("LOGIN_LOCKOUT_SECONDS", 60),
+		LoginLockoutMaxMinutes: getEnvInt("LOGIN_LOCKOUT_MAX_MINUTES", 60),
+
+		JWTAlgorithm:        getEnv("JWT_ALGORITHM", "ES256"),
+		JWTKeyRotationHours: getEnvInt("JWT_KEY_ROTATION_HOURS", 168),
+		JWTKeyEncryptionKey: getEnv("JWT_KEY_ENCRYPTION_KEY", defaultJWTKeyEncryptionKey),
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// defaultJWTSecret JWT_SECRET 的默认值，仅用于本地开发
+const defaultJWTSecret = "your-secret-key-change-in-production"
+
+// defaultJWTKeyEncryptionKey JWT_KEY_ENCRYPTION_KEY 的默认值，仅用于本地开发
+const defaultJWTKeyEncryptionKey = "ZGV2LW9ubHktand0LWtleS1lbmNyeXB0aW9uLWtleSE="
+
+// IsProduction 是否运行在生产环境
+func (c *Config) IsProduction() bool {
+	return c.AppEnv == "production"
+}
+
+// validate 校验配置，生产环境拒绝使用默认密钥启动
+func (c *Config) validate() error {
+	switch c.JWTAlgorithm {
+	case "ES256", "EdDSA":
+		if c.IsProduction() && c.JWTKeyEncryptionKey == defaultJWTKeyEncryptionKey {
+			return errors.New("JWT_KEY_ENCRYPTION_KEY must be changed from the default value in production")
+		}
+		if key, err := base64.StdEncoding.DecodeString(c.JWTKeyEncryptionKey); err != nil || len(key) != 32 {
+			return errors.New("JWT_KEY_ENCRYPTION_KEY must be 32 bytes encoded in base64")
+		}
+	case "HS256":
+		if c.IsProduction() && c.JWTSecret == defaultJWTSecret {
+			return errors.New("JWT_SECRET must be changed from the default value in production")
+		}
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q, expected ES256, EdDSA or HS256", c.JWTAlgorithm)
+	}
+
+	if c.MessageBus != "memory" && c.MessageBus != "redis" {
+		return fmt.Errorf("unsupported MESSAGE_BUS %q, expected memory or redis", c.MessageBus)
+	}
+	if c.WSSlowConsumerPolicy != "disconnect" && c.WSSlowConsumerPolicy != "drop" {
+		return fmt.Errorf("unsupported WS_SLOW_CONSUMER_POLICY %q, expected disconnect or drop", c.WSSlowConsumerPolicy)
+	}
+	// pong 超时必须长于 ping 间隔，否则空闲连接会在下一次 ping 之前被断开
+	if c.WSPongTimeoutSeconds <= c.WSPingIntervalSeconds {
+		return errors.New("WS_PONG_TIMEOUT_SECONDS must be longer than WS_PING_INTERVAL_SECONDS")
+	}
+	if c.MessageQueue != "memory" && c.MessageQueue != "kafka" {
+		return fmt.Errorf("unsupported MESSAGE_QUEUE %q, expected memory or kafka", c.MessageQueue)
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("invalid TRUSTED_PROXIES entry %q, expected an IP or CIDR", proxy)
+		}
+	}
+
+	// 上一个密钥只保留一个轮换周期，周期必须长于访问令牌有效期
+	if c.JWTKeyRotationHours*60 <= c.AccessTokenTTLMinutes {
+		return errors.New("JWT_KEY_ROTATION_HOURS must be longer than ACCESS_TOKEN_TTL_MINUTES")
+	}
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -56,3 +231,21 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList 读取逗号分隔的列表，忽略空项
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
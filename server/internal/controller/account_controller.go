@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"im-system/server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountController 账户生命周期控制器
+type AccountController struct {
+	accountService service.AccountService
+}
+
+// NewAccountController 创建账户控制器实例
+func NewAccountController(accountService service.AccountService) *AccountController {
+	return &AccountController{
+		accountService: accountService,
+	}
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// DeleteAccountRequest 删除账户请求
+type DeleteAccountRequest struct {
+	Password           string `json:"password" binding:"required"`
+	DeleteSentMessages bool   `json:"delete_sent_messages"` // 默认匿名化发出的消息，保留给接收方
+}
+
+// ChangePassword 修改密码，退出其他设备
+func (ctrl *AccountController) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+	claims, ok := getClaimsFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.accountService.ChangePassword(userID, claims.SessionID, req.CurrentPassword, req.NewPassword); err != nil {
+		ctrl.handleError(c, err, "Failed to change password")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// DeleteAccount 删除账户
+func (ctrl *AccountController) DeleteAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+
+	if err := ctrl.accountService.DeleteAccount(userID, req.Password, req.DeleteSentMessages); err != nil {
+		ctrl.handleError(c, err, "Failed to delete account")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
+
+// Export 以 JSON 附件形式导出用户数据
+func (ctrl *AccountController) Export(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	export, err := ctrl.accountService.Export(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account data"})
+		return
+	}
+
+	filename := fmt.Sprintf("im-export-%s-%s.json", export.Profile.Username, export.ExportedAt.Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.IndentedJSON(http.StatusOK, export)
+}
+
+// handleError 将账户服务错误映射为 HTTP 状态码
+func (ctrl *AccountController) handleError(c *gin.Context, err error, message string) {
+	switch err {
+	case service.ErrWrongPassword:
+		// 使用 403 而不是 401，避免前端误以为访问令牌失效
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case service.ErrPasswordUnchanged:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -1,8 +1,12 @@
 package controller
 
 import (
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 
+	"im-system/server/internal/model"
 	"im-system/server/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -22,21 +26,51 @@ func NewAuthController(userService service.UserService) *AuthController {
 
 // RegisterRequest 注册请求
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"device_name"`
+	// DeviceIP 客户端后端转发的浏览器 IP，仅用于会话列表展示
+	DeviceIP string `json:"device_ip"`
 }
 
 // LoginRequest 登录请求
 type LoginRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"device_name"`
+	DeviceIP   string `json:"device_ip"`
+}
+
+// RefreshRequest 刷新令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+	DeviceIP     string `json:"device_ip"`
 }
 
 // AuthResponse 认证响应
 type AuthResponse struct {
-	Token    string `json:"token"`
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	UserID       int    `json:"user_id"`
+	Username     string `json:"username"`
+}
+
+// TwoFactorChallengeResponse 需要两步验证时的登录响应
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+func newAuthResponse(result *model.LoginResult) AuthResponse {
+	return AuthResponse{
+		Token:        result.Tokens.AccessToken,
+		RefreshToken: result.Tokens.RefreshToken,
+		ExpiresIn:    result.Tokens.ExpiresIn,
+		UserID:       result.UserID,
+		Username:     result.Username,
+	}
 }
 
 // Register 注册
@@ -47,16 +81,18 @@ func (ctrl *AuthController) Register(c *gin.Context) {
 		return
 	}
 
-	token, userID, err := ctrl.userService.Register(req.Username, req.Password)
+	tokens, userID, err := ctrl.userService.Register(req.Username, req.Password, deviceInfo(c, req.DeviceName, req.DeviceIP))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, AuthResponse{
-		Token:    token,
-		UserID:   userID,
-		Username: req.Username,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		UserID:       userID,
+		Username:     req.Username,
 	})
 }
 
@@ -68,15 +104,91 @@ func (ctrl *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	token, userID, err := ctrl.userService.Login(req.Username, req.Password)
+	result, retryAfter, err := ctrl.userService.Login(req.Username, req.Password, deviceInfo(c, req.DeviceName, req.DeviceIP))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		switch err {
+		case service.ErrAccountLocked:
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case service.ErrInvalidCredentials:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to login"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, AuthResponse{
-		Token:    token,
-		UserID:   userID,
-		Username: req.Username,
-	})
+	// 开启了两步验证，需要调用 /api/auth/2fa/verify 完成登录
+	if result.ChallengeToken != "" {
+		c.JSON(http.StatusOK, TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    result.ChallengeToken,
+			ExpiresIn:         result.ChallengeExpiresIn,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, newAuthResponse(result))
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func (ctrl *AuthController) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	tokens, err := ctrl.userService.RefreshTokens(req.RefreshToken, deviceIP(c, req.DeviceIP))
+	if err != nil {
+		if err == service.ErrInvalidRefreshToken || err == service.ErrRefreshTokenReused {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout 退出登录，吊销当前访问令牌与刷新令牌
+func (ctrl *AuthController) Logout(c *gin.Context) {
+	claims, ok := getClaimsFromContext(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.userService.Logout(claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// deviceInfo 从请求中提取登录设备信息，未提供设备名时使用 User-Agent
+func deviceInfo(c *gin.Context, deviceName, reportedIP string) *model.DeviceInfo {
+	userAgent := c.Request.UserAgent()
+	if deviceName == "" {
+		deviceName = userAgent
+	}
+	if runes := []rune(deviceName); len(runes) > 255 {
+		deviceName = string(runes[:255])
+	}
+
+	return &model.DeviceInfo{
+		Name:      deviceName,
+		UserAgent: userAgent,
+		IPAddress: deviceIP(c, reportedIP),
+	}
+}
+
+// deviceIP 会话记录的设备 IP：优先使用请求体中转发的浏览器 IP，否则为请求来源地址
+// 转发的 IP 只影响本人会话列表的展示，限流与锁定始终按连接的对端地址计数
+func deviceIP(c *gin.Context, reportedIP string) string {
+	if ip := net.ParseIP(reportedIP); ip != nil {
+		return ip.String()
+	}
+	return c.ClientIP()
 }
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"im-system/server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContactController 联系人、好友请求与黑名单控制器
+type ContactController struct {
+	contactService service.ContactService
+}
+
+// NewContactController 创建联系人控制器实例
+func NewContactController(contactService service.ContactService) *ContactController {
+	return &ContactController{
+		contactService: contactService,
+	}
+}
+
+// ContactRequestRequest 发送好友请求，user_id 与 username 二选一
+type ContactRequestRequest struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// ListContacts 获取联系人列表
+func (ctrl *ContactController) ListContacts(c *gin.Context) {
+	contacts, err := ctrl.contactService.ListContacts(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contacts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": contacts})
+}
+
+// RemoveContact 删除联系人（双向）
+func (ctrl *ContactController) RemoveContact(c *gin.Context) {
+	contactID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.contactService.RemoveContact(getUserIDFromContext(c), contactID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove contact"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contact removed successfully"})
+}
+
+// ListRequests 获取收到与发出的好友请求
+func (ctrl *ContactController) ListRequests(c *gin.Context) {
+	requests, err := ctrl.contactService.ListRequests(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch contact requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// SendRequest 发送好友请求，对方已发出请求时直接成为联系人
+func (ctrl *ContactController) SendRequest(c *gin.Context) {
+	var req ContactRequestRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.UserID == 0 && req.Username == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	request, accepted, err := ctrl.contactService.SendRequest(getUserIDFromContext(c), req.UserID, req.Username)
+	if err != nil {
+		ctrl.handleError(c, err, "Failed to send contact request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accepted": accepted, "request": request})
+}
+
+// AcceptRequest 接受好友请求
+func (ctrl *ContactController) AcceptRequest(c *gin.Context) {
+	requestID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	if err := ctrl.contactService.AcceptRequest(getUserIDFromContext(c), requestID); err != nil {
+		ctrl.handleError(c, err, "Failed to accept contact request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contact request accepted"})
+}
+
+// DeclineRequest 拒绝收到的好友请求或撤回发出的请求
+func (ctrl *ContactController) DeclineRequest(c *gin.Context) {
+	requestID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request ID"})
+		return
+	}
+
+	if err := ctrl.contactService.DeclineRequest(getUserIDFromContext(c), requestID); err != nil {
+		ctrl.handleError(c, err, "Failed to decline contact request")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contact request declined"})
+}
+
+// ListBlocked 获取黑名单
+func (ctrl *ContactController) ListBlocked(c *gin.Context) {
+	blocked, err := ctrl.contactService.ListBlocked(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blocked users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": blocked})
+}
+
+// Block 拉黑用户
+func (ctrl *ContactController) Block(c *gin.Context) {
+	blockedID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.contactService.Block(getUserIDFromContext(c), blockedID); err != nil {
+		ctrl.handleError(c, err, "Failed to block user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked"})
+}
+
+// Unblock 取消拉黑
+func (ctrl *ContactController) Unblock(c *gin.Context) {
+	blockedID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := ctrl.contactService.Unblock(getUserIDFromContext(c), blockedID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
+}
+
+// handleError 将联系人服务错误映射为 HTTP 状态码
+func (ctrl *ContactController) handleError(c *gin.Context, err error, message string) {
+	switch err {
+	case service.ErrContactSelf:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case service.ErrContactUserNotFound, service.ErrContactRequestNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case service.ErrContactRequestBlocked:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case service.ErrAlreadyContact:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// userIDParam 解析路径中的用户ID，失败时直接返回 400
+func userIDParam(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return userID, true
+}
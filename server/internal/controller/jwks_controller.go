@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"net/http"
+
+	"im-system/server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSController 访问令牌签名公钥控制器
+type JWKSController struct {
+	jwtKeyService service.JWTKeyService
+}
+
+// NewJWKSController 创建签名公钥控制器实例
+func NewJWKSController(jwtKeyService service.JWTKeyService) *JWKSController {
+	return &JWKSController{
+		jwtKeyService: jwtKeyService,
+	}
+}
+
+// GetJWKS 发布当前与上一个签名公钥（JWK Set）
+func (ctrl *JWKSController) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": ctrl.jwtKeyService.JWKS()})
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"im-system/server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyBackupController 私钥备份控制器
+type KeyBackupController struct {
+	keyBackupService service.KeyBackupService
+}
+
+// NewKeyBackupController 创建私钥备份控制器实例
+func NewKeyBackupController(keyBackupService service.KeyBackupService) *KeyBackupController {
+	return &KeyBackupController{
+		keyBackupService: keyBackupService,
+	}
+}
+
+// UploadKeyBackupRequest 上传私钥备份请求
+type UploadKeyBackupRequest struct {
+	Backup string `json:"backup" binding:"required"`
+}
+
+// UploadBackup 上传（覆盖）私钥加密备份
+func (ctrl *KeyBackupController) UploadBackup(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	var req UploadKeyBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := ctrl.keyBackupService.UploadBackup(userID, req.Backup); err != nil {
+		if err == service.ErrKeyBackupTooLarge {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload key backup"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Key backup uploaded successfully"})
+}
+
+// GetBackup 下载私钥加密备份
+func (ctrl *KeyBackupController) GetBackup(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	backup, retryAfter, err := ctrl.keyBackupService.GetBackup(userID)
+	if err != nil {
+		switch err {
+		case service.ErrKeyBackupRateLimited:
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case service.ErrKeyBackupNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get key backup"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, backup)
+}
+
+// DeleteBackup 删除私钥加密备份
+func (ctrl *KeyBackupController) DeleteBackup(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	if err := ctrl.keyBackupService.DeleteBackup(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete key backup"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Key backup deleted successfully"})
+}
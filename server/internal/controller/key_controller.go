@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"im-system/server/internal/service"
+	"im-system/shared/keyencoding"
 
 	"github.com/gin-gonic/gin"
 )
@@ -29,7 +31,8 @@ type GenerateKeysResponse struct {
 
 // UploadPublicKeyRequest 上传公钥请求
 type UploadPublicKeyRequest struct {
-	PublicKey string `json:"public_key" binding:"required"`
+	PublicKey    string `json:"public_key" binding:"required"`
+	CipherSuites []int  `json:"cipher_suites"`
 }
 
 // GenerateKeys 生成密钥对
@@ -62,8 +65,12 @@ func (ctrl *KeyController) UploadPublicKey(c *gin.Context) {
 		return
 	}
 
-	if err := ctrl.keyService.UploadPublicKey(userID, req.PublicKey); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload public key"})
+	if err := ctrl.keyService.UploadPublicKey(userID, req.PublicKey, req.CipherSuites); err != nil {
+		if err == service.ErrInvalidPublicKey || err == service.ErrUnsupportedCipherSuites {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload public key"})
+		}
 		return
 	}
 
@@ -84,6 +91,34 @@ func (ctrl *KeyController) GetPublicKey(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Public key not found"})
 		return
 	}
+	cipherSuites, err := ctrl.keyService.GetCipherSuites(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cipher suites"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"public_key": publicKey})
+	// format=jwk 时额外返回 JWK 表示，public_key 保持为日志中记录的原始 PEM
+	if c.Query("format") == "jwk" {
+		key, err := keyencoding.ParsePublicKey(publicKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Stored public key is invalid"})
+			return
+		}
+		jwk, err := keyencoding.EncodePublicKeyJWK(key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode public key"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"public_key":    publicKey,
+			"cipher_suites": cipherSuites,
+			"jwk":           json.RawMessage(jwk),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"public_key":    publicKey,
+		"cipher_suites": cipherSuites,
+	})
 }
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"im-system/server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyLogController 公钥透明日志控制器
+type KeyLogController struct {
+	keyLogService service.KeyLogService
+}
+
+// NewKeyLogController 创建公钥透明日志控制器实例
+func NewKeyLogController(keyLogService service.KeyLogService) *KeyLogController {
+	return &KeyLogController{
+		keyLogService: keyLogService,
+	}
+}
+
+// GetSignedTreeHead 获取最新的签名树头
+func (ctrl *KeyLogController) GetSignedTreeHead(c *gin.Context) {
+	sth, err := ctrl.keyLogService.GetSignedTreeHead()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tree head"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sth)
+}
+
+// GetPublicKey 获取日志签名公钥
+func (ctrl *KeyLogController) GetPublicKey(c *gin.Context) {
+	publicKey, err := ctrl.keyLogService.GetPublicKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get key log public key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"public_key": publicKey})
+}
+
+// GetInclusionProof 获取用户当前公钥的包含性证明
+func (ctrl *KeyLogController) GetInclusionProof(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	treeSize, err := strconv.ParseInt(c.Query("tree_size"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tree size"})
+		return
+	}
+
+	proof, err := ctrl.keyLogService.GetInclusionProof(userID, treeSize)
+	if err != nil {
+		if err == service.ErrInvalidTreeSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Key log entry not found"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, proof)
+}
+
+// GetConsistencyProof 获取两个树头之间的一致性证明
+func (ctrl *KeyLogController) GetConsistencyProof(c *gin.Context) {
+	first, err := strconv.ParseInt(c.Query("first"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tree size"})
+		return
+	}
+	second, err := strconv.ParseInt(c.Query("second"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tree size"})
+		return
+	}
+
+	proof, err := ctrl.keyLogService.GetConsistencyProof(first, second)
+	if err != nil {
+		if err == service.ErrInvalidTreeSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build consistency proof"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, proof)
+}
@@ -25,6 +25,8 @@ func NewMessageController(messageService service.MessageService) *MessageControl
 type SendMessageRequest struct {
 	ReceiverID int    `json:"receiver_id" binding:"required"`
 	Content    string `json:"content" binding:"required"`
+	// ClientMessageID 可选的客户端消息ID（UUID），重试时返回已有消息
+	ClientMessageID string `json:"client_message_id"`
 }
 
 // SendMessage 发送消息
@@ -37,16 +39,29 @@ func (ctrl *MessageController) SendMessage(c *gin.Context) {
 		return
 	}
 
-	messageID, err := ctrl.messageService.SendMessage(userID, req.ReceiverID, req.Content)
+	messageID, err := ctrl.messageService.SendMessage(userID, req.ReceiverID, req.Content, req.ClientMessageID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		switch err {
+		case service.ErrInvalidClientMessageID:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case service.ErrMessageBlocked, service.ErrContactsOnly:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case service.ErrClientMessageIDReused:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"message_id": messageID,
 		"status":     "sent",
-	})
+	}
+	if req.ClientMessageID != "" {
+		resp["client_message_id"] = req.ClientMessageID
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // GetUnreadMessages 获取未读消息
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"net/http"
+
+	"im-system/server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SealedSenderController 密封发送控制器
+type SealedSenderController struct {
+	sealedSenderService service.SealedSenderService
+}
+
+// NewSealedSenderController 创建密封发送控制器实例
+func NewSealedSenderController(sealedSenderService service.SealedSenderService) *SealedSenderController {
+	return &SealedSenderController{
+		sealedSenderService: sealedSenderService,
+	}
+}
+
+// SetDeliveryTokenRequest 设置投递令牌请求
+type SetDeliveryTokenRequest struct {
+	DeliveryToken string `json:"delivery_token" binding:"required"`
+}
+
+// SendSealedMessageRequest 发送密封消息请求（无需认证）
+type SendSealedMessageRequest struct {
+	ReceiverID    int    `json:"receiver_id" binding:"required"`
+	DeliveryToken string `json:"delivery_token" binding:"required"`
+	Content       string `json:"content" binding:"required"`
+}
+
+// SetDeliveryToken 设置（轮换）当前用户的投递令牌
+func (ctrl *SealedSenderController) SetDeliveryToken(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	var req SetDeliveryTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := ctrl.sealedSenderService.SetDeliveryToken(userID, req.DeliveryToken); err != nil {
+		if err == service.ErrInvalidDeliveryToken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set delivery token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery token updated"})
+}
+
+// GetCertificate 为当前用户签发发送方证书
+func (ctrl *SealedSenderController) GetCertificate(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	certificate, err := ctrl.sealedSenderService.IssueCertificate(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to issue sender certificate, upload a public key first"})
+		return
+	}
+
+	c.JSON(http.StatusOK, certificate)
+}
+
+// GetPublicKey 获取发送方证书的签名公钥
+func (ctrl *SealedSenderController) GetPublicKey(c *gin.Context) {
+	publicKey, err := ctrl.sealedSenderService.GetPublicKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sealed sender public key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"public_key": publicKey})
+}
+
+// SendSealedMessage 凭接收方投递令牌发送密封消息，服务端不知道发送方；接收方在线时由发件箱推送
+func (ctrl *SealedSenderController) SendSealedMessage(c *gin.Context) {
+	var req SendSealedMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	messageID, err := ctrl.sealedSenderService.SendSealed(req.ReceiverID, req.DeliveryToken, req.Content, c.ClientIP())
+	if err != nil {
+		switch err {
+		case service.ErrDeliveryUnauthorized:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case service.ErrContactsOnly:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case service.ErrSealedRateLimited:
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message_id": messageID,
+		"status":     "sent",
+	})
+}
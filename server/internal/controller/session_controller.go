@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"net/http"
+
+	"im-system/server/internal/model"
+	"im-system/server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionController 会话（设备）管理控制器
+type SessionController struct {
+	sessionService service.SessionService
+}
+
+// NewSessionController 创建会话管理控制器实例
+func NewSessionController(sessionService service.SessionService) *SessionController {
+	return &SessionController{
+		sessionService: sessionService,
+	}
+}
+
+// ListSessions 列出当前用户已登录的设备
+func (ctrl *SessionController) ListSessions(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	claims, ok := getClaimsFromContext(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := ctrl.sessionService.ListSessions(userID, claims.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+	if sessions == nil {
+		sessions = []model.Session{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession 远程退出指定设备
+func (ctrl *SessionController) RevokeSession(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	if err := ctrl.sessionService.RevokeSession(userID, c.Param("id")); err != nil {
+		if err == service.ErrSessionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeOtherSessions 退出除当前设备外的所有设备
+func (ctrl *SessionController) RevokeOtherSessions(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+	claims, ok := getClaimsFromContext(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := ctrl.sessionService.RevokeOtherSessions(userID, claims.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"im-system/server/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorController 两步验证控制器
+type TwoFactorController struct {
+	twoFactorService service.TwoFactorService
+}
+
+// NewTwoFactorController 创建两步验证控制器实例
+func NewTwoFactorController(twoFactorService service.TwoFactorService) *TwoFactorController {
+	return &TwoFactorController{
+		twoFactorService: twoFactorService,
+	}
+}
+
+// TwoFactorCodeRequest 携带验证码（或恢复码）的请求
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorVerifyRequest 两步验证登录请求
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+	DeviceName     string `json:"device_name"`
+	DeviceIP       string `json:"device_ip"`
+}
+
+// GetStatus 获取两步验证状态
+func (ctrl *TwoFactorController) GetStatus(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	enabled, remaining, err := ctrl.twoFactorService.Status(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get two-factor status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  enabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// Setup 生成两步验证密钥，需调用 Activate 校验第一个验证码后才生效
+func (ctrl *TwoFactorController) Setup(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	setup, err := ctrl.twoFactorService.Setup(userID)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// Activate 校验第一个验证码并开启两步验证
+func (ctrl *TwoFactorController) Activate(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	codes, err := ctrl.twoFactorService.Activate(userID, req.Code)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Disable 关闭两步验证
+func (ctrl *TwoFactorController) Disable(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := ctrl.twoFactorService.Disable(userID, req.Code); err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码
+func (ctrl *TwoFactorController) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := getUserIDFromContext(c)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	codes, err := ctrl.twoFactorService.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		ctrl.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Verify 使用挑战令牌与验证码完成登录
+func (ctrl *TwoFactorController) Verify(c *gin.Context) {
+	var req TwoFactorVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	result, retryAfter, err := ctrl.twoFactorService.CompleteLogin(req.ChallengeToken, req.Code, deviceInfo(c, req.DeviceName, req.DeviceIP))
+	if err != nil {
+		if err == service.ErrTwoFactorRateLimited {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		}
+		ctrl.handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, newAuthResponse(result))
+}
+
+func (ctrl *TwoFactorController) handleError(c *gin.Context, err error) {
+	switch err {
+	case service.ErrInvalidTwoFactorCode, service.ErrInvalidChallenge:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case service.ErrTwoFactorAlreadyEnabled:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case service.ErrTwoFactorNotSetUp, service.ErrTwoFactorNotEnabled:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case service.ErrTwoFactorRateLimited:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Two-factor operation failed"})
+	}
+}
@@ -2,7 +2,9 @@ package controller
 
 import (
 	"net/http"
+	"strconv"
 
+	"im-system/server/internal/model"
 	"im-system/server/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -10,35 +12,125 @@ import (
 
 // UserController 用户控制器
 type UserController struct {
-	userService service.UserService
-	wsService   service.WebSocketService
+	profileService service.ProfileService
+	contactService service.ContactService
 }
 
 // NewUserController 创建用户控制器实例
-func NewUserController(userService service.UserService, wsService service.WebSocketService) *UserController {
+func NewUserController(profileService service.ProfileService, contactService service.ContactService) *UserController {
 	return &UserController{
-		userService: userService,
-		wsService:   wsService,
+		profileService: profileService,
+		contactService: contactService,
 	}
 }
 
-// GetAllUsers 获取所有用户
-func (ctrl *UserController) GetAllUsers(c *gin.Context) {
-	currentUserID := getUserIDFromContext(c)
+// GetOnlineUsers 获取在线的联系人
+func (ctrl *UserController) GetOnlineUsers(c *gin.Context) {
+	users, err := ctrl.contactService.OnlineContacts(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch online users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"online_users": users})
+}
 
-	users, err := ctrl.userService.GetAllUsers(currentUserID)
+// GetMe 获取当前用户的资料
+func (ctrl *UserController) GetMe(c *gin.Context) {
+	profile, err := ctrl.profileService.GetProfile(getUserIDFromContext(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	c.JSON(http.StatusOK, profile)
 }
 
-// GetOnlineUsers 获取在线用户
-func (ctrl *UserController) GetOnlineUsers(c *gin.Context) {
-	users := ctrl.wsService.GetOnlineUsers()
-	c.JSON(http.StatusOK, gin.H{"online_users": users})
+// UpdateMe 修改当前用户的资料，只修改请求中出现的字段
+func (ctrl *UserController) UpdateMe(c *gin.Context) {
+	var req model.ProfileUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	profile, err := ctrl.profileService.UpdateProfile(getUserIDFromContext(c), &req)
+	if err != nil {
+		if _, ok := err.(*service.ProfileError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// GetUser 获取指定用户的资料
+func (ctrl *UserController) GetUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	profile, err := ctrl.profileService.GetProfile(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// SearchUsers 按用户名或显示名称搜索用户，支持游标分页
+func (ctrl *UserController) SearchUsers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	page, err := ctrl.profileService.SearchUsers(getUserIDFromContext(c), c.Query("q"), c.Query("cursor"), limit)
+	if err != nil {
+		if _, ok := err.(*service.ProfileError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetPrivacy 获取当前用户的隐私设置
+func (ctrl *UserController) GetPrivacy(c *gin.Context) {
+	privacy, err := ctrl.profileService.GetPrivacy(getUserIDFromContext(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch privacy settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, privacy)
+}
+
+// UpdatePrivacy 修改隐私设置（谁可以发消息、是否可被搜索），只修改请求中出现的字段
+func (ctrl *UserController) UpdatePrivacy(c *gin.Context) {
+	var req model.PrivacyUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	privacy, err := ctrl.profileService.UpdatePrivacy(getUserIDFromContext(c), &req)
+	if err != nil {
+		if _, ok := err.(*service.ProfileError); ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update privacy settings"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, privacy)
 }
 
 // 辅助函数：从上下文获取用户ID
@@ -47,6 +139,16 @@ func getUserIDFromContext(c *gin.Context) int {
 	return userID.(int)
 }
 
+// 辅助函数：从上下文获取令牌声明，缺失时返回 401
+func getClaimsFromContext(c *gin.Context) (*service.Claims, bool) {
+	value, _ := c.Get("claims")
+	claims, ok := value.(*service.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	}
+	return claims, ok
+}
+
 // 辅助函数：从上下文获取用户名
 func getUsernameFromContext(c *gin.Context) string {
 	username, _ := c.Get("username")
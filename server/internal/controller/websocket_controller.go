@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"im-system/server/internal/service"
+	"im-system/server/internal/wire"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -24,6 +25,8 @@ func NewWebSocketController(wsService service.WebSocketService) *WebSocketContro
 			CheckOrigin: func(r *http.Request) bool {
 				return true // 允许跨域
 			},
+			// 客户端可协商 Protobuf 编码，未协商时使用 JSON
+			Subprotocols: wire.Subprotocols,
 		},
 	}
 }
@@ -32,6 +35,10 @@ func NewWebSocketController(wsService service.WebSocketService) *WebSocketContro
 func (ctrl *WebSocketController) HandleWebSocket(c *gin.Context) {
 	userID := getUserIDFromContext(c)
 	username := getUsernameFromContext(c)
+	claims, ok := getClaimsFromContext(c)
+	if !ok {
+		return
+	}
 
 	conn, err := ctrl.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -39,9 +46,15 @@ func (ctrl *WebSocketController) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
-	client := ctrl.wsService.RegisterClient(userID, username, conn)
+	client, err := ctrl.wsService.RegisterClient(userID, username, claims.SessionID, conn)
+	if err != nil {
+		// 服务端正在关闭，客户端收到 going away 后重新连接
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, err.Error()))
+		conn.Close()
+		return
+	}
 	defer func() {
-		ctrl.wsService.UnregisterClient(userID)
+		ctrl.wsService.UnregisterClient(client)
 		conn.Close()
 	}()
 
@@ -33,6 +33,7 @@ func AuthMiddleware(userService service.UserService) gin.HandlerFunc {
 
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
@@ -68,6 +69,7 @@ func WSAuthMiddleware(userService service.UserService) gin.HandlerFunc {
 
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"im-system/server/pkg/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRateLimitBody 读取请求体解析用户名时的大小上限
+const maxRateLimitBody = 64 << 10
+
+// RateLimitMiddleware 按客户端 IP 与请求体中的用户名分别限流，任一超限即返回 429
+func RateLimitMiddleware(limiter ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// ClientIP 为连接的对端地址，只有经过 TRUSTED_PROXIES 中的代理时才取 X-Forwarded-For，客户端无法伪造
+		keys := []string{"ip:" + c.ClientIP()}
+		if username := usernameFromBody(c); username != "" {
+			keys = append(keys, "user:"+username)
+		}
+
+		for _, key := range keys {
+			if ok, wait := limiter.Allow(key); !ok {
+				abortRateLimited(c, wait)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// usernameFromBody 解析 JSON 请求体中的用户名，并还原请求体供后续处理
+func usernameFromBody(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRateLimitBody))
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return req.Username
+}
+
+func abortRateLimited(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later"})
+	c.Abort()
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// AccountExport 用户数据导出归档，消息保持加密状态
+type AccountExport struct {
+	ExportedAt       time.Time      `json:"exported_at"`
+	Profile          *User          `json:"profile"`
+	PublicKey        *PublicKeyInfo `json:"public_key,omitempty"`
+	KeyBackup        *KeyBackup     `json:"key_backup,omitempty"`
+	TwoFactorEnabled bool           `json:"two_factor_enabled"`
+	Sessions         []Session      `json:"sessions"`
+	Messages         []MessageDTO   `json:"messages"`
+}
+
+// PublicKeyInfo 用户公钥及公布的加密套件
+type PublicKeyInfo struct {
+	PublicKey    string `json:"public_key"`
+	CipherSuites []int  `json:"cipher_suites"`
+}
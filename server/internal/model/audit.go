@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// 审计事件类型
+const (
+	AuditLoginLocked = "login_locked"
+)
+
+// AuditEvent 安全相关的审计事件
+type AuditEvent struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"user_id,omitempty"` // 用户名不存在时为空
+	Username  string    `json:"username"`
+	Event     string    `json:"event"`
+	IPAddress string    `json:"ip_address"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
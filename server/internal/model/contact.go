@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// ContactRequest 待处理的好友请求
+type ContactRequest struct {
+	ID         int             `json:"id"`
+	FromUserID int             `json:"from_user_id"`
+	ToUserID   int             `json:"to_user_id"`
+	User       *UserPublicInfo `json:"user,omitempty"` // 请求的另一方
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// ContactRequests 收到的与发出的好友请求
+type ContactRequests struct {
+	Incoming []ContactRequest `json:"incoming"`
+	Outgoing []ContactRequest `json:"outgoing"`
+}
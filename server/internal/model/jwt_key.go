@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// JWTKey 访问令牌签名密钥，按 kid 区分，定期轮换；PrivateKey 为加密后的私钥
+type JWTKey struct {
+	KID        string    `json:"kid"`
+	Algorithm  string    `json:"algorithm"`
+	PrivateKey string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// KeyBackup 用户私钥的加密备份（服务端只保存密文）
+type KeyBackup struct {
+	UserID    int       `json:"user_id"`
+	Backup    string    `json:"backup"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// KeyLogEntry 公钥透明日志条目
+type KeyLogEntry struct {
+	LeafIndex int64     `json:"leaf_index"`
+	UserID    int       `json:"user_id"`
+	PublicKey string    `json:"public_key"`
+	LeafHash  []byte    `json:"leaf_hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SignedTreeHead 签名树头
+type SignedTreeHead struct {
+	TreeSize  int64  `json:"tree_size"`
+	Timestamp int64  `json:"timestamp"`
+	RootHash  []byte `json:"root_hash"`
+	Signature []byte `json:"signature"`
+}
+
+// InclusionProof 用户当前公钥的包含性证明
+type InclusionProof struct {
+	LeafIndex int64    `json:"leaf_index"`
+	TreeSize  int64    `json:"tree_size"`
+	UserID    int      `json:"user_id"`
+	PublicKey string   `json:"public_key"`
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+// ConsistencyProof 两个树头之间的一致性证明
+type ConsistencyProof struct {
+	First  int64    `json:"first"`
+	Second int64    `json:"second"`
+	Proof  [][]byte `json:"proof"`
+}
@@ -8,6 +8,8 @@ type Message struct {
 	SenderID         int       `json:"sender_id"`
 	ReceiverID       int       `json:"receiver_id"`
 	EncryptedContent string    `json:"encrypted_content"`
+	Sealed           bool      `json:"sealed"` // 密封发送的消息不记录发送方，SenderID 为 0
+	ClientMessageID  string    `json:"client_message_id,omitempty"`
 	IsRead           bool      `json:"is_read"`
 	CreatedAt        time.Time `json:"created_at"`
 }
@@ -18,6 +20,35 @@ type MessageDTO struct {
 	SenderID         int    `json:"sender_id"`
 	ReceiverID       int    `json:"receiver_id"`
 	EncryptedContent string `json:"encrypted_content"`
+	Sealed           bool   `json:"sealed,omitempty"`
+	ClientMessageID  string `json:"client_message_id,omitempty"`
 	IsRead           bool   `json:"is_read"`
 	CreatedAt        string `json:"created_at"`
 }
+
+// QueuedMessage 已通过校验、等待写入数据库并投递的消息
+type QueuedMessage struct {
+	SenderID        int    `json:"sender_id"`
+	ReceiverID      int    `json:"receiver_id"`
+	Content         string `json:"content"`
+	ClientMessageID string `json:"client_message_id,omitempty"`
+}
+
+// 发件箱事件类型，与推送的 WebSocket 消息类型一致
+const (
+	// OutboxEventMessage 推送消息给接收方
+	OutboxEventMessage = "message"
+	// OutboxEventSealedMessage 推送密封消息给接收方
+	OutboxEventSealedMessage = "sealed_message"
+	// OutboxEventMessageSent 推送发送确认给发送方的所有设备
+	OutboxEventMessageSent = "message_sent"
+)
+
+// OutboxEvent 与消息在同一事务中写入的待推送事件
+type OutboxEvent struct {
+	ID       int64
+	UserID   int // 推送对象
+	Type     string
+	Attempts int // 包括本次在内的推送次数
+	Message  Message
+}
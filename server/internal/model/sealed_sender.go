@@ -0,0 +1,15 @@
+package model
+
+// SenderCertificateData 发送方证书内容，由服务端签名后交给发送方放入密封信封
+type SenderCertificateData struct {
+	SenderID  int    `json:"sender_id"`
+	Username  string `json:"username"`
+	PublicKey string `json:"public_key"`
+	Expires   int64  `json:"expires"` // 毫秒时间戳
+}
+
+// SenderCertificate 带服务端签名的发送方证书
+type SenderCertificate struct {
+	Certificate []byte `json:"certificate"` // SenderCertificateData 的 JSON 编码
+	Signature   []byte `json:"signature"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// Session 登录会话，每次刷新轮换刷新令牌（服务端只保存哈希）
+type Session struct {
+	ID                string     `json:"id"`
+	UserID            int        `json:"user_id"`
+	DeviceName        string     `json:"device_name"`
+	UserAgent         string     `json:"user_agent"`
+	IPAddress         string     `json:"ip_address"`
+	RefreshTokenHash  []byte     `json:"-"`
+	PreviousTokenHash []byte     `json:"-"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	Current           bool       `json:"current"` // 是否为发起请求的会话
+}
+
+// DeviceInfo 登录设备信息，记录在会话中
+type DeviceInfo struct {
+	Name      string
+	UserAgent string
+	IPAddress string
+}
+
+// TokenPair 访问令牌与刷新令牌
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // 访问令牌有效期（秒）
+}
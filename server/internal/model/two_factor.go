@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// TwoFactor 用户的 TOTP 两步验证配置
+type TwoFactor struct {
+	UserID       int
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64 // 最近一次使用的时间步，防止验证码重放
+	CreatedAt    time.Time
+}
+
+// TwoFactorSetup 开启两步验证时返回给用户的密钥
+type TwoFactorSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// LoginResult 登录结果：未开启两步验证时直接签发令牌，否则返回挑战令牌
+type LoginResult struct {
+	UserID             int
+	Username           string
+	Tokens             *TokenPair
+	ChallengeToken     string
+	ChallengeExpiresIn int
+}
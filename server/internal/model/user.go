@@ -4,14 +4,60 @@ import "time"
 
 // User 用户模型
 type User struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"-"` // 不在JSON中显示
-	CreatedAt time.Time `json:"created_at"`
+	ID            int       `json:"id"`
+	Username      string    `json:"username"`
+	Password      string    `json:"-"` // 不在JSON中显示
+	DisplayName   string    `json:"display_name"`
+	Bio           string    `json:"bio"`
+	StatusMessage string    `json:"status_message"`
+	AvatarRef     string    `json:"avatar_ref"` // 头像的 blob 引用（https URL 或存储ID）
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 // UserPublicInfo 用户公开信息
 type UserPublicInfo struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	DisplayName   string `json:"display_name"`
+	Bio           string `json:"bio"`
+	StatusMessage string `json:"status_message"`
+	AvatarRef     string `json:"avatar_ref"`
+}
+
+// ProfileUpdate 资料修改请求，为 nil 的字段保持不变
+type ProfileUpdate struct {
+	DisplayName   *string `json:"display_name"`
+	Bio           *string `json:"bio"`
+	StatusMessage *string `json:"status_message"`
+	AvatarRef     *string `json:"avatar_ref"`
+}
+
+// 消息隐私设置：谁可以给我发消息
+const (
+	MessagePrivacyEveryone = "everyone"
+	MessagePrivacyContacts = "contacts"
+)
+
+// PrivacySettings 隐私设置
+type PrivacySettings struct {
+	MessagePrivacy string `json:"message_privacy"`
+	Discoverable   bool   `json:"discoverable"` // 是否出现在用户搜索结果中
+}
+
+// PrivacyUpdate 隐私设置修改请求，为 nil 的字段保持不变
+type PrivacyUpdate struct {
+	MessagePrivacy *string `json:"message_privacy"`
+	Discoverable   *bool   `json:"discoverable"`
+}
+
+// UserSearchCursor 用户搜索的分页位置：匹配程度与用户名
+type UserSearchCursor struct {
+	Rank     int
+	Username string
+}
+
+// UserSearchPage 一页用户搜索结果，NextCursor 为空表示没有更多结果
+type UserSearchPage struct {
+	Users      []UserPublicInfo `json:"users"`
+	NextCursor string           `json:"next_cursor,omitempty"`
 }
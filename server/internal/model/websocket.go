@@ -8,11 +8,33 @@ type WSMessage struct {
 	Content    string `json:"content,omitempty"`
 	MessageID  int    `json:"message_id,omitempty"`
 	Timestamp  string `json:"timestamp,omitempty"`
+	// ClientMessageID 客户端生成的消息ID（UUID），重复发送时服务端返回已有消息，message_sent 确认原样带回
+	ClientMessageID string `json:"client_message_id,omitempty"`
+	// EventID 发件箱事件的幂等键（事件类型与发件箱记录ID），同一事件重复推送时不变，客户端据此去重
+	EventID string `json:"event_id,omitempty"`
+	// Profile profile_updated、contact_request、contact_added 事件携带的用户资料
+	Profile *UserPublicInfo `json:"profile,omitempty"`
 }
 
 // WSClient WebSocket 客户端
 type WSClient struct {
-	UserID   int
-	Username string
-	Send     chan interface{}
+	UserID    int
+	Username  string
+	SessionID string // 连接所用访问令牌的会话，会话吊销时断开连接
+	Send      chan WSMessage
+	// CloseCode 关闭发送通道前设置时，关闭帧带上该状态码与原因（如服务端关闭时的 1001 going away）
+	CloseCode   int
+	CloseReason string
+}
+
+// WSStats 本节点 WebSocket 推送队列的统计
+type WSStats struct {
+	Connections int `json:"connections"`
+	// QueuedMessages 所有连接发送队列中等待写出的消息总数，MaxQueueDepth 为最长的队列
+	QueuedMessages int `json:"queued_messages"`
+	MaxQueueDepth  int `json:"max_queue_depth"`
+	// DroppedMessages 因发送队列已满而未推送的消息数（消息仍保存在数据库中）
+	DroppedMessages int64 `json:"dropped_messages"`
+	// SlowConsumersDisconnected 因发送队列已满被断开的连接数
+	SlowConsumersDisconnected int64 `json:"slow_consumers_disconnected"`
 }
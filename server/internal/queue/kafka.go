@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	// kafkaMaxPollRecords 每次拉取的记录数上限
+	kafkaMaxPollRecords = 500
+	// kafkaCommitTimeout 提交消费位移的超时
+	kafkaCommitTimeout = 5 * time.Second
+)
+
+// kafkaQueue 基于 Kafka topic 的队列：记录按 key 哈希到分区，
+// 同一消费组内的实例分担分区，每个分区同一时间只由一个实例顺序消费
+type kafkaQueue struct {
+	client *kgo.Client
+}
+
+// NewKafkaQueue 创建 Kafka 队列，buffer 为生产者积压未确认记录的上限
+func NewKafkaQueue(brokers []string, topic, group string, buffer int) (Queue, error) {
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.DefaultProduceTopic(topic),
+		kgo.AllowAutoTopicCreation(),
+		kgo.MaxBufferedRecords(buffer),
+		kgo.ConsumerGroup(group),
+		kgo.ConsumeTopics(topic),
+		// 处理完成后才提交位移，处理期间不进行再均衡，避免分区被其他实例重复处理
+		kgo.DisableAutoCommit(),
+		kgo.BlockRebalanceOnPoll(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &kafkaQueue{client: client}, nil
+}
+
+func (q *kafkaQueue) Produce(ctx context.Context, key string, value []byte) error {
+	return q.client.ProduceSync(ctx, &kgo.Record{Key: []byte(key), Value: value}).FirstErr()
+}
+
+func (q *kafkaQueue) Consume(ctx context.Context, handler func(ctx context.Context, record *Record)) error {
+	for {
+		fetches := q.client.PollRecords(ctx, kafkaMaxPollRecords)
+		if fetches.IsClientClosed() {
+			return ErrQueueClosed
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			log.Printf("Failed to fetch from Kafka %s[%d]: %v", topic, partition, err)
+		})
+
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			processed []*kgo.Record
+		)
+		fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+			if len(p.Records) == 0 {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var last *kgo.Record
+				for _, r := range p.Records {
+					handler(ctx, &Record{Key: string(r.Key), Value: r.Value})
+					// ctx 结束时正在处理的记录可能未完成，不提交，重启后重新投递
+					if ctx.Err() != nil {
+						break
+					}
+					last = r
+				}
+				if last != nil {
+					mu.Lock()
+					processed = append(processed, last)
+					mu.Unlock()
+				}
+			}()
+		})
+		wg.Wait()
+
+		if len(processed) > 0 {
+			commitCtx, cancel := context.WithTimeout(context.Background(), kafkaCommitTimeout)
+			if err := q.client.CommitRecords(commitCtx, processed...); err != nil {
+				log.Printf("Failed to commit Kafka offsets: %v", err)
+			}
+			cancel()
+		}
+		q.client.AllowRebalance()
+	}
+}
+
+func (q *kafkaQueue) Close() error {
+	q.client.Close()
+	return nil
+}
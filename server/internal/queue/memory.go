@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+// memoryQueue 进程内队列，每个分区是一个有界通道，由一个协程顺序消费；
+// 用于单实例部署与测试，进程退出时未消费的记录丢失
+type memoryQueue struct {
+	partitions []chan *Record
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+// NewMemoryQueue 创建进程内队列，buffer 为每个分区积压记录的上限
+func NewMemoryQueue(partitions, buffer int) Queue {
+	q := &memoryQueue{
+		partitions: make([]chan *Record, partitions),
+		closed:     make(chan struct{}),
+	}
+	for i := range q.partitions {
+		q.partitions[i] = make(chan *Record, buffer)
+	}
+	return q
+}
+
+func (q *memoryQueue) Produce(ctx context.Context, key string, value []byte) error {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	partition := q.partitions[h.Sum32()%uint32(len(q.partitions))]
+
+	select {
+	case partition <- &Record{Key: key, Value: value}:
+		return nil
+	case <-q.closed:
+		return ErrQueueClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Consume 进程内的记录不会重新投递，因此处理记录不随 ctx 取消；
+// ctx 结束后先处理完分区中已积压的记录再返回，保证优雅关闭时不丢消息
+func (q *memoryQueue) Consume(ctx context.Context, handler func(ctx context.Context, record *Record)) error {
+	handlerCtx := context.WithoutCancel(ctx)
+
+	var wg sync.WaitGroup
+	for _, partition := range q.partitions {
+		wg.Add(1)
+		go func(partition chan *Record) {
+			defer wg.Done()
+			for {
+				select {
+				case record := <-partition:
+					handler(handlerCtx, record)
+				case <-q.closed:
+					return
+				case <-ctx.Done():
+					q.drain(handlerCtx, partition, handler)
+					return
+				}
+			}
+		}(partition)
+	}
+	wg.Wait()
+	return nil
+}
+
+// drain 处理分区中剩余的记录
+func (q *memoryQueue) drain(ctx context.Context, partition chan *Record, handler func(ctx context.Context, record *Record)) {
+	for {
+		select {
+		case record := <-partition:
+			handler(ctx, record)
+		default:
+			return
+		}
+	}
+}
+
+func (q *memoryQueue) Close() error {
+	q.closeOnce.Do(func() { close(q.closed) })
+	return nil
+}
@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryQueueOrdering(t *testing.T) {
+	tests := []struct {
+		name       string
+		partitions int
+		keys       int
+		perKey     int
+	}{
+		{"single partition", 1, 3, 50},
+		{"more keys than partitions", 4, 16, 50},
+		{"more partitions than keys", 16, 2, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewMemoryQueue(tt.partitions, tt.keys*tt.perKey)
+			ctx := context.Background()
+
+			// 交替写入各 key 的记录
+			for i := 0; i < tt.perKey; i++ {
+				for k := 0; k < tt.keys; k++ {
+					if err := q.Produce(ctx, fmt.Sprint("key-", k), []byte(fmt.Sprint(i))); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			var mu sync.Mutex
+			got := make(map[string][]string)
+			total := 0
+			consumeCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error, 1)
+			go func() {
+				done <- q.Consume(consumeCtx, func(ctx context.Context, record *Record) {
+					mu.Lock()
+					got[record.Key] = append(got[record.Key], string(record.Value))
+					total++
+					if total == tt.keys*tt.perKey {
+						cancel()
+					}
+					mu.Unlock()
+				})
+			}()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("records not consumed")
+			}
+
+			want := make([]string, tt.perKey)
+			for i := range want {
+				want[i] = fmt.Sprint(i)
+			}
+			for k := 0; k < tt.keys; k++ {
+				key := fmt.Sprint("key-", k)
+				if !reflect.DeepEqual(got[key], want) {
+					t.Errorf("%s consumed %v, want %v", key, got[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryQueueDrainsOnShutdown(t *testing.T) {
+	q := NewMemoryQueue(2, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < 5; i++ {
+		if err := q.Produce(ctx, "key", []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// ctx 已结束时仍处理完积压的记录，且处理记录的 ctx 不随之取消
+	cancel()
+	var consumed []string
+	err := q.Consume(ctx, func(ctx context.Context, record *Record) {
+		if ctx.Err() != nil {
+			t.Errorf("handler ctx cancelled: %v", ctx.Err())
+		}
+		consumed = append(consumed, string(record.Value))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0", "1", "2", "3", "4"}; !reflect.DeepEqual(consumed, want) {
+		t.Errorf("consumed %v, want %v", consumed, want)
+	}
+}
+
+func TestMemoryQueueProduce(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(q Queue) context.Context
+		wantErr error
+	}{
+		{
+			name: "blocks until ctx ends when full",
+			setup: func(q Queue) context.Context {
+				q.Produce(context.Background(), "key", nil)
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				t.Cleanup(cancel)
+				return ctx
+			},
+			wantErr: context.DeadlineExceeded,
+		},
+		{
+			name: "closed queue",
+			setup: func(q Queue) context.Context {
+				q.Produce(context.Background(), "key", nil)
+				q.Close()
+				return context.Background()
+			},
+			wantErr: ErrQueueClosed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewMemoryQueue(1, 1)
+			ctx := tt.setup(q)
+			if err := q.Produce(ctx, "key", nil); err != tt.wantErr {
+				t.Errorf("Produce = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package queue
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrQueueClosed 队列已关闭
+var ErrQueueClosed = errors.New("message queue closed")
+
+// Record 队列中的一条记录
+type Record struct {
+	// Key 分区键，相同 key 的记录进入同一分区并按写入顺序消费
+	Key   string
+	Value []byte
+}
+
+// Queue 按分区有序的持久化队列，用于将消息接收与持久化解耦
+type Queue interface {
+	// Produce 追加一条记录；队列积压到上限时阻塞，直到有空间或 ctx 结束
+	Produce(ctx context.Context, key string, value []byte) error
+	// Consume 消费记录直到 ctx 结束：不同分区并行处理，同一分区的记录按顺序交给 handler，
+	// handler 返回后记录才算已消费（至少一次）
+	Consume(ctx context.Context, handler func(ctx context.Context, record *Record)) error
+	Close() error
+}
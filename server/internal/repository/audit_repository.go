@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"database/sql"
+
+	"im-system/server/internal/model"
+)
+
+// AuditRepository 审计事件数据访问接口
+type AuditRepository interface {
+	Record(event *model.AuditEvent) error
+}
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+// NewAuditRepository 创建审计事件仓库实例
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Record(event *model.AuditEvent) error {
+	_, err := r.db.Exec(
+		`INSERT INTO audit_events (user_id, username, event, ip_address, detail)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		event.UserID, event.Username, event.Event, event.IPAddress, event.Detail,
+	)
+	return err
+}
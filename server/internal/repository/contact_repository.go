@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"im-system/server/internal/model"
+)
+
+// ContactRepository 联系人、好友请求与黑名单数据访问接口
+type ContactRepository interface {
+	ListContacts(userID int) ([]model.User, error)
+	ContactIDs(userID int) ([]int, error)
+	IsContact(userID, contactID int) (bool, error)
+	// AddContact 双向添加联系人，并删除两人之间的好友请求
+	AddContact(userID, contactID int) error
+	RemoveContact(userID, contactID int) error
+
+	// CreateRequest 创建好友请求，已存在时返回原请求
+	CreateRequest(fromUserID, toUserID int) (*model.ContactRequest, error)
+	GetRequest(requestID int) (*model.ContactRequest, error)
+	// FindRequest 查找 from 发给 to 的好友请求，不存在时返回 nil
+	FindRequest(fromUserID, toUserID int) (*model.ContactRequest, error)
+	DeleteRequest(requestID int) error
+	// ListRequests 列出收到与发出的好友请求，附带另一方的公开信息
+	ListRequests(userID int) (*model.ContactRequests, error)
+
+	// Block 拉黑用户，同时解除联系人关系并删除两人之间的好友请求
+	Block(userID, blockedID int) error
+	Unblock(userID, blockedID int) error
+	ListBlocked(userID int) ([]model.User, error)
+	// IsBlocked 任一方拉黑了另一方时返回 true
+	IsBlocked(userID1, userID2 int) (bool, error)
+}
+
+// requestColumns 好友请求查询的公共列，u 为请求另一方的用户
+const requestColumns = `cr.id, cr.from_user_id, cr.to_user_id, cr.created_at,
+	u.id, u.username, u.display_name, u.bio, u.status_message, u.avatar_ref`
+
+type contactRepository struct {
+	db *sql.DB
+}
+
+// NewContactRepository 创建联系人仓库实例
+func NewContactRepository(db *sql.DB) ContactRepository {
+	return &contactRepository{db: db}
+}
+
+func (r *contactRepository) ListContacts(userID int) ([]model.User, error) {
+	return r.listUsers(
+		"SELECT "+userColumns+" FROM users WHERE id IN (SELECT contact_id FROM contacts WHERE user_id = $1) ORDER BY id",
+		userID,
+	)
+}
+
+func (r *contactRepository) ContactIDs(userID int) ([]int, error) {
+	rows, err := r.db.Query("SELECT contact_id FROM contacts WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (r *contactRepository) IsContact(userID, contactID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM contacts WHERE user_id = $1 AND contact_id = $2)",
+		userID, contactID,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (r *contactRepository) AddContact(userID, contactID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO contacts (user_id, contact_id) VALUES ($1, $2), ($2, $1)
+		 ON CONFLICT DO NOTHING`,
+		userID, contactID,
+	); err != nil {
+		return err
+	}
+	if err := deleteRequestsBetween(tx, userID, contactID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *contactRepository) RemoveContact(userID, contactID int) error {
+	_, err := r.db.Exec(
+		"DELETE FROM contacts WHERE (user_id = $1 AND contact_id = $2) OR (user_id = $2 AND contact_id = $1)",
+		userID, contactID,
+	)
+	return err
+}
+
+func (r *contactRepository) CreateRequest(fromUserID, toUserID int) (*model.ContactRequest, error) {
+	request := &model.ContactRequest{FromUserID: fromUserID, ToUserID: toUserID}
+	err := r.db.QueryRow(
+		`INSERT INTO contact_requests (from_user_id, to_user_id) VALUES ($1, $2)
+		 ON CONFLICT (from_user_id, to_user_id) DO UPDATE SET created_at = contact_requests.created_at
+		 RETURNING id, created_at`,
+		fromUserID, toUserID,
+	).Scan(&request.ID, &request.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func (r *contactRepository) GetRequest(requestID int) (*model.ContactRequest, error) {
+	request := &model.ContactRequest{}
+	err := r.db.QueryRow(
+		"SELECT id, from_user_id, to_user_id, created_at FROM contact_requests WHERE id = $1",
+		requestID,
+	).Scan(&request.ID, &request.FromUserID, &request.ToUserID, &request.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("contact request not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+func (r *contactRepository) FindRequest(fromUserID, toUserID int) (*model.ContactRequest, error) {
+	request := &model.ContactRequest{}
+	err := r.db.QueryRow(
+		"SELECT id, from_user_id, to_user_id, created_at FROM contact_requests WHERE from_user_id = $1 AND to_user_id = $2",
+		fromUserID, toUserID,
+	).Scan(&request.ID, &request.FromUserID, &request.ToUserID, &request.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+func (r *contactRepository) DeleteRequest(requestID int) error {
+	_, err := r.db.Exec("DELETE FROM contact_requests WHERE id = $1", requestID)
+	return err
+}
+
+func (r *contactRepository) ListRequests(userID int) (*model.ContactRequests, error) {
+	incoming, err := r.listRequests(
+		"SELECT "+requestColumns+" FROM contact_requests cr JOIN users u ON u.id = cr.from_user_id WHERE cr.to_user_id = $1 ORDER BY cr.created_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	outgoing, err := r.listRequests(
+		"SELECT "+requestColumns+" FROM contact_requests cr JOIN users u ON u.id = cr.to_user_id WHERE cr.from_user_id = $1 ORDER BY cr.created_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ContactRequests{Incoming: incoming, Outgoing: outgoing}, nil
+}
+
+func (r *contactRepository) Block(userID, blockedID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"INSERT INTO blocks (user_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		userID, blockedID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		"DELETE FROM contacts WHERE (user_id = $1 AND contact_id = $2) OR (user_id = $2 AND contact_id = $1)",
+		userID, blockedID,
+	); err != nil {
+		return err
+	}
+	if err := deleteRequestsBetween(tx, userID, blockedID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *contactRepository) Unblock(userID, blockedID int) error {
+	_, err := r.db.Exec("DELETE FROM blocks WHERE user_id = $1 AND blocked_id = $2", userID, blockedID)
+	return err
+}
+
+func (r *contactRepository) ListBlocked(userID int) ([]model.User, error) {
+	return r.listUsers(
+		"SELECT "+userColumns+" FROM users WHERE id IN (SELECT blocked_id FROM blocks WHERE user_id = $1) ORDER BY id",
+		userID,
+	)
+}
+
+func (r *contactRepository) IsBlocked(userID1, userID2 int) (bool, error) {
+	var blocked bool
+	err := r.db.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM blocks
+		 WHERE (user_id = $1 AND blocked_id = $2) OR (user_id = $2 AND blocked_id = $1))`,
+		userID1, userID2,
+	).Scan(&blocked)
+	return blocked, err
+}
+
+func (r *contactRepository) listUsers(query string, args ...interface{}) ([]model.User, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *contactRepository) listRequests(query string, userID int) ([]model.ContactRequest, error) {
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []model.ContactRequest{}
+	for rows.Next() {
+		request := model.ContactRequest{User: &model.UserPublicInfo{}}
+		err := rows.Scan(
+			&request.ID, &request.FromUserID, &request.ToUserID, &request.CreatedAt,
+			&request.User.ID, &request.User.Username, &request.User.DisplayName,
+			&request.User.Bio, &request.User.StatusMessage, &request.User.AvatarRef,
+		)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
+
+// deleteRequestsBetween 删除两人之间任一方向的好友请求
+func deleteRequestsBetween(tx *sql.Tx, userID1, userID2 int) error {
+	_, err := tx.Exec(
+		`DELETE FROM contact_requests
+		 WHERE (from_user_id = $1 AND to_user_id = $2) OR (from_user_id = $2 AND to_user_id = $1)`,
+		userID1, userID2,
+	)
+	return err
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"database/sql"
 	"fmt"
+	"log"
 
 	"im-system/server/internal/config"
 
@@ -41,6 +42,11 @@ func createTables(db *sql.DB) error {
 			password_hash VARCHAR(255) NOT NULL,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
+		// 用户资料
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(64) NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS status_message VARCHAR(140) NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_ref VARCHAR(512) NOT NULL DEFAULT ''`,
 		`CREATE TABLE IF NOT EXISTS public_keys (
 			id SERIAL PRIMARY KEY,
 			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -48,6 +54,8 @@ func createTables(db *sql.DB) error {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			UNIQUE(user_id)
 		)`,
+		// 公钥支持的加密套件，按接收方偏好排列
+		`ALTER TABLE public_keys ADD COLUMN IF NOT EXISTS cipher_suites INTEGER[] NOT NULL DEFAULT '{}'`,
 		`CREATE TABLE IF NOT EXISTS messages (
 			id SERIAL PRIMARY KEY,
 			sender_id INTEGER NOT NULL REFERENCES users(id),
@@ -58,6 +66,123 @@ func createTables(db *sql.DB) error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_receiver ON messages(receiver_id, is_read)`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_created ON messages(created_at)`,
+		// 密封发送的消息不记录发送方
+		`ALTER TABLE messages ALTER COLUMN sender_id DROP NOT NULL`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS sealed BOOLEAN DEFAULT FALSE`,
+		// 客户端生成的消息ID，同一发送方重复发送（超时重试）时返回已有消息
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_message_id UUID`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_id ON messages(sender_id, client_message_id) WHERE client_message_id IS NOT NULL`,
+		// 消息发件箱：与消息在同一事务中写入，由调度协程推送后删除
+		`CREATE TABLE IF NOT EXISTS message_outbox (
+			id BIGSERIAL PRIMARY KEY,
+			message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			event_type VARCHAR(32) NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (message_id, event_type)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_outbox_due ON message_outbox(next_attempt_at)`,
+		`CREATE TABLE IF NOT EXISTS delivery_tokens (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			token_hash BYTEA NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS key_log (
+			leaf_index BIGINT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			public_key TEXT NOT NULL,
+			leaf_hash BYTEA NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_key_log_user ON key_log(user_id, leaf_index)`,
+		`CREATE TABLE IF NOT EXISTS key_backups (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			backup TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS signing_keys (
+			name VARCHAR(64) PRIMARY KEY,
+			private_key TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id VARCHAR(36) PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			refresh_token_hash BYTEA NOT NULL UNIQUE,
+			previous_token_hash BYTEA,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)`,
+		// 会话的设备信息
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS device_name VARCHAR(255) NOT NULL DEFAULT ''`,
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip_address VARCHAR(64) NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_previous_token ON sessions(previous_token_hash)`,
+		`CREATE TABLE IF NOT EXISTS revoked_tokens (
+			token_id VARCHAR(36) PRIMARY KEY,
+			expires_at TIMESTAMP NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS two_factor (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			secret VARCHAR(64) NOT NULL,
+			enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			last_used_step BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS recovery_codes (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash BYTEA NOT NULL,
+			used_at TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user ON recovery_codes(user_id)`,
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			username VARCHAR(255) NOT NULL,
+			event VARCHAR(64) NOT NULL,
+			ip_address VARCHAR(64) NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_user ON audit_events(user_id)`,
+		// 联系人（双向各一行）、好友请求与黑名单
+		`CREATE TABLE IF NOT EXISTS contacts (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			contact_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, contact_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS contact_requests (
+			id SERIAL PRIMARY KEY,
+			from_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			to_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (from_user_id, to_user_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_contact_requests_to ON contact_requests(to_user_id)`,
+		`CREATE TABLE IF NOT EXISTS blocks (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			blocked_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, blocked_id)
+		)`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS message_privacy VARCHAR(16) NOT NULL DEFAULT 'everyone'`,
+		// 用户搜索：是否可被搜索（索引见 createSearchIndexes）
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS discoverable BOOLEAN NOT NULL DEFAULT TRUE`,
+		`CREATE TABLE IF NOT EXISTS jwt_keys (
+			kid VARCHAR(36) PRIMARY KEY,
+			algorithm VARCHAR(16) NOT NULL,
+			private_key TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_jwt_keys_created ON jwt_keys(algorithm, created_at)`,
 	}
 
 	for _, query := range queries {
@@ -66,5 +191,28 @@ func createTables(db *sql.DB) error {
 		}
 	}
 
+	return createSearchIndexes(db)
+}
+
+// createSearchIndexes 创建用户名与显示名称的搜索索引。优先使用 pg_trgm 三元组索引（同时支持前缀与
+// 模糊匹配）；数据库用户没有创建扩展的权限时退回 text_pattern_ops 前缀索引，模糊匹配改为子串匹配
+func createSearchIndexes(db *sql.DB) error {
+	queries := []string{
+		`CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (lower(username) gin_trgm_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_display_name_trgm ON users USING gin (lower(display_name) gin_trgm_ops)`,
+	}
+	if _, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`); err != nil {
+		log.Printf("Failed to create pg_trgm extension, falling back to prefix search indexes: %v", err)
+		queries = []string{
+			`CREATE INDEX IF NOT EXISTS idx_users_username_prefix ON users (lower(username) text_pattern_ops)`,
+			`CREATE INDEX IF NOT EXISTS idx_users_display_name_prefix ON users (lower(display_name) text_pattern_ops)`,
+		}
+	}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"database/sql"
+)
+
+// DeliveryTokenRepository 密封发送投递令牌数据访问接口（只保存令牌哈希）
+type DeliveryTokenRepository interface {
+	Save(userID int, tokenHash []byte) error
+	GetHash(userID int) ([]byte, error)
+	// Delete 吊销用户的投递令牌，之前分发出去的令牌全部失效
+	Delete(userID int) error
+}
+
+type deliveryTokenRepository struct {
+	db *sql.DB
+}
+
+// NewDeliveryTokenRepository 创建投递令牌仓库实例
+func NewDeliveryTokenRepository(db *sql.DB) DeliveryTokenRepository {
+	return &deliveryTokenRepository{db: db}
+}
+
+func (r *deliveryTokenRepository) Save(userID int, tokenHash []byte) error {
+	_, err := r.db.Exec(
+		`INSERT INTO delivery_tokens (user_id, token_hash) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET token_hash = $2, updated_at = CURRENT_TIMESTAMP`,
+		userID, tokenHash,
+	)
+	return err
+}
+
+// GetHash 获取用户投递令牌的哈希，未设置时返回 nil
+func (r *deliveryTokenRepository) GetHash(userID int) ([]byte, error) {
+	var tokenHash []byte
+	err := r.db.QueryRow(
+		"SELECT token_hash FROM delivery_tokens WHERE user_id = $1",
+		userID,
+	).Scan(&tokenHash)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return tokenHash, err
+}
+
+func (r *deliveryTokenRepository) Delete(userID int) error {
+	_, err := r.db.Exec("DELETE FROM delivery_tokens WHERE user_id = $1", userID)
+	return err
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"database/sql"
+
+	"im-system/server/internal/model"
+)
+
+// JWTKeyRepository 访问令牌签名密钥数据访问接口
+type JWTKeyRepository interface {
+	// CreateIfDue 仅当最近 rotationSeconds 秒内没有同算法的新密钥时保存，多实例同时轮换时只有一个生效
+	CreateIfDue(key *model.JWTKey, rotationSeconds int) (bool, error)
+	// ListRecent 按创建时间倒序返回最近的 limit 个密钥
+	ListRecent(algorithm string, limit int) ([]model.JWTKey, error)
+	// UpdatePrivateKey 替换保存的私钥（旧版明文私钥改为加密保存）
+	UpdatePrivateKey(kid, privateKey string) error
+}
+
+type jwtKeyRepository struct {
+	db *sql.DB
+}
+
+// NewJWTKeyRepository 创建签名密钥仓库实例
+func NewJWTKeyRepository(db *sql.DB) JWTKeyRepository {
+	return &jwtKeyRepository{db: db}
+}
+
+func (r *jwtKeyRepository) CreateIfDue(key *model.JWTKey, rotationSeconds int) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// 事务级咨询锁保证多实例轮换互斥
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('jwt_keys'))"); err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec(
+		`INSERT INTO jwt_keys (kid, algorithm, private_key)
+		 SELECT $1, $2, $3
+		 WHERE NOT EXISTS (
+			SELECT 1 FROM jwt_keys
+			WHERE algorithm = $2 AND created_at > NOW() - make_interval(secs => $4)
+		 )`,
+		key.KID, key.Algorithm, key.PrivateKey, rotationSeconds,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, tx.Commit()
+}
+
+func (r *jwtKeyRepository) ListRecent(algorithm string, limit int) ([]model.JWTKey, error) {
+	rows, err := r.db.Query(
+		`SELECT kid, algorithm, private_key, created_at FROM jwt_keys
+		 WHERE algorithm = $1 ORDER BY created_at DESC LIMIT $2`,
+		algorithm, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []model.JWTKey
+	for rows.Next() {
+		var key model.JWTKey
+		if err := rows.Scan(&key.KID, &key.Algorithm, &key.PrivateKey, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *jwtKeyRepository) UpdatePrivateKey(kid, privateKey string) error {
+	_, err := r.db.Exec(`UPDATE jwt_keys SET private_key = $2 WHERE kid = $1`, kid, privateKey)
+	return err
+}
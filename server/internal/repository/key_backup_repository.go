@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"database/sql"
+
+	"im-system/server/internal/model"
+)
+
+// KeyBackupRepository 私钥加密备份数据访问接口
+type KeyBackupRepository interface {
+	Save(userID int, backup string) error
+	// Get 获取备份，没有上传过时返回 nil
+	Get(userID int) (*model.KeyBackup, error)
+	Delete(userID int) error
+}
+
+type keyBackupRepository struct {
+	db *sql.DB
+}
+
+// NewKeyBackupRepository 创建私钥备份仓库实例
+func NewKeyBackupRepository(db *sql.DB) KeyBackupRepository {
+	return &keyBackupRepository{db: db}
+}
+
+func (r *keyBackupRepository) Save(userID int, backup string) error {
+	_, err := r.db.Exec(
+		`INSERT INTO key_backups (user_id, backup) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET backup = $2, updated_at = CURRENT_TIMESTAMP`,
+		userID, backup,
+	)
+	return err
+}
+
+func (r *keyBackupRepository) Get(userID int) (*model.KeyBackup, error) {
+	backup := &model.KeyBackup{}
+	err := r.db.QueryRow(
+		"SELECT user_id, backup, created_at, updated_at FROM key_backups WHERE user_id = $1",
+		userID,
+	).Scan(&backup.UserID, &backup.Backup, &backup.CreatedAt, &backup.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return backup, nil
+}
+
+func (r *keyBackupRepository) Delete(userID int) error {
+	_, err := r.db.Exec("DELETE FROM key_backups WHERE user_id = $1", userID)
+	return err
+}
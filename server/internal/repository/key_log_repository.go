@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"im-system/server/internal/model"
+)
+
+// KeyLogRepository 公钥透明日志数据访问接口（只追加）
+type KeyLogRepository interface {
+	Append(userID int, publicKey string, leafHash []byte) (*model.KeyLogEntry, error)
+	GetLeafHashes(fromIndex int64) ([][]byte, error)
+	// GetLatestForUser 用户在前 treeSize 个叶子中的最新记录
+	GetLatestForUser(userID int, treeSize int64) (*model.KeyLogEntry, error)
+	GetUnloggedKeys() ([]model.PublicKey, error)
+}
+
+type keyLogRepository struct {
+	db *sql.DB
+}
+
+// NewKeyLogRepository 创建公钥透明日志仓库实例
+func NewKeyLogRepository(db *sql.DB) KeyLogRepository {
+	return &keyLogRepository{db: db}
+}
+
+func (r *keyLogRepository) Append(userID int, publicKey string, leafHash []byte) (*model.KeyLogEntry, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	entry, err := appendKeyLog(tx, userID, publicKey, leafHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// appendKeyLog 在事务中追加日志叶子
+func appendKeyLog(tx *sql.Tx, userID int, publicKey string, leafHash []byte) (*model.KeyLogEntry, error) {
+	// 加表锁保证叶子序号连续（多实例部署时同样有效）
+	if _, err := tx.Exec("LOCK TABLE key_log IN EXCLUSIVE MODE"); err != nil {
+		return nil, err
+	}
+
+	entry := &model.KeyLogEntry{
+		UserID:    userID,
+		PublicKey: publicKey,
+		LeafHash:  leafHash,
+	}
+	err := tx.QueryRow(
+		`INSERT INTO key_log (leaf_index, user_id, public_key, leaf_hash)
+		 SELECT COALESCE(MAX(leaf_index) + 1, 0), $1, $2, $3 FROM key_log
+		 RETURNING leaf_index, created_at`,
+		userID, publicKey, leafHash,
+	).Scan(&entry.LeafIndex, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (r *keyLogRepository) GetLeafHashes(fromIndex int64) ([][]byte, error) {
+	rows, err := r.db.Query(
+		"SELECT leaf_hash FROM key_log WHERE leaf_index >= $1 ORDER BY leaf_index ASC",
+		fromIndex,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes [][]byte
+	for rows.Next() {
+		var hash []byte
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, rows.Err()
+}
+
+func (r *keyLogRepository) GetLatestForUser(userID int, treeSize int64) (*model.KeyLogEntry, error) {
+	entry := &model.KeyLogEntry{}
+	err := r.db.QueryRow(
+		`SELECT leaf_index, user_id, public_key, leaf_hash, created_at FROM key_log
+		 WHERE user_id = $1 AND leaf_index < $2 ORDER BY leaf_index DESC LIMIT 1`,
+		userID, treeSize,
+	).Scan(&entry.LeafIndex, &entry.UserID, &entry.PublicKey, &entry.LeafHash, &entry.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("key log entry not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// GetUnloggedKeys 返回尚未记录到日志中的当前公钥（用于引入日志前已上传的公钥）
+func (r *keyLogRepository) GetUnloggedKeys() ([]model.PublicKey, error) {
+	rows, err := r.db.Query(
+		`SELECT pk.id, pk.user_id, pk.public_key, pk.created_at FROM public_keys pk
+		 WHERE NOT EXISTS (
+			SELECT 1 FROM key_log kl WHERE kl.user_id = pk.user_id AND kl.public_key = pk.public_key
+		 )
+		 ORDER BY pk.id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []model.PublicKey
+	for rows.Next() {
+		var key model.PublicKey
+		if err := rows.Scan(&key.ID, &key.UserID, &key.PublicKey, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
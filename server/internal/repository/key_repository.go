@@ -3,12 +3,16 @@ package repository
 import (
 	"database/sql"
 	"errors"
+
+	"github.com/lib/pq"
 )
 
 // KeyRepository 密钥数据访问接口
 type KeyRepository interface {
-	Save(userID int, publicKey string) error
+	// Save 保存公钥并在同一事务中追加透明日志叶子，日志写入失败时公钥不会生效
+	Save(userID int, publicKey string, cipherSuites []int, leafHash []byte) error
 	Get(userID int) (string, error)
+	GetCipherSuites(userID int) ([]int, error)
 	Exists(userID int) (bool, error)
 }
 
@@ -21,13 +25,32 @@ func NewKeyRepository(db *sql.DB) KeyRepository {
 	return &keyRepository{db: db}
 }
 
-func (r *keyRepository) Save(userID int, publicKey string) error {
-	_, err := r.db.Exec(
-		`INSERT INTO public_keys (user_id, public_key) VALUES ($1, $2)
-		 ON CONFLICT (user_id) DO UPDATE SET public_key = $2`,
-		userID, publicKey,
+func (r *keyRepository) Save(userID int, publicKey string, cipherSuites []int, leafHash []byte) error {
+	suites := make([]int64, len(cipherSuites))
+	for i, id := range cipherSuites {
+		suites[i] = int64(id)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO public_keys (user_id, public_key, cipher_suites) VALUES ($1, $2, $3)
+		 ON CONFLICT (user_id) DO UPDATE SET public_key = $2, cipher_suites = $3`,
+		userID, publicKey, pq.Array(suites),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if _, err := appendKeyLog(tx, userID, publicKey, leafHash); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *keyRepository) Get(userID int) (string, error) {
@@ -47,6 +70,28 @@ func (r *keyRepository) Get(userID int) (string, error) {
 	return publicKey, nil
 }
 
+// GetCipherSuites 获取用户公布的加密套件，旧版客户端上传的公钥为空
+func (r *keyRepository) GetCipherSuites(userID int) ([]int, error) {
+	var suites pq.Int64Array
+	err := r.db.QueryRow(
+		"SELECT cipher_suites FROM public_keys WHERE user_id = $1",
+		userID,
+	).Scan(&suites)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("public key not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]int, len(suites))
+	for i, id := range suites {
+		result[i] = int(id)
+	}
+	return result, nil
+}
+
 func (r *keyRepository) Exists(userID int) (bool, error) {
 	var exists bool
 	err := r.db.QueryRow(
@@ -2,18 +2,32 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 
 	"im-system/server/internal/model"
 )
 
+// ErrClientMessageIDReused 同一发送方的客户端消息ID已用于接收方或内容不同的消息
+var ErrClientMessageIDReused = errors.New("client_message_id was already used for a different message")
+
 // MessageRepository 消息数据访问接口
 type MessageRepository interface {
-	Save(senderID, receiverID int, encryptedContent string) (int, error)
+	// Save 在同一事务中保存消息，并写入推送给接收方与发送确认的发件箱事件；
+	// 同一发送方的 clientMessageID 已存在时返回已有消息ID，只重新写入发送确认；
+	// 已有消息的接收方或内容不同时返回 ErrClientMessageIDReused
+	Save(senderID, receiverID int, encryptedContent, clientMessageID string) (int, error)
+	// SaveSealed 在同一事务中保存密封消息，并写入推送给接收方的发件箱事件
+	SaveSealed(receiverID int, encryptedContent string) (int, error)
 	GetUnread(userID int) ([]model.Message, error)
 	MarkAsRead(messageID int) error
 	GetConversation(userID1, userID2 int, limit int) ([]model.Message, error)
+	// GetAllForUser 获取用户发出和收到的全部消息，按时间正序
+	GetAllForUser(userID int) ([]model.Message, error)
 }
 
+// messageColumns 查询消息的列，与 scanMessage 的扫描顺序一致
+const messageColumns = "id, sender_id, receiver_id, encrypted_content, sealed, client_message_id, is_read, created_at"
+
 type messageRepository struct {
 	db *sql.DB
 }
@@ -23,20 +37,86 @@ func NewMessageRepository(db *sql.DB) MessageRepository {
 	return &messageRepository{db: db}
 }
 
-func (r *messageRepository) Save(senderID, receiverID int, encryptedContent string) (int, error) {
+func (r *messageRepository) Save(senderID, receiverID int, encryptedContent, clientMessageID string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	clientID := sql.NullString{String: clientMessageID, Valid: clientMessageID != ""}
 	var messageID int
-	err := r.db.QueryRow(
-		`INSERT INTO messages (sender_id, receiver_id, encrypted_content) 
-		 VALUES ($1, $2, $3) RETURNING id`,
-		senderID, receiverID, encryptedContent,
+	err = tx.QueryRow(
+		`INSERT INTO messages (sender_id, receiver_id, encrypted_content, client_message_id) 
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (sender_id, client_message_id) WHERE client_message_id IS NOT NULL DO NOTHING
+		 RETURNING id`,
+		senderID, receiverID, encryptedContent, clientID,
 	).Scan(&messageID)
+	if err == sql.ErrNoRows {
+		// 重复发送：之前的发送确认可能已推送，重新推送给发送方
+		var storedReceiverID int
+		var storedContent string
+		if err := tx.QueryRow(
+			"SELECT id, receiver_id, encrypted_content FROM messages WHERE sender_id = $1 AND client_message_id = $2",
+			senderID, clientID,
+		).Scan(&messageID, &storedReceiverID, &storedContent); err != nil {
+			return 0, err
+		}
+		if storedReceiverID != receiverID || storedContent != encryptedContent {
+			return 0, ErrClientMessageIDReused
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO message_outbox (message_id, user_id, event_type) VALUES ($1, $2, $3)
+			 ON CONFLICT (message_id, event_type) DO NOTHING`,
+			messageID, senderID, model.OutboxEventMessageSent,
+		); err != nil {
+			return 0, err
+		}
+		return messageID, tx.Commit()
+	}
+	if err != nil {
+		return 0, err
+	}
 
-	return messageID, err
+	if _, err := tx.Exec(
+		`INSERT INTO message_outbox (message_id, user_id, event_type) VALUES ($1, $2, $3), ($1, $4, $5)`,
+		messageID, receiverID, model.OutboxEventMessage, senderID, model.OutboxEventMessageSent,
+	); err != nil {
+		return 0, err
+	}
+	return messageID, tx.Commit()
+}
+
+// SaveSealed 保存密封发送的消息，只记录接收方
+func (r *messageRepository) SaveSealed(receiverID int, encryptedContent string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var messageID int
+	if err := tx.QueryRow(
+		`INSERT INTO messages (receiver_id, encrypted_content, sealed) 
+		 VALUES ($1, $2, TRUE) RETURNING id`,
+		receiverID, encryptedContent,
+	).Scan(&messageID); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO message_outbox (message_id, user_id, event_type) VALUES ($1, $2, $3)`,
+		messageID, receiverID, model.OutboxEventSealedMessage,
+	); err != nil {
+		return 0, err
+	}
+	return messageID, tx.Commit()
 }
 
 func (r *messageRepository) GetUnread(userID int) ([]model.Message, error) {
 	rows, err := r.db.Query(
-		`SELECT id, sender_id, receiver_id, encrypted_content, is_read, created_at 
+		"SELECT "+messageColumns+`
 		 FROM messages WHERE receiver_id = $1 AND is_read = FALSE 
 		 ORDER BY created_at ASC`,
 		userID,
@@ -48,8 +128,8 @@ func (r *messageRepository) GetUnread(userID int) ([]model.Message, error) {
 
 	var messages []model.Message
 	for rows.Next() {
-		var msg model.Message
-		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.EncryptedContent, &msg.IsRead, &msg.CreatedAt); err != nil {
+		msg, err := scanMessage(rows)
+		if err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
@@ -68,7 +148,7 @@ func (r *messageRepository) MarkAsRead(messageID int) error {
 
 func (r *messageRepository) GetConversation(userID1, userID2 int, limit int) ([]model.Message, error) {
 	rows, err := r.db.Query(
-		`SELECT id, sender_id, receiver_id, encrypted_content, is_read, created_at 
+		"SELECT "+messageColumns+`
 		 FROM messages 
 		 WHERE (sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1)
 		 ORDER BY created_at DESC
@@ -82,8 +162,8 @@ func (r *messageRepository) GetConversation(userID1, userID2 int, limit int) ([]
 
 	var messages []model.Message
 	for rows.Next() {
-		var msg model.Message
-		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.EncryptedContent, &msg.IsRead, &msg.CreatedAt); err != nil {
+		msg, err := scanMessage(rows)
+		if err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
@@ -91,3 +171,41 @@ func (r *messageRepository) GetConversation(userID1, userID2 int, limit int) ([]
 
 	return messages, rows.Err()
 }
+
+func (r *messageRepository) GetAllForUser(userID int) ([]model.Message, error) {
+	rows, err := r.db.Query(
+		"SELECT "+messageColumns+`
+		 FROM messages
+		 WHERE sender_id = $1 OR receiver_id = $1
+		 ORDER BY created_at ASC, id ASC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []model.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// scanMessage 扫描一行消息，密封消息的 sender_id 为 NULL
+func scanMessage(rows *sql.Rows) (model.Message, error) {
+	var msg model.Message
+	var senderID sql.NullInt64
+	var sealed sql.NullBool
+	var clientMessageID sql.NullString
+	err := rows.Scan(&msg.ID, &senderID, &msg.ReceiverID, &msg.EncryptedContent, &sealed, &clientMessageID, &msg.IsRead, &msg.CreatedAt)
+	msg.SenderID = int(senderID.Int64)
+	msg.Sealed = sealed.Bool
+	msg.ClientMessageID = clientMessageID.String
+	return msg, err
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"im-system/server/internal/model"
+
+	"github.com/lib/pq"
+)
+
+// OutboxRepository 消息发件箱数据访问接口
+type OutboxRepository interface {
+	// Claim 领取到期的事件并租用 lease：租期内其他实例不会重复领取，实例在推送中途退出时租期结束后重新领取；
+	// 多个实例并发领取时互不重复
+	Claim(limit int, lease time.Duration) ([]model.OutboxEvent, error)
+	// Retry 推送失败的事件按已尝试次数退避：retryDelay*2^(attempts-1)，不超过 maxRetryDelay
+	Retry(ids []int64, retryDelay, maxRetryDelay time.Duration) error
+	Delete(ids []int64) error
+}
+
+type outboxRepository struct {
+	db *sql.DB
+}
+
+// NewOutboxRepository 创建发件箱仓库实例
+func NewOutboxRepository(db *sql.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+func (r *outboxRepository) Claim(limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	rows, err := r.db.Query(
+		`UPDATE message_outbox o
+		 SET attempts = o.attempts + 1,
+		     next_attempt_at = NOW() + make_interval(secs => $2)
+		 FROM messages m
+		 WHERE m.id = o.message_id AND o.id IN (
+		     SELECT id FROM message_outbox WHERE next_attempt_at <= NOW()
+		     ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING o.id, o.user_id, o.event_type, o.attempts,
+		     m.id, m.sender_id, m.receiver_id, m.encrypted_content, m.sealed, m.client_message_id, m.is_read, m.created_at`,
+		limit, lease.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.OutboxEvent
+	for rows.Next() {
+		var event model.OutboxEvent
+		var senderID sql.NullInt64
+		var sealed sql.NullBool
+		var clientMessageID sql.NullString
+		msg := &event.Message
+		if err := rows.Scan(
+			&event.ID, &event.UserID, &event.Type, &event.Attempts,
+			&msg.ID, &senderID, &msg.ReceiverID, &msg.EncryptedContent, &sealed, &clientMessageID, &msg.IsRead, &msg.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		msg.SenderID = int(senderID.Int64)
+		msg.Sealed = sealed.Bool
+		msg.ClientMessageID = clientMessageID.String
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING 不保证顺序，按写入顺序推送
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (r *outboxRepository) Retry(ids []int64, retryDelay, maxRetryDelay time.Duration) error {
+	_, err := r.db.Exec(
+		`UPDATE message_outbox
+		 SET next_attempt_at = NOW() + make_interval(secs => LEAST($2 * power(2, attempts - 1), $3))
+		 WHERE id = ANY($1)`,
+		pq.Array(ids), retryDelay.Seconds(), maxRetryDelay.Seconds(),
+	)
+	return err
+}
+
+func (r *outboxRepository) Delete(ids []int64) error {
+	_, err := r.db.Exec("DELETE FROM message_outbox WHERE id = ANY($1)", pq.Array(ids))
+	return err
+}
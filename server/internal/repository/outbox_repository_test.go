@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// openTestDB 在 IM_TEST_DATABASE_DSN 指向的数据库中创建独立的 schema 并建表，测试结束后删除；
+// 未设置时跳过（如 "host=localhost user=postgres password=postgres dbname=im_test sslmode=disable"）
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("IM_TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("IM_TEST_DATABASE_DSN not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "im_test_" + uuid.New().String()[:8]
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+	})
+
+	db, err := sql.Open("postgres", dsn+" search_path="+schema+",public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := createTables(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// saveTestMessages 保存 n 条消息，每条消息写入接收方推送与发送确认两个发件箱事件
+func saveTestMessages(t *testing.T, db *sql.DB, n int) {
+	t.Helper()
+	users := NewUserRepository(db)
+	senderID, err := users.Create("sender", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiverID, err := users.Create("receiver", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := NewMessageRepository(db)
+	for i := 0; i < n; i++ {
+		if _, err := messages.Save(senderID, receiverID, fmt.Sprint("ciphertext ", i), uuid.New().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// nextAttemptIn 返回事件距下一次可领取的时间
+func nextAttemptIn(t *testing.T, db *sql.DB, id int64) time.Duration {
+	t.Helper()
+	var seconds float64
+	if err := db.QueryRow(
+		"SELECT EXTRACT(EPOCH FROM next_attempt_at - NOW()) FROM message_outbox WHERE id = $1", id,
+	).Scan(&seconds); err != nil {
+		t.Fatal(err)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func TestOutboxClaim(t *testing.T) {
+	db := openTestDB(t)
+	saveTestMessages(t, db, 3)
+	repo := NewOutboxRepository(db)
+
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{4, 4},
+		// 已领取的事件在租期内不会再次领取
+		{10, 2},
+		{10, 0},
+	}
+	var lastID int64
+	for i, tt := range tests {
+		events, err := repo.Claim(tt.limit, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != tt.want {
+			t.Fatalf("claim %d: got %d events, want %d", i+1, len(events), tt.want)
+		}
+		for _, event := range events {
+			if event.ID <= lastID {
+				t.Errorf("claim %d: event %d out of order", i+1, event.ID)
+			}
+			lastID = event.ID
+			if event.Attempts != 1 {
+				t.Errorf("event %d attempts = %d, want 1", event.ID, event.Attempts)
+			}
+			if lease := nextAttemptIn(t, db, event.ID); lease < 55*time.Second || lease > time.Minute {
+				t.Errorf("event %d leased for %v, want about 1m", event.ID, lease)
+			}
+		}
+	}
+}
+
+func TestOutboxRetryBackoff(t *testing.T) {
+	db := openTestDB(t)
+	saveTestMessages(t, db, 1)
+	repo := NewOutboxRepository(db)
+
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second} {
+		// 模拟退避结束
+		if _, err := db.Exec("UPDATE message_outbox SET next_attempt_at = NOW()"); err != nil {
+			t.Fatal(err)
+		}
+		events, err := repo.Claim(10, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 2 || events[0].Attempts != attempt+1 {
+			t.Fatalf("attempt %d: claimed %+v", attempt+1, events)
+		}
+
+		if err := repo.Retry([]int64{events[0].ID}, time.Second, 10*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if got := nextAttemptIn(t, db, events[0].ID); got < want-time.Second || got > want {
+			t.Errorf("attempt %d: retry in %v, want about %v", attempt+1, got, want)
+		}
+		// 未重试的事件保持租期
+		if got := nextAttemptIn(t, db, events[1].ID); got < 55*time.Second {
+			t.Errorf("attempt %d: leased event due in %v, want about 1m", attempt+1, got)
+		}
+	}
+}
+
+func TestOutboxConcurrentClaim(t *testing.T) {
+	db := openTestDB(t)
+	saveTestMessages(t, db, 20)
+	repo := NewOutboxRepository(db)
+
+	var mu sync.Mutex
+	claimed := make(map[int64]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				events, err := repo.Claim(5, time.Minute)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(events) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, event := range events {
+					claimed[event.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(claimed) != 40 {
+		t.Errorf("claimed %d distinct events, want 40", len(claimed))
+	}
+	for id, n := range claimed {
+		if n != 1 {
+			t.Errorf("event %d claimed %d times", id, n)
+		}
+	}
+}
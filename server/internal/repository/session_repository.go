@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"im-system/server/internal/model"
+)
+
+// SessionRepository 登录会话与令牌吊销数据访问接口
+type SessionRepository interface {
+	// Create 创建会话，有效期由数据库按当前时间计算
+	Create(session *model.Session, ttl time.Duration) error
+	// Get 按ID查找会话，不存在时返回 nil
+	Get(sessionID string) (*model.Session, error)
+	// GetByTokenHash 按当前或上一个刷新令牌的哈希查找会话，不存在时返回 nil
+	GetByTokenHash(tokenHash []byte) (*model.Session, error)
+	// ListActive 列出用户未吊销且未过期的会话，最近活动的在前
+	ListActive(userID int) ([]model.Session, error)
+	// Rotate 仅当当前刷新令牌仍为 oldHash 且会话未吊销时替换，返回是否成功
+	Rotate(sessionID string, oldHash, newHash []byte, ttl time.Duration, ipAddress string) (bool, error)
+	// Touch 更新会话最近活动时间（每分钟最多写一次）
+	Touch(sessionID string) error
+	Revoke(sessionID string) error
+	// IsActive 会话存在、未吊销且未过期
+	IsActive(sessionID string) (bool, error)
+	RevokeToken(tokenID string, expiresAt time.Time) error
+	IsTokenRevoked(tokenID string) (bool, error)
+}
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository 创建会话仓库实例
+func NewSessionRepository(db *sql.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(session *model.Session, ttl time.Duration) error {
+	// 顺带清理已过期的会话
+	if _, err := r.db.Exec("DELETE FROM sessions WHERE expires_at < NOW()"); err != nil {
+		return err
+	}
+
+	return r.db.QueryRow(
+		`INSERT INTO sessions (id, user_id, device_name, user_agent, ip_address, refresh_token_hash, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, NOW() + make_interval(secs => $7))
+		 RETURNING created_at, last_used_at, expires_at`,
+		session.ID, session.UserID, session.DeviceName, session.UserAgent, session.IPAddress,
+		session.RefreshTokenHash, ttl.Seconds(),
+	).Scan(&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+}
+
+// sessionColumns 查询会话时选取的列，与 scanSession 的顺序一致
+const sessionColumns = `id, user_id, device_name, user_agent, ip_address, refresh_token_hash, previous_token_hash,
+	created_at, last_used_at, expires_at, revoked_at`
+
+func (r *sessionRepository) Get(sessionID string) (*model.Session, error) {
+	return r.getOne("SELECT "+sessionColumns+" FROM sessions WHERE id = $1", sessionID)
+}
+
+func (r *sessionRepository) GetByTokenHash(tokenHash []byte) (*model.Session, error) {
+	return r.getOne(
+		"SELECT "+sessionColumns+" FROM sessions WHERE refresh_token_hash = $1 OR previous_token_hash = $1",
+		tokenHash,
+	)
+}
+
+func (r *sessionRepository) ListActive(userID int) ([]model.Session, error) {
+	rows, err := r.db.Query(
+		`SELECT `+sessionColumns+` FROM sessions
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		 ORDER BY last_used_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []model.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sessionRepository) getOne(query string, arg interface{}) (*model.Session, error) {
+	session, err := scanSession(r.db.QueryRow(query, arg))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// rowScanner *sql.Row 与 *sql.Rows 的公共接口
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*model.Session, error) {
+	session := &model.Session{}
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent, &session.IPAddress,
+		&session.RefreshTokenHash, &session.PreviousTokenHash,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *sessionRepository) Rotate(sessionID string, oldHash, newHash []byte, ttl time.Duration, ipAddress string) (bool, error) {
+	result, err := r.db.Exec(
+		`UPDATE sessions
+		 SET refresh_token_hash = $3, previous_token_hash = $2, ip_address = $5,
+		     expires_at = NOW() + make_interval(secs => $4), last_used_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND refresh_token_hash = $2 AND revoked_at IS NULL AND expires_at > NOW()`,
+		sessionID, oldHash, newHash, ttl.Seconds(), ipAddress,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *sessionRepository) Touch(sessionID string) error {
+	_, err := r.db.Exec(
+		`UPDATE sessions SET last_used_at = CURRENT_TIMESTAMP
+		 WHERE id = $1 AND last_used_at < NOW() - INTERVAL '1 minute'`,
+		sessionID,
+	)
+	return err
+}
+
+func (r *sessionRepository) Revoke(sessionID string) error {
+	_, err := r.db.Exec(
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL",
+		sessionID,
+	)
+	return err
+}
+
+func (r *sessionRepository) IsActive(sessionID string) (bool, error) {
+	var active bool
+	err := r.db.QueryRow(
+		"SELECT revoked_at IS NULL AND expires_at > NOW() FROM sessions WHERE id = $1",
+		sessionID,
+	).Scan(&active)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return active, err
+}
+
+func (r *sessionRepository) RevokeToken(tokenID string, expiresAt time.Time) error {
+	// 访问令牌过期后吊销记录不再需要
+	if _, err := r.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < NOW()"); err != nil {
+		return err
+	}
+
+	_, err := r.db.Exec(
+		`INSERT INTO revoked_tokens (token_id, expires_at) VALUES ($1, to_timestamp($2))
+		 ON CONFLICT (token_id) DO NOTHING`,
+		tokenID, expiresAt.Unix(),
+	)
+	return err
+}
+
+func (r *sessionRepository) IsTokenRevoked(tokenID string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE token_id = $1)",
+		tokenID,
+	).Scan(&revoked)
+	return revoked, err
+}
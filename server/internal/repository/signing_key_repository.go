@@ -0,0 +1,37 @@
+package repository
+
+import "database/sql"
+
+// SigningKeyRepository 服务端签名私钥数据访问接口
+type SigningKeyRepository interface {
+	GetOrCreate(name, privateKeyPEM string) (string, error)
+}
+
+type signingKeyRepository struct {
+	db *sql.DB
+}
+
+// NewSigningKeyRepository 创建签名私钥仓库实例
+func NewSigningKeyRepository(db *sql.DB) SigningKeyRepository {
+	return &signingKeyRepository{db: db}
+}
+
+// GetOrCreate 返回已保存的私钥；不存在时保存传入的私钥（多实例并发启动时以先写入者为准）
+func (r *signingKeyRepository) GetOrCreate(name, privateKeyPEM string) (string, error) {
+	_, err := r.db.Exec(
+		`INSERT INTO signing_keys (name, private_key) VALUES ($1, $2)
+		 ON CONFLICT (name) DO NOTHING`,
+		name, privateKeyPEM,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var stored string
+	err = r.db.QueryRow(
+		"SELECT private_key FROM signing_keys WHERE name = $1",
+		name,
+	).Scan(&stored)
+
+	return stored, err
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"database/sql"
+
+	"im-system/server/internal/model"
+)
+
+// TwoFactorRepository TOTP 两步验证数据访问接口
+type TwoFactorRepository interface {
+	// Get 获取用户的两步验证配置，未设置时返回 nil
+	Get(userID int) (*model.TwoFactor, error)
+	// SavePending 保存尚未激活的密钥，已激活时不覆盖，返回是否保存
+	SavePending(userID int, secret string) (bool, error)
+	// Enable 激活两步验证并替换恢复码
+	Enable(userID int, step int64, recoveryCodeHashes [][]byte) error
+	// UseStep 记录已使用的时间步，时间步不大于上次使用的时间步时返回 false
+	UseStep(userID int, step int64) (bool, error)
+	// UseRecoveryCode 消耗一个未使用的恢复码，返回是否成功
+	UseRecoveryCode(userID int, codeHash []byte) (bool, error)
+	// ReplaceRecoveryCodes 作废旧恢复码并保存新的恢复码
+	ReplaceRecoveryCodes(userID int, recoveryCodeHashes [][]byte) error
+	// CountRecoveryCodes 返回剩余未使用的恢复码数量
+	CountRecoveryCodes(userID int) (int, error)
+	// Delete 关闭两步验证并删除恢复码
+	Delete(userID int) error
+}
+
+type twoFactorRepository struct {
+	db *sql.DB
+}
+
+// NewTwoFactorRepository 创建两步验证仓库实例
+func NewTwoFactorRepository(db *sql.DB) TwoFactorRepository {
+	return &twoFactorRepository{db: db}
+}
+
+func (r *twoFactorRepository) Get(userID int) (*model.TwoFactor, error) {
+	tf := &model.TwoFactor{}
+	err := r.db.QueryRow(
+		"SELECT user_id, secret, enabled, last_used_step, created_at FROM two_factor WHERE user_id = $1",
+		userID,
+	).Scan(&tf.UserID, &tf.Secret, &tf.Enabled, &tf.LastUsedStep, &tf.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tf, nil
+}
+
+func (r *twoFactorRepository) SavePending(userID int, secret string) (bool, error) {
+	result, err := r.db.Exec(
+		`INSERT INTO two_factor (user_id, secret) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET secret = $2, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+		 WHERE two_factor.enabled = FALSE`,
+		userID, secret,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *twoFactorRepository) Enable(userID int, step int64, recoveryCodeHashes [][]byte) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		"UPDATE two_factor SET enabled = TRUE, last_used_step = $2 WHERE user_id = $1",
+		userID, step,
+	); err != nil {
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *twoFactorRepository) UseStep(userID int, step int64) (bool, error) {
+	result, err := r.db.Exec(
+		"UPDATE two_factor SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2",
+		userID, step,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(userID int, codeHash []byte) (bool, error) {
+	result, err := r.db.Exec(
+		`UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		 WHERE id = (
+			SELECT id FROM recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		 ) AND used_at IS NULL`,
+		userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+func (r *twoFactorRepository) ReplaceRecoveryCodes(userID int, recoveryCodeHashes [][]byte) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *twoFactorRepository) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL",
+		userID,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *twoFactorRepository) Delete(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM two_factor WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, recoveryCodeHashes [][]byte) error {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, hash,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
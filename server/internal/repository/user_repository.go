@@ -3,6 +3,8 @@ package repository
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 
 	"im-system/server/internal/model"
 
@@ -14,17 +16,37 @@ type UserRepository interface {
 	Create(username, password string) (int, error)
 	GetByUsername(username string) (*model.User, error)
 	GetByID(userID int) (*model.User, error)
-	GetAll() ([]model.User, error)
 	VerifyPassword(hashedPassword, password string) bool
+	GetPasswordHash(userID int) (string, error)
+	UpdatePassword(userID int, password string) error
+	GetPrivacy(userID int) (*model.PrivacySettings, error)
+	// UpdatePrivacy 修改隐私设置中非 nil 的字段，返回修改后的设置
+	UpdatePrivacy(userID int, update *model.PrivacyUpdate) (*model.PrivacySettings, error)
+	// Search 按用户名与显示名称搜索可被搜索的用户（排除自己及与自己互相拉黑的用户），
+	// 按匹配程度与用户名排序，从 after 之后返回最多 limit 个，还有更多结果时返回下一页位置
+	Search(viewerID int, query string, fuzzy bool, after *model.UserSearchCursor, limit int) ([]model.User, *model.UserSearchCursor, error)
+	// UpdateProfile 修改资料中非 nil 的字段，返回修改后的用户
+	UpdateProfile(userID int, update *model.ProfileUpdate) (*model.User, error)
+	// Delete 删除用户及其公钥、会话等数据；收到的消息一并删除，
+	// 发出的消息按 deleteSentMessages 删除或匿名化（保留给接收方）
+	Delete(userID int, deleteSentMessages bool) error
 }
 
+// userColumns 用户查询的公共列（不含密码哈希），与 scanUser 的顺序一致
+const userColumns = "id, username, display_name, bio, status_message, avatar_ref, created_at"
+
 type userRepository struct {
 	db *sql.DB
+	// trigram 数据库是否安装了 pg_trgm 扩展，未安装时模糊搜索退回子串匹配
+	trigram bool
 }
 
 // NewUserRepository 创建用户仓库实例
 func NewUserRepository(db *sql.DB) UserRepository {
-	return &userRepository{db: db}
+	// 查询失败时按未安装处理
+	var trigram bool
+	_ = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')`).Scan(&trigram)
+	return &userRepository{db: db, trigram: trigram}
 }
 
 func (r *userRepository) Create(username, password string) (int, error) {
@@ -49,9 +71,9 @@ func (r *userRepository) Create(username, password string) (int, error) {
 func (r *userRepository) GetByUsername(username string) (*model.User, error) {
 	user := &model.User{}
 	err := r.db.QueryRow(
-		"SELECT id, username, password_hash, created_at FROM users WHERE username = $1",
+		"SELECT password_hash, "+userColumns+" FROM users WHERE username = $1",
 		username,
-	).Scan(&user.ID, &user.Username, &user.Password, &user.CreatedAt)
+	).Scan(&user.Password, &user.ID, &user.Username, &user.DisplayName, &user.Bio, &user.StatusMessage, &user.AvatarRef, &user.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, errors.New("user not found")
@@ -64,11 +86,10 @@ func (r *userRepository) GetByUsername(username string) (*model.User, error) {
 }
 
 func (r *userRepository) GetByID(userID int) (*model.User, error) {
-	user := &model.User{}
-	err := r.db.QueryRow(
-		"SELECT id, username, created_at FROM users WHERE id = $1",
+	user, err := scanUser(r.db.QueryRow(
+		"SELECT "+userColumns+" FROM users WHERE id = $1",
 		userID,
-	).Scan(&user.ID, &user.Username, &user.CreatedAt)
+	))
 
 	if err == sql.ErrNoRows {
 		return nil, errors.New("user not found")
@@ -80,26 +101,191 @@ func (r *userRepository) GetByID(userID int) (*model.User, error) {
 	return user, nil
 }
 
-func (r *userRepository) GetAll() ([]model.User, error) {
-	rows, err := r.db.Query("SELECT id, username, created_at FROM users ORDER BY id")
+func (r *userRepository) GetPasswordHash(userID int) (string, error) {
+	var hashedPassword string
+	err := r.db.QueryRow(
+		"SELECT password_hash FROM users WHERE id = $1",
+		userID,
+	).Scan(&hashedPassword)
+
+	if err == sql.ErrNoRows {
+		return "", errors.New("user not found")
+	}
+	return hashedPassword, err
+}
+
+func (r *userRepository) UpdatePassword(userID int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(
+		"UPDATE users SET password_hash = $2 WHERE id = $1",
+		userID, string(hashedPassword),
+	)
+	return err
+}
+
+func (r *userRepository) GetPrivacy(userID int) (*model.PrivacySettings, error) {
+	privacy := &model.PrivacySettings{}
+	err := r.db.QueryRow(
+		"SELECT message_privacy, discoverable FROM users WHERE id = $1",
+		userID,
+	).Scan(&privacy.MessagePrivacy, &privacy.Discoverable)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("user not found")
+	}
 	if err != nil {
 		return nil, err
 	}
+
+	return privacy, nil
+}
+
+func (r *userRepository) UpdatePrivacy(userID int, update *model.PrivacyUpdate) (*model.PrivacySettings, error) {
+	privacy := &model.PrivacySettings{}
+	err := r.db.QueryRow(
+		`UPDATE users SET
+			message_privacy = COALESCE($2, message_privacy),
+			discoverable = COALESCE($3, discoverable)
+		 WHERE id = $1
+		 RETURNING message_privacy, discoverable`,
+		userID, update.MessagePrivacy, update.Discoverable,
+	).Scan(&privacy.MessagePrivacy, &privacy.Discoverable)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return privacy, nil
+}
+
+// Search 的匹配程度：0 完全匹配（或未指定关键字），1 前缀匹配，2 模糊匹配（三元组相似度，未安装 pg_trgm 时为子串匹配）
+func (r *userRepository) Search(viewerID int, query string, fuzzy bool, after *model.UserSearchCursor, limit int) ([]model.User, *model.UserSearchCursor, error) {
+	args := []interface{}{viewerID, query, escapeLike(query) + "%", fuzzy}
+	fuzzyMatch := `lower(username) % $2 OR lower(display_name) % $2`
+	if !r.trigram {
+		args = append(args, "%"+escapeLike(query)+"%")
+		fuzzyMatch = `username ILIKE $5 OR display_name ILIKE $5`
+	}
+	sqlQuery := `SELECT ` + userColumns + `, rank FROM (
+		SELECT ` + userColumns + `,
+			CASE
+				WHEN $2 = '' OR lower(username) = $2 OR lower(display_name) = $2 THEN 0
+				WHEN lower(username) LIKE $3 OR lower(display_name) LIKE $3 THEN 1
+				ELSE 2
+			END AS rank
+		FROM users u
+		WHERE discoverable AND id <> $1
+			AND ($2 = '' OR lower(username) LIKE $3 OR lower(display_name) LIKE $3
+				OR ($4 AND (` + fuzzyMatch + `)))
+			AND NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.user_id = $1 AND b.blocked_id = u.id) OR (b.user_id = u.id AND b.blocked_id = $1)
+			)
+	) matches`
+	if after != nil {
+		args = append(args, after.Rank, after.Username)
+		sqlQuery += fmt.Sprintf(" WHERE (rank, username) > ($%d, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, limit+1)
+	sqlQuery += fmt.Sprintf(" ORDER BY rank, username LIMIT $%d", len(args))
+
+	rows, err := r.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer rows.Close()
 
 	var users []model.User
+	var ranks []int
 	for rows.Next() {
 		var user model.User
-		if err := rows.Scan(&user.ID, &user.Username, &user.CreatedAt); err != nil {
-			return nil, err
+		var rank int
+		err := rows.Scan(&user.ID, &user.Username, &user.DisplayName, &user.Bio, &user.StatusMessage, &user.AvatarRef, &user.CreatedAt, &rank)
+		if err != nil {
+			return nil, nil, err
 		}
 		users = append(users, user)
+		ranks = append(ranks, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// 多查询的一行用于判断是否还有下一页
+	if len(users) <= limit {
+		return users, nil, nil
+	}
+	users = users[:limit]
+	return users, &model.UserSearchCursor{Rank: ranks[limit-1], Username: users[limit-1].Username}, nil
+}
+
+func (r *userRepository) UpdateProfile(userID int, update *model.ProfileUpdate) (*model.User, error) {
+	user, err := scanUser(r.db.QueryRow(
+		`UPDATE users SET
+			display_name = COALESCE($2, display_name),
+			bio = COALESCE($3, bio),
+			status_message = COALESCE($4, status_message),
+			avatar_ref = COALESCE($5, avatar_ref)
+		 WHERE id = $1
+		 RETURNING `+userColumns,
+		userID, update.DisplayName, update.Bio, update.StatusMessage, update.AvatarRef,
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("user not found")
+	}
+	return user, err
+}
+
+func (r *userRepository) Delete(userID int, deleteSentMessages bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	return users, rows.Err()
+	if _, err := tx.Exec("DELETE FROM messages WHERE receiver_id = $1", userID); err != nil {
+		return err
+	}
+
+	sentQuery := "UPDATE messages SET sender_id = NULL WHERE sender_id = $1"
+	if deleteSentMessages {
+		sentQuery = "DELETE FROM messages WHERE sender_id = $1"
+	}
+	if _, err := tx.Exec(sentQuery, userID); err != nil {
+		return err
+	}
+
+	// 公钥、会话、两步验证、私钥备份、投递令牌随用户级联删除；公钥透明日志只追加，保留不变
+	if _, err := tx.Exec("DELETE FROM users WHERE id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (r *userRepository) VerifyPassword(hashedPassword, password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
 }
+
+// scanUser 按 userColumns 的顺序扫描一行用户
+func scanUser(row rowScanner) (*model.User, error) {
+	user := &model.User{}
+	err := row.Scan(&user.ID, &user.Username, &user.DisplayName, &user.Bio, &user.StatusMessage, &user.AvatarRef, &user.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// escapeLike 转义 LIKE 模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -1,10 +1,14 @@
 package router
 
 import (
+	"expvar"
+	"time"
+
 	"im-system/server/internal/config"
 	"im-system/server/internal/controller"
 	"im-system/server/internal/middleware"
 	"im-system/server/internal/service"
+	"im-system/server/pkg/ratelimit"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,19 +19,47 @@ func SetupRouter(
 	userService service.UserService,
 	messageService service.MessageService,
 	keyService service.KeyService,
+	keyLogService service.KeyLogService,
+	keyBackupService service.KeyBackupService,
+	sealedSenderService service.SealedSenderService,
+	sessionService service.SessionService,
+	accountService service.AccountService,
+	profileService service.ProfileService,
+	contactService service.ContactService,
+	twoFactorService service.TwoFactorService,
+	jwtKeyService service.JWTKeyService,
 	wsService service.WebSocketService,
-) *gin.Engine {
+	limits ratelimit.Store,
+) (*gin.Engine, error) {
 	router := gin.Default()
 
+	// 默认不信任任何代理，ClientIP 为连接的对端地址，防止伪造 X-Forwarded-For
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+
 	// 添加 CORS 中间件
 	router.Use(middleware.CORSMiddleware())
 
 	// 初始化控制器
 	authCtrl := controller.NewAuthController(userService)
-	userCtrl := controller.NewUserController(userService, wsService)
+	userCtrl := controller.NewUserController(profileService, contactService)
+	contactCtrl := controller.NewContactController(contactService)
 	messageCtrl := controller.NewMessageController(messageService)
 	keyCtrl := controller.NewKeyController(keyService)
+	keyLogCtrl := controller.NewKeyLogController(keyLogService)
+	keyBackupCtrl := controller.NewKeyBackupController(keyBackupService)
+	sealedSenderCtrl := controller.NewSealedSenderController(sealedSenderService)
+	sessionCtrl := controller.NewSessionController(sessionService)
+	accountCtrl := controller.NewAccountController(accountService)
+	twoFactorCtrl := controller.NewTwoFactorController(twoFactorService)
 	wsCtrl := controller.NewWebSocketController(wsService)
+	jwksCtrl := controller.NewJWKSController(jwtKeyService)
+
+	// 登录/注册限流（按 IP 与用户名分别计数），两步验证按 IP 计数
+	authLimit := middleware.RateLimitMiddleware(
+		limits.NewTokenBucket("auth", time.Minute/time.Duration(cfg.AuthRequestsPerMinute), cfg.AuthRequestsPerMinute),
+	)
 
 	// API 路由组
 	api := router.Group("/api")
@@ -35,13 +67,20 @@ func SetupRouter(
 		// 认证路由（无需认证）
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", authCtrl.Register)
-			auth.POST("/login", authCtrl.Login)
+			auth.POST("/register", authLimit, authCtrl.Register)
+			auth.POST("/login", authLimit, authCtrl.Login)
+			auth.POST("/refresh", authCtrl.Refresh)
+			auth.POST("/logout", middleware.AuthMiddleware(userService), authCtrl.Logout)
+			auth.POST("/2fa/verify", authLimit, twoFactorCtrl.Verify)
 		}
 
 		// WebSocket 路由（需要认证）
 		api.GET("/ws", middleware.WSAuthMiddleware(userService), wsCtrl.HandleWebSocket)
 
+		// 密封发送（凭投递令牌，无需认证）
+		api.POST("/sealed/messages", sealedSenderCtrl.SendSealedMessage)
+		api.GET("/sealed/public-key", sealedSenderCtrl.GetPublicKey)
+
 		// 需要认证的路由
 		authenticated := api.Group("")
 		authenticated.Use(middleware.AuthMiddleware(userService))
@@ -49,8 +88,58 @@ func SetupRouter(
 			// 用户路由
 			users := authenticated.Group("/users")
 			{
-				users.GET("", userCtrl.GetAllUsers)
 				users.GET("/online", userCtrl.GetOnlineUsers)
+				users.GET("/search", userCtrl.SearchUsers)
+				users.GET("/me", userCtrl.GetMe)
+				users.PATCH("/me", userCtrl.UpdateMe)
+				users.GET("/me/privacy", userCtrl.GetPrivacy)
+				users.PUT("/me/privacy", userCtrl.UpdatePrivacy)
+				users.GET("/:id", userCtrl.GetUser)
+			}
+
+			// 联系人与好友请求路由
+			contacts := authenticated.Group("/contacts")
+			{
+				contacts.GET("", contactCtrl.ListContacts)
+				contacts.DELETE("/:id", contactCtrl.RemoveContact)
+				contacts.GET("/requests", contactCtrl.ListRequests)
+				contacts.POST("/requests", contactCtrl.SendRequest)
+				contacts.POST("/requests/:id/accept", contactCtrl.AcceptRequest)
+				contacts.POST("/requests/:id/decline", contactCtrl.DeclineRequest)
+			}
+
+			// 黑名单路由
+			blocks := authenticated.Group("/blocks")
+			{
+				blocks.GET("", contactCtrl.ListBlocked)
+				blocks.PUT("/:id", contactCtrl.Block)
+				blocks.DELETE("/:id", contactCtrl.Unblock)
+			}
+
+			// 会话（设备）管理路由
+			sessions := authenticated.Group("/sessions")
+			{
+				sessions.GET("", sessionCtrl.ListSessions)
+				sessions.DELETE("", sessionCtrl.RevokeOtherSessions)
+				sessions.DELETE("/:id", sessionCtrl.RevokeSession)
+			}
+
+			// 账户路由
+			account := authenticated.Group("/account")
+			{
+				account.PUT("/password", accountCtrl.ChangePassword)
+				account.DELETE("", accountCtrl.DeleteAccount)
+				account.GET("/export", accountCtrl.Export)
+			}
+
+			// 两步验证路由
+			twoFactor := authenticated.Group("/2fa")
+			{
+				twoFactor.GET("", twoFactorCtrl.GetStatus)
+				twoFactor.POST("/setup", twoFactorCtrl.Setup)
+				twoFactor.POST("/activate", twoFactorCtrl.Activate)
+				twoFactor.POST("/disable", twoFactorCtrl.Disable)
+				twoFactor.POST("/recovery-codes", twoFactorCtrl.RegenerateRecoveryCodes)
 			}
 
 			// 密钥路由
@@ -58,9 +147,28 @@ func SetupRouter(
 			{
 				keys.POST("/generate", keyCtrl.GenerateKeys)
 				keys.POST("/upload", keyCtrl.UploadPublicKey)
+				keys.PUT("/backup", keyBackupCtrl.UploadBackup)
+				keys.GET("/backup", keyBackupCtrl.GetBackup)
+				keys.DELETE("/backup", keyBackupCtrl.DeleteBackup)
 				keys.GET("/:userID", keyCtrl.GetPublicKey)
 			}
 
+			// 公钥透明日志路由
+			keyLog := authenticated.Group("/keylog")
+			{
+				keyLog.GET("/sth", keyLogCtrl.GetSignedTreeHead)
+				keyLog.GET("/public-key", keyLogCtrl.GetPublicKey)
+				keyLog.GET("/inclusion/:userID", keyLogCtrl.GetInclusionProof)
+				keyLog.GET("/consistency", keyLogCtrl.GetConsistencyProof)
+			}
+
+			// 密封发送路由
+			sealed := authenticated.Group("/sealed")
+			{
+				sealed.PUT("/delivery-token", sealedSenderCtrl.SetDeliveryToken)
+				sealed.GET("/certificate", sealedSenderCtrl.GetCertificate)
+			}
+
 			// 消息路由
 			messages := authenticated.Group("/messages")
 			{
@@ -71,10 +179,24 @@ func SetupRouter(
 		}
 	}
 
+	// 访问令牌签名公钥
+	router.GET("/.well-known/jwks.json", jwksCtrl.GetJWKS)
+
 	// 健康检查
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	return router, nil
+}
+
+// SetupAdminRouter 管理接口，只在 ADMIN_ADDR（默认本机回环地址）上监听，不对外暴露
+func SetupAdminRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Recovery())
+
+	// 运行指标（expvar，包括 WebSocket 推送队列统计）
+	router.GET("/debug/vars", gin.WrapH(expvar.Handler()))
+
 	return router
 }
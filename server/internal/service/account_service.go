@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+)
+
+var (
+	// ErrWrongPassword 当前密码错误
+	ErrWrongPassword = errors.New("current password is incorrect")
+	// ErrPasswordUnchanged 新密码与当前密码相同
+	ErrPasswordUnchanged = errors.New("new password must differ from the current password")
+)
+
+// AccountService 账户生命周期服务接口
+type AccountService interface {
+	// ChangePassword 校验当前密码后修改密码，并退出除当前会话外的所有会话
+	ChangePassword(userID int, currentSessionID, currentPassword, newPassword string) error
+	// DeleteAccount 校验密码后删除账户，断开所有 WebSocket 连接
+	DeleteAccount(userID int, password string, deleteSentMessages bool) error
+	// Export 导出用户的全部数据（资料、公钥、加密备份、会话与加密消息）
+	Export(userID int) (*model.AccountExport, error)
+}
+
+type accountService struct {
+	userRepo       repository.UserRepository
+	keyRepo        repository.KeyRepository
+	keyBackupRepo  repository.KeyBackupRepository
+	twoFactorRepo  repository.TwoFactorRepository
+	sessionRepo    repository.SessionRepository
+	messageService MessageService
+	sessionService SessionService
+	userService    UserService
+}
+
+// NewAccountService 创建账户服务实例
+func NewAccountService(
+	userRepo repository.UserRepository,
+	keyRepo repository.KeyRepository,
+	keyBackupRepo repository.KeyBackupRepository,
+	twoFactorRepo repository.TwoFactorRepository,
+	sessionRepo repository.SessionRepository,
+	messageService MessageService,
+	sessionService SessionService,
+	userService UserService,
+) AccountService {
+	return &accountService{
+		userRepo:       userRepo,
+		keyRepo:        keyRepo,
+		keyBackupRepo:  keyBackupRepo,
+		twoFactorRepo:  twoFactorRepo,
+		sessionRepo:    sessionRepo,
+		messageService: messageService,
+		sessionService: sessionService,
+		userService:    userService,
+	}
+}
+
+func (s *accountService) ChangePassword(userID int, currentSessionID, currentPassword, newPassword string) error {
+	if err := s.verifyPassword(userID, currentPassword); err != nil {
+		return err
+	}
+	if currentPassword == newPassword {
+		return ErrPasswordUnchanged
+	}
+
+	if err := s.userRepo.UpdatePassword(userID, newPassword); err != nil {
+		return err
+	}
+
+	_, err := s.sessionService.RevokeOtherSessions(userID, currentSessionID)
+	return err
+}
+
+func (s *accountService) DeleteAccount(userID int, password string, deleteSentMessages bool) error {
+	if err := s.verifyPassword(userID, password); err != nil {
+		return err
+	}
+
+	sessions, err := s.sessionRepo.ListActive(userID)
+	if err != nil {
+		return err
+	}
+
+	// 会话记录随用户级联删除，删除成功后令牌即失效；删除失败时账户与会话保持不变
+	if err := s.userRepo.Delete(userID, deleteSentMessages); err != nil {
+		return err
+	}
+
+	// 通过用户服务吊销已删除的会话，以便触发断开 WebSocket 连接的回调
+	for _, session := range sessions {
+		if err := s.userService.RevokeSession(session.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *accountService) Export(userID int) (*model.AccountExport, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &model.AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile:    user,
+	}
+
+	exists, err := s.keyRepo.Exists(userID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		export.PublicKey = &model.PublicKeyInfo{}
+		if export.PublicKey.PublicKey, err = s.keyRepo.Get(userID); err != nil {
+			return nil, err
+		}
+		if export.PublicKey.CipherSuites, err = s.keyRepo.GetCipherSuites(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	// 没有上传过备份时为空
+	if export.KeyBackup, err = s.keyBackupRepo.Get(userID); err != nil {
+		return nil, err
+	}
+
+	twoFactor, err := s.twoFactorRepo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	export.TwoFactorEnabled = twoFactor != nil && twoFactor.Enabled
+
+	if export.Sessions, err = s.sessionRepo.ListActive(userID); err != nil {
+		return nil, err
+	}
+	if export.Messages, err = s.messageService.GetAllMessages(userID); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func (s *accountService) verifyPassword(userID int, password string) error {
+	hashedPassword, err := s.userRepo.GetPasswordHash(userID)
+	if err != nil {
+		return err
+	}
+	if !s.userRepo.VerifyPassword(hashedPassword, password) {
+		return ErrWrongPassword
+	}
+	return nil
+}
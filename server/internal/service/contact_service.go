@@ -0,0 +1,260 @@
+package service
+
+import (
+	"errors"
+
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+)
+
+var (
+	// ErrContactSelf 不能添加或拉黑自己
+	ErrContactSelf = errors.New("cannot add or block yourself")
+	// ErrContactUserNotFound 目标用户不存在
+	ErrContactUserNotFound = errors.New("user not found")
+	// ErrAlreadyContact 已经是联系人
+	ErrAlreadyContact = errors.New("already a contact")
+	// ErrContactRequestBlocked 任一方拉黑了另一方
+	ErrContactRequestBlocked = errors.New("cannot send a contact request to this user")
+	// ErrContactRequestNotFound 好友请求不存在或不属于当前用户
+	ErrContactRequestNotFound = errors.New("contact request not found")
+)
+
+// ContactService 联系人服务接口
+type ContactService interface {
+	ListContacts(userID int) ([]model.UserPublicInfo, error)
+	// OnlineContacts 在线的联系人ID
+	OnlineContacts(userID int) ([]int, error)
+	RemoveContact(userID, contactID int) error
+
+	ListRequests(userID int) (*model.ContactRequests, error)
+	// SendRequest 按用户ID或用户名发送好友请求；对方已向自己发出请求时直接成为联系人，accepted 为 true
+	SendRequest(userID, targetID int, targetUsername string) (request *model.ContactRequest, accepted bool, err error)
+	AcceptRequest(userID, requestID int) error
+	// DeclineRequest 拒绝收到的请求或撤回发出的请求
+	DeclineRequest(userID, requestID int) error
+
+	ListBlocked(userID int) ([]model.UserPublicInfo, error)
+	Block(userID, blockedID int) error
+	Unblock(userID, blockedID int) error
+}
+
+type contactService struct {
+	contactRepo  repository.ContactRepository
+	userRepo     repository.UserRepository
+	sealedSender SealedSenderService
+	wsService    WebSocketService
+}
+
+// NewContactService 创建联系人服务实例
+func NewContactService(
+	contactRepo repository.ContactRepository,
+	userRepo repository.UserRepository,
+	sealedSender SealedSenderService,
+	wsService WebSocketService,
+) ContactService {
+	return &contactService{
+		contactRepo:  contactRepo,
+		userRepo:     userRepo,
+		sealedSender: sealedSender,
+		wsService:    wsService,
+	}
+}
+
+func (s *contactService) ListContacts(userID int) ([]model.UserPublicInfo, error) {
+	contacts, err := s.contactRepo.ListContacts(userID)
+	if err != nil {
+		return nil, err
+	}
+	return publicInfos(contacts), nil
+}
+
+func (s *contactService) OnlineContacts(userID int) ([]int, error) {
+	contactIDs, err := s.contactRepo.ContactIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.wsService.FilterOnline(contactIDs), nil
+}
+
+func (s *contactService) RemoveContact(userID, contactID int) error {
+	if err := s.contactRepo.RemoveContact(userID, contactID); err != nil {
+		return err
+	}
+
+	s.notifyRemoved(userID, contactID)
+	return nil
+}
+
+func (s *contactService) ListRequests(userID int) (*model.ContactRequests, error) {
+	return s.contactRepo.ListRequests(userID)
+}
+
+func (s *contactService) SendRequest(userID, targetID int, targetUsername string) (*model.ContactRequest, bool, error) {
+	target, err := s.resolveUser(targetID, targetUsername)
+	if err != nil {
+		return nil, false, err
+	}
+	if target.ID == userID {
+		return nil, false, ErrContactSelf
+	}
+
+	blocked, err := s.contactRepo.IsBlocked(userID, target.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if blocked {
+		return nil, false, ErrContactRequestBlocked
+	}
+
+	isContact, err := s.contactRepo.IsContact(userID, target.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if isContact {
+		return nil, false, ErrAlreadyContact
+	}
+
+	// 对方已发出请求，视为接受
+	reverse, err := s.contactRepo.FindRequest(target.ID, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if reverse != nil {
+		if err := s.addContact(userID, target.ID); err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	}
+
+	request, err := s.contactRepo.CreateRequest(userID, target.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	targetInfo := publicInfo(target)
+	request.User = &targetInfo
+
+	if sender, err := s.userRepo.GetByID(userID); err == nil {
+		senderInfo := publicInfo(sender)
+		s.wsService.SendToUser(target.ID, model.WSMessage{
+			Type:     "contact_request",
+			SenderID: userID,
+			Profile:  &senderInfo,
+		})
+	}
+
+	return request, false, nil
+}
+
+func (s *contactService) AcceptRequest(userID, requestID int) error {
+	request, err := s.contactRepo.GetRequest(requestID)
+	if err != nil || request.ToUserID != userID {
+		return ErrContactRequestNotFound
+	}
+
+	return s.addContact(userID, request.FromUserID)
+}
+
+func (s *contactService) DeclineRequest(userID, requestID int) error {
+	request, err := s.contactRepo.GetRequest(requestID)
+	if err != nil || (request.ToUserID != userID && request.FromUserID != userID) {
+		return ErrContactRequestNotFound
+	}
+
+	return s.contactRepo.DeleteRequest(requestID)
+}
+
+func (s *contactService) ListBlocked(userID int) ([]model.UserPublicInfo, error) {
+	blocked, err := s.contactRepo.ListBlocked(userID)
+	if err != nil {
+		return nil, err
+	}
+	return publicInfos(blocked), nil
+}
+
+func (s *contactService) Block(userID, blockedID int) error {
+	if blockedID == userID {
+		return ErrContactSelf
+	}
+	if _, err := s.userRepo.GetByID(blockedID); err != nil {
+		return ErrContactUserNotFound
+	}
+
+	wasContact, err := s.contactRepo.IsContact(userID, blockedID)
+	if err != nil {
+		return err
+	}
+	if err := s.contactRepo.Block(userID, blockedID); err != nil {
+		return err
+	}
+
+	// 双方可能已从信封中获知对方的投递令牌，全部吊销，避免绕过拉黑密封发送
+	for _, id := range []int{userID, blockedID} {
+		if err := revokeDeliveryToken(s.sealedSender, s.wsService, id); err != nil {
+			return err
+		}
+	}
+
+	// 拉黑会解除联系人关系，对方只会看到联系人被移除
+	if wasContact {
+		s.notifyRemoved(userID, blockedID)
+	}
+	return nil
+}
+
+func (s *contactService) Unblock(userID, blockedID int) error {
+	return s.contactRepo.Unblock(userID, blockedID)
+}
+
+// resolveUser 优先按用户ID查找，否则按用户名查找
+func (s *contactService) resolveUser(userID int, username string) (*model.User, error) {
+	var user *model.User
+	var err error
+	if userID != 0 {
+		user, err = s.userRepo.GetByID(userID)
+	} else {
+		user, err = s.userRepo.GetByUsername(username)
+	}
+	if err != nil {
+		return nil, ErrContactUserNotFound
+	}
+	return user, nil
+}
+
+// addContact 双向添加联系人，并通知双方的所有在线设备
+func (s *contactService) addContact(userID, contactID int) error {
+	if err := s.contactRepo.AddContact(userID, contactID); err != nil {
+		return err
+	}
+
+	// 联系人已添加，查询资料失败时只是不发通知
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil
+	}
+	contact, err := s.userRepo.GetByID(contactID)
+	if err != nil {
+		return nil
+	}
+
+	userInfo, contactInfo := publicInfo(user), publicInfo(contact)
+	s.wsService.SendToUser(userID, model.WSMessage{Type: "contact_added", SenderID: contactID, Profile: &contactInfo})
+	s.wsService.SendToUser(contactID, model.WSMessage{Type: "contact_added", SenderID: userID, Profile: &userInfo})
+	return nil
+}
+
+// notifyRemoved 通知双方联系人已被移除
+func (s *contactService) notifyRemoved(userID, contactID int) {
+	s.wsService.SendToUser(userID, model.WSMessage{Type: "contact_removed", SenderID: contactID})
+	s.wsService.SendToUser(contactID, model.WSMessage{Type: "contact_removed", SenderID: userID})
+}
+
+// publicInfos 批量转换为用户公开信息
+func publicInfos(users []model.User) []model.UserPublicInfo {
+	result := []model.UserPublicInfo{}
+	for i := range users {
+		result = append(result, publicInfo(&users[i]))
+	}
+	return result
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	gocrypto "crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"im-system/server/internal/config"
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+	"im-system/server/pkg/crypto"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// JWTKeyService 访问令牌签名密钥服务接口
+type JWTKeyService interface {
+	// Sign 使用当前密钥签名，令牌头部带 kid
+	Sign(claims jwt.Claims) (string, error)
+	// Parse 按 kid 选择当前或上一个密钥校验令牌
+	Parse(tokenString string, claims jwt.Claims) error
+	// JWKS 返回仍在使用的签名公钥
+	JWKS() []crypto.SigningJWK
+	// Run 定期检查并轮换签名密钥，直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+const (
+	// jwtKeysRetained 保留用于校验的密钥数量（当前密钥与上一个密钥）
+	jwtKeysRetained = 2
+	// jwtKeyCheckInterval 检查轮换与重新加载密钥的间隔
+	jwtKeyCheckInterval = time.Minute
+	// jwtKeyReloadInterval 遇到未知 kid 时重新加载密钥的最小间隔
+	jwtKeyReloadInterval = 10 * time.Second
+)
+
+// jwtSigningKey 已解析的签名密钥
+type jwtSigningKey struct {
+	kid    string
+	signer gocrypto.Signer
+}
+
+type jwtKeyService struct {
+	repo       repository.JWTKeyRepository
+	algorithm  string
+	method     jwt.SigningMethod
+	secret     []byte // 仅 HS256 使用
+	encryption []byte // 加密数据库中签名私钥的密钥
+	rotation   time.Duration
+	keys       []jwtSigningKey // 按创建时间倒序，第一个为当前密钥
+	lastReload time.Time
+	mu         sync.RWMutex
+}
+
+// NewJWTKeyService 创建签名密钥服务实例，没有可用密钥时立即生成
+func NewJWTKeyService(repo repository.JWTKeyRepository, cfg *config.Config) (JWTKeyService, error) {
+	method := jwt.GetSigningMethod(cfg.JWTAlgorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.JWTAlgorithm)
+	}
+
+	s := &jwtKeyService{
+		repo:      repo,
+		algorithm: cfg.JWTAlgorithm,
+		method:    method,
+		rotation:  time.Duration(cfg.JWTKeyRotationHours) * time.Hour,
+	}
+
+	// HS256 为兼容旧部署保留，使用 JWT_SECRET 签名，不轮换也不发布公钥
+	if cfg.JWTAlgorithm == jwt.SigningMethodHS256.Alg() {
+		s.secret = []byte(cfg.JWTSecret)
+		return s, nil
+	}
+
+	encryption, err := base64.StdEncoding.DecodeString(cfg.JWTKeyEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT_KEY_ENCRYPTION_KEY: %w", err)
+	}
+	s.encryption = encryption
+
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *jwtKeyService) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.secret != nil {
+		return token.SignedString(s.secret)
+	}
+
+	s.mu.RLock()
+	current := s.keys[0]
+	s.mu.RUnlock()
+
+	token.Header["kid"] = current.kid
+	return token.SignedString(current.signer)
+}
+
+func (s *jwtKeyService) Parse(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keyfunc, jwt.WithValidMethods([]string{s.algorithm}))
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+// keyfunc 按 kid 查找校验公钥，未知 kid 可能来自其他实例刚轮换的密钥，重新加载一次
+func (s *jwtKeyService) keyfunc(token *jwt.Token) (interface{}, error) {
+	if s.secret != nil {
+		return s.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := s.lookup(kid); ok {
+		return key.signer.Public(), nil
+	}
+
+	if s.reloadThrottled() {
+		if key, ok := s.lookup(kid); ok {
+			return key.signer.Public(), nil
+		}
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+func (s *jwtKeyService) lookup(kid string) (jwtSigningKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.keys {
+		if key.kid == kid {
+			return key, true
+		}
+	}
+	return jwtSigningKey{}, false
+}
+
+func (s *jwtKeyService) JWKS() []crypto.SigningJWK {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jwks := make([]crypto.SigningJWK, 0, len(s.keys))
+	for _, key := range s.keys {
+		jwk, err := crypto.EncodeSigningJWK(key.kid, s.algorithm, key.signer.Public())
+		if err != nil {
+			log.Printf("Failed to encode JWT signing key %s: %v", key.kid, err)
+			continue
+		}
+		jwks = append(jwks, *jwk)
+	}
+	return jwks
+}
+
+func (s *jwtKeyService) Run(ctx context.Context) {
+	if s.secret != nil {
+		return
+	}
+
+	ticker := time.NewTicker(jwtKeyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.rotate(); err != nil {
+				log.Printf("Failed to rotate JWT signing key: %v", err)
+			}
+		}
+	}
+}
+
+// rotate 当前密钥超过轮换周期时生成新密钥（由数据库判断，避免实例间时钟差异），然后重新加载
+func (s *jwtKeyService) rotate() error {
+	privateKeyPEM, err := crypto.GenerateJWTSigningKey(s.algorithm)
+	if err != nil {
+		return err
+	}
+	kid := uuid.New().String()
+	encrypted, err := crypto.EncryptJWTSigningKey(s.encryption, kid, privateKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	created, err := s.repo.CreateIfDue(&model.JWTKey{
+		KID:        kid,
+		Algorithm:  s.algorithm,
+		PrivateKey: encrypted,
+	}, int(s.rotation.Seconds()))
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("Rotated JWT signing key (%s)", s.algorithm)
+	}
+
+	return s.reload()
+}
+
+// reloadThrottled 限制未知 kid 触发的重新加载频率，返回是否已重新加载
+func (s *jwtKeyService) reloadThrottled() bool {
+	s.mu.Lock()
+	if time.Since(s.lastReload) < jwtKeyReloadInterval {
+		s.mu.Unlock()
+		return false
+	}
+	s.lastReload = time.Now()
+	s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		log.Printf("Failed to reload JWT signing keys: %v", err)
+		return false
+	}
+	return true
+}
+
+// reload 从数据库加载当前密钥与上一个密钥
+func (s *jwtKeyService) reload() error {
+	stored, err := s.repo.ListRecent(s.algorithm, jwtKeysRetained)
+	if err != nil {
+		return err
+	}
+	if len(stored) == 0 {
+		return errors.New("no JWT signing key available")
+	}
+
+	keys := make([]jwtSigningKey, 0, len(stored))
+	for _, key := range stored {
+		privateKeyPEM, legacy, err := crypto.DecryptJWTSigningKey(s.encryption, key.KID, key.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("invalid JWT signing key %s: %w", key.KID, err)
+		}
+		signer, err := crypto.ParseJWTSigningKey(key.Algorithm, privateKeyPEM)
+		if err != nil {
+			return fmt.Errorf("invalid JWT signing key %s: %w", key.KID, err)
+		}
+		keys = append(keys, jwtSigningKey{kid: key.KID, signer: signer})
+		if legacy {
+			s.encryptLegacyKey(key.KID, privateKeyPEM)
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+	return nil
+}
+
+// encryptLegacyKey 将旧版明文保存的签名私钥改为加密保存，失败时下次加载再试
+func (s *jwtKeyService) encryptLegacyKey(kid, privateKeyPEM string) {
+	encrypted, err := crypto.EncryptJWTSigningKey(s.encryption, kid, privateKeyPEM)
+	if err == nil {
+		err = s.repo.UpdatePrivateKey(kid, encrypted)
+	}
+	if err != nil {
+		log.Printf("Failed to encrypt legacy JWT signing key %s: %v", kid, err)
+		return
+	}
+	log.Printf("Encrypted legacy JWT signing key %s", kid)
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	"im-system/server/internal/config"
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+	"im-system/server/pkg/ratelimit"
+)
+
+// maxKeyBackupSize 单个备份密文的最大长度
+const maxKeyBackupSize = 64 * 1024
+
+var (
+	// ErrKeyBackupNotFound 用户没有上传过备份
+	ErrKeyBackupNotFound = &KeyError{"key backup not found"}
+	// ErrKeyBackupTooLarge 备份密文超过大小限制
+	ErrKeyBackupTooLarge = &KeyError{"key backup is too large"}
+	// ErrKeyBackupRateLimited 备份下载过于频繁
+	ErrKeyBackupRateLimited = &KeyError{"too many key backup retrievals, try again later"}
+)
+
+// KeyBackupService 私钥加密备份服务接口
+// 备份由客户端使用恢复口令加密，服务端只保存密文，并限制下载频率以减缓离线猜测
+type KeyBackupService interface {
+	UploadBackup(userID int, backup string) error
+	GetBackup(userID int) (*model.KeyBackup, time.Duration, error)
+	DeleteBackup(userID int) error
+}
+
+type keyBackupService struct {
+	repo    repository.KeyBackupRepository
+	limiter ratelimit.Limiter
+}
+
+// NewKeyBackupService 创建私钥备份服务实例
+func NewKeyBackupService(repo repository.KeyBackupRepository, limits ratelimit.Store, cfg *config.Config) KeyBackupService {
+	perHour := cfg.KeyBackupRetrievalsPerHour
+	return &keyBackupService{
+		repo:    repo,
+		limiter: limits.NewTokenBucket("key_backup", time.Hour/time.Duration(perHour), perHour),
+	}
+}
+
+func (s *keyBackupService) UploadBackup(userID int, backup string) error {
+	if len(backup) > maxKeyBackupSize {
+		return ErrKeyBackupTooLarge
+	}
+	return s.repo.Save(userID, backup)
+}
+
+// GetBackup 下载备份密文，超过频率限制时返回需要等待的时间
+func (s *keyBackupService) GetBackup(userID int) (*model.KeyBackup, time.Duration, error) {
+	if ok, retryAfter := s.limiter.Allow(strconv.Itoa(userID)); !ok {
+		return nil, retryAfter, ErrKeyBackupRateLimited
+	}
+
+	backup, err := s.repo.Get(userID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if backup == nil {
+		return nil, 0, ErrKeyBackupNotFound
+	}
+	return backup, 0, nil
+}
+
+func (s *keyBackupService) DeleteBackup(userID int) error {
+	return s.repo.Delete(userID)
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"sync"
+	"time"
+
+	"im-system/server/internal/config"
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+	"im-system/server/pkg/crypto"
+	"im-system/server/pkg/logger"
+	"im-system/shared/merkle"
+)
+
+// KeyLogService 公钥透明日志服务接口
+type KeyLogService interface {
+	Append(userID int, publicKey string) (*model.KeyLogEntry, error)
+	Backfill() error
+	GetSignedTreeHead() (*model.SignedTreeHead, error)
+	GetInclusionProof(userID int, treeSize int64) (*model.InclusionProof, error)
+	GetConsistencyProof(first, second int64) (*model.ConsistencyProof, error)
+	GetPublicKey() (string, error)
+}
+
+type keyLogService struct {
+	repo       repository.KeyLogRepository
+	signingKey ed25519.PrivateKey
+
+	// 叶子哈希与全部完全子树根的内存缓存，按需从数据库增量同步，证明无需重算全部叶子
+	tree merkle.Tree
+	mu   sync.Mutex
+}
+
+// NewKeyLogService 创建公钥透明日志服务实例
+// 未配置签名私钥时自动生成并保存到数据库，保证重启后客户端固定的日志公钥仍然有效
+func NewKeyLogService(
+	repo repository.KeyLogRepository,
+	signingKeyRepo repository.SigningKeyRepository,
+	cfg *config.Config,
+) (KeyLogService, error) {
+	signingKey, err := loadSigningKey(signingKeyRepo, "keylog", cfg.KeyLogSigningKey, "KEYLOG_SIGNING_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyLogService{
+		repo:       repo,
+		signingKey: signingKey,
+	}, nil
+}
+
+// KeyLogLeafData 构造日志叶子数据（客户端按同样方式重建叶子）
+func KeyLogLeafData(userID int, publicKey string) []byte {
+	return []byte(fmt.Sprintf("%d\n%s", userID, publicKey))
+}
+
+// keyLogLeafHash 公钥对应的日志叶子哈希
+func keyLogLeafHash(userID int, publicKey string) []byte {
+	return merkle.LeafHash(KeyLogLeafData(userID, publicKey))
+}
+
+func (s *keyLogService) Append(userID int, publicKey string) (*model.KeyLogEntry, error) {
+	return s.repo.Append(userID, publicKey, keyLogLeafHash(userID, publicKey))
+}
+
+// Backfill 将引入日志之前上传的公钥补记到日志中
+func (s *keyLogService) Backfill() error {
+	keys, err := s.repo.GetUnloggedKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if _, err := s.Append(key.UserID, key.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	if len(keys) > 0 {
+		logger.Info(fmt.Sprintf("Backfilled %d public keys into the key log", len(keys)))
+	}
+	return nil
+}
+
+func (s *keyLogService) GetSignedTreeHead() (*model.SignedTreeHead, error) {
+	s.mu.Lock()
+	if err := s.sync(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	size, root := s.tree.Size(), s.tree.Root()
+	s.mu.Unlock()
+
+	sth := &model.SignedTreeHead{
+		TreeSize:  size,
+		Timestamp: time.Now().UnixMilli(),
+		RootHash:  root,
+	}
+	sth.Signature = ed25519.Sign(s.signingKey, merkle.TreeHeadSignatureInput(sth.TreeSize, sth.Timestamp, sth.RootHash))
+
+	return sth, nil
+}
+
+// GetInclusionProof 用户在 treeSize 大小的树中最新公钥的包含性证明，
+// 与树头对应，之后追加的公钥不影响对该树头的校验
+func (s *keyLogService) GetInclusionProof(userID int, treeSize int64) (*model.InclusionProof, error) {
+	if err := s.checkTreeSize(treeSize); err != nil {
+		return nil, err
+	}
+
+	entry, err := s.repo.GetLatestForUser(userID, treeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// 树只追加，checkTreeSize 之后 treeSize 始终有效
+	s.mu.Lock()
+	auditPath := s.tree.InclusionProof(entry.LeafIndex, treeSize)
+	s.mu.Unlock()
+
+	return &model.InclusionProof{
+		LeafIndex: entry.LeafIndex,
+		TreeSize:  treeSize,
+		UserID:    entry.UserID,
+		PublicKey: entry.PublicKey,
+		AuditPath: auditPath,
+	}, nil
+}
+
+func (s *keyLogService) GetConsistencyProof(first, second int64) (*model.ConsistencyProof, error) {
+	if first <= 0 || first > second {
+		return nil, ErrInvalidTreeSize
+	}
+	if err := s.checkTreeSize(second); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	proof := s.tree.ConsistencyProof(first, second)
+	s.mu.Unlock()
+
+	return &model.ConsistencyProof{
+		First:  first,
+		Second: second,
+		Proof:  proof,
+	}, nil
+}
+
+func (s *keyLogService) GetPublicKey() (string, error) {
+	return crypto.EncodeSigningPublicKey(s.signingKey.Public().(ed25519.PublicKey))
+}
+
+// checkTreeSize 同步日志后校验 treeSize 不超过当前树大小
+func (s *keyLogService) checkTreeSize(treeSize int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.sync(); err != nil {
+		return err
+	}
+	if treeSize <= 0 || treeSize > s.tree.Size() {
+		return ErrInvalidTreeSize
+	}
+	return nil
+}
+
+// sync 从数据库加载新追加的叶子哈希并增量更新树，调用方需持有 s.mu
+func (s *keyLogService) sync() error {
+	newLeaves, err := s.repo.GetLeafHashes(s.tree.Size())
+	if err != nil {
+		return err
+	}
+	for _, leaf := range newLeaves {
+		s.tree.Append(leaf)
+	}
+	return nil
+}
+
+var ErrInvalidTreeSize = &KeyError{"invalid tree size"}
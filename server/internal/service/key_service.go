@@ -3,13 +3,15 @@ package service
 import (
 	"im-system/server/internal/repository"
 	"im-system/server/pkg/crypto"
+	"im-system/shared/keyencoding"
 )
 
 // KeyService 密钥服务接口
 type KeyService interface {
 	GenerateKeys(userID int) (publicKey, privateKey string, err error)
-	UploadPublicKey(userID int, publicKey string) error
+	UploadPublicKey(userID int, publicKey string, cipherSuites []int) error
 	GetPublicKey(userID int) (string, error)
+	GetCipherSuites(userID int) ([]int, error)
 }
 
 type keyService struct {
@@ -47,29 +49,75 @@ func (s *keyService) GenerateKeys(userID int) (string, string, error) {
 		return "", "", err
 	}
 
-	// 保存公钥
-	if err := s.repo.Save(userID, publicKey); err != nil {
+	// 保存公钥并记录到公钥透明日志（服务端生成的密钥对由旧版客户端使用，不公布加密套件）
+	if err := s.repo.Save(userID, publicKey, nil, keyLogLeafHash(userID, publicKey)); err != nil {
 		return "", "", err
 	}
 
 	return publicKey, privateKey, nil
 }
 
-func (s *keyService) UploadPublicKey(userID int, publicKey string) error {
+func (s *keyService) UploadPublicKey(userID int, publicKey string, cipherSuites []int) error {
 	// 检查用户是否存在
 	_, err := s.userRepo.GetByID(userID)
 	if err != nil {
 		return err
 	}
 
-	return s.repo.Save(userID, publicKey)
+	// 接受 PKIX/旧版 PEM 或 JWK，统一保存为 PKIX PEM
+	publicKey, err = keyencoding.NormalizePublicKey(publicKey)
+	if err != nil {
+		return ErrInvalidPublicKey
+	}
+
+	suites, err := compatibleSuites(publicKey, cipherSuites)
+	if err != nil {
+		return err
+	}
+
+	// 每次上传都在同一事务中记录到公钥透明日志，便于发现公钥被替换
+	return s.repo.Save(userID, publicKey, suites, keyLogLeafHash(userID, publicKey))
 }
 
 func (s *keyService) GetPublicKey(userID int) (string, error) {
 	return s.repo.Get(userID)
 }
 
+func (s *keyService) GetCipherSuites(userID int) ([]int, error) {
+	return s.repo.GetCipherSuites(userID)
+}
+
+// compatibleSuites 保留已知且与公钥曲线匹配的加密套件，顺序不变
+func compatibleSuites(publicKey string, cipherSuites []int) ([]int, error) {
+	available, err := crypto.SuitesForKey(publicKey)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	// 未公布套件视为旧版客户端（只支持 P-256）；其他曲线的公钥默认公布全部匹配的套件
+	if len(cipherSuites) == 0 && available[0] != crypto.SuiteP256AES256GCM {
+		for _, id := range available {
+			cipherSuites = append(cipherSuites, int(id))
+		}
+	}
+
+	var result []int
+	for _, id := range crypto.ParseSuiteIDs(cipherSuites) {
+		for _, candidate := range available {
+			if id == candidate {
+				result = append(result, int(id))
+			}
+		}
+	}
+	if len(cipherSuites) > 0 && len(result) == 0 {
+		return nil, ErrUnsupportedCipherSuites
+	}
+	return result, nil
+}
+
 var ErrKeyAlreadyExists = &KeyError{"public key already exists"}
+var ErrInvalidPublicKey = &KeyError{"invalid public key, expected a P-256 or X25519 key in PEM or JWK format"}
+var ErrUnsupportedCipherSuites = &KeyError{"none of the cipher suites match the public key"}
 
 type KeyError struct {
 	Message string
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"im-system/server/internal/model"
+	"im-system/server/internal/queue"
+
+	"github.com/google/uuid"
+)
+
+// ErrPipelineBusy 消息队列积压，发送方稍后重试
+var ErrPipelineBusy = errors.New("server is busy, please retry later")
+
+// MessagePipeline 消息接收与持久化解耦：接收时校验后按会话写入队列，
+// 消费者按会话顺序写入数据库，推送由发件箱完成
+type MessagePipeline interface {
+	// Submit 校验并将消息追加到队列，队列积压时最多等待 submitTimeout，超时返回 ErrPipelineBusy；
+	// 带 clientMessageID 的消息重复提交时只保存一次；未带时生成一个，队列重复投递时同样只保存一次
+	Submit(senderID, receiverID int, content, clientMessageID string) error
+	// OnDeliver 注册推送回调，写入数据库失败时向发送者推送 error 事件
+	OnDeliver(deliver func(userID int, msg model.WSMessage) bool)
+	// Run 消费队列直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+const (
+	// submitTimeout 队列积压时写入的最长等待时间
+	submitTimeout = 5 * time.Second
+	// maxPersistAttempts 写入数据库失败时的最大尝试次数，之后放弃并通知发送者
+	maxPersistAttempts = 5
+	// persistRetryDelay 首次重试前的等待时间，之后每次翻倍
+	persistRetryDelay = 200 * time.Millisecond
+)
+
+type messagePipeline struct {
+	queue          queue.Queue
+	messageService MessageService
+	deliver        func(userID int, msg model.WSMessage) bool
+}
+
+// NewMessagePipeline 创建消息处理管道
+func NewMessagePipeline(messageQueue queue.Queue, messageService MessageService) MessagePipeline {
+	return &messagePipeline{
+		queue:          messageQueue,
+		messageService: messageService,
+		deliver:        func(int, model.WSMessage) bool { return false },
+	}
+}
+
+func (p *messagePipeline) Submit(senderID, receiverID int, content, clientMessageID string) error {
+	// 接收时校验，发送者立即得到拒绝原因；写入数据库前会再次校验
+	clientMessageID, err := normalizeClientMessageID(clientMessageID)
+	if err != nil {
+		return err
+	}
+	// 队列至少投递一次，写入前生成幂等键，重复投递的记录不会保存为两条消息
+	if clientMessageID == "" {
+		clientMessageID = uuid.New().String()
+	}
+	if err := p.messageService.CheckRecipient(senderID, receiverID); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(&model.QueuedMessage{
+		SenderID:        senderID,
+		ReceiverID:      receiverID,
+		Content:         content,
+		ClientMessageID: clientMessageID,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), submitTimeout)
+	defer cancel()
+	if err := p.queue.Produce(ctx, conversationKey(senderID, receiverID), value); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrPipelineBusy
+		}
+		return err
+	}
+	return nil
+}
+
+func (p *messagePipeline) OnDeliver(deliver func(userID int, msg model.WSMessage) bool) {
+	p.deliver = deliver
+}
+
+func (p *messagePipeline) Run(ctx context.Context) {
+	// 消费中断（如 Kafka 不可用）时稍后重试
+	for {
+		err := p.queue.Consume(ctx, p.handle)
+		if err == queue.ErrQueueClosed {
+			return
+		}
+		if err != nil {
+			log.Printf("Message queue consumer failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// handle 写入数据库，消息与推送事件在同一事务中写入，由发件箱推送给接收者并向发送者确认
+func (p *messagePipeline) handle(ctx context.Context, record *queue.Record) {
+	var msg model.QueuedMessage
+	if err := json.Unmarshal(record.Value, &msg); err != nil {
+		log.Printf("Dropping malformed queued message: %v", err)
+		return
+	}
+
+	if _, err := p.persist(ctx, &msg); err != nil {
+		// ctx 结束时不通知，记录重启后重新投递
+		if ctx.Err() != nil {
+			return
+		}
+		content := "Failed to save message"
+		if isRejected(err) {
+			content = err.Error()
+		}
+		p.deliver(msg.SenderID, model.WSMessage{
+			Type:            "error",
+			ReceiverID:      msg.ReceiverID,
+			ClientMessageID: msg.ClientMessageID,
+			Content:         content,
+		})
+	}
+}
+
+// persist 写入数据库，数据库暂时不可用时按指数退避重试；被拒绝（黑名单、隐私设置、客户端消息ID冲突）时不重试
+func (p *messagePipeline) persist(ctx context.Context, msg *model.QueuedMessage) (int, error) {
+	delay := persistRetryDelay
+	for attempt := 1; ; attempt++ {
+		messageID, err := p.messageService.SendMessage(msg.SenderID, msg.ReceiverID, msg.Content, msg.ClientMessageID)
+		if err == nil || isRejected(err) || attempt == maxPersistAttempts {
+			return messageID, err
+		}
+		log.Printf("Failed to save message from %d to %d (attempt %d): %v", msg.SenderID, msg.ReceiverID, attempt, err)
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isRejected 消息被拒绝保存，重试也不会成功
+func isRejected(err error) bool {
+	return err == ErrMessageBlocked || err == ErrContactsOnly || err == ErrClientMessageIDReused
+}
+
+// conversationKey 会话的分区键，双方互发的消息进入同一分区
+func conversationKey(userID1, userID2 int) string {
+	if userID1 > userID2 {
+		userID1, userID2 = userID2, userID1
+	}
+	return fmt.Sprintf("%d:%d", userID1, userID2)
+}
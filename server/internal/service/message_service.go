@@ -1,40 +1,144 @@
 package service
 
 import (
+	"errors"
+
 	"im-system/server/internal/model"
 	"im-system/server/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrMessageBlocked 任一方拉黑了另一方
+	ErrMessageBlocked = errors.New("cannot send messages to this user")
+	// ErrContactsOnly 接收者只接受联系人的消息
+	ErrContactsOnly = errors.New("this user only accepts messages from contacts")
+	// ErrInvalidClientMessageID 客户端消息ID不是 UUID
+	ErrInvalidClientMessageID = errors.New("client_message_id must be a UUID")
+	// ErrClientMessageIDReused 客户端消息ID已用于接收方或内容不同的消息
+	ErrClientMessageIDReused = repository.ErrClientMessageIDReused
 )
 
 // MessageService 消息服务接口
 type MessageService interface {
-	SendMessage(senderID, receiverID int, encryptedContent string) (int, error)
+	// CheckRecipient 校验接收者存在且接受发送者的消息
+	CheckRecipient(senderID, receiverID int) error
+	// SendMessage 保存消息；clientMessageID 可选，同一发送方重复发送时返回已有消息ID
+	SendMessage(senderID, receiverID int, encryptedContent, clientMessageID string) (int, error)
+	SendSealedMessage(receiverID int, encryptedContent string) (int, error)
 	GetUnreadMessages(userID int) ([]model.MessageDTO, error)
 	MarkAsRead(messageID int) error
 	GetConversation(userID1, userID2 int, limit int) ([]model.MessageDTO, error)
+	// GetAllMessages 获取用户发出和收到的全部消息，用于数据导出
+	GetAllMessages(userID int) ([]model.MessageDTO, error)
 }
 
 type messageService struct {
-	repo     repository.MessageRepository
-	userRepo repository.UserRepository
+	repo        repository.MessageRepository
+	userRepo    repository.UserRepository
+	contactRepo repository.ContactRepository
+	outbox      OutboxDispatcher
 }
 
-// NewMessageService 创建消息服务实例
-func NewMessageService(repo repository.MessageRepository, userRepo repository.UserRepository) MessageService {
+// NewMessageService 创建消息服务实例，保存的消息由 outbox 推送
+func NewMessageService(
+	repo repository.MessageRepository,
+	userRepo repository.UserRepository,
+	contactRepo repository.ContactRepository,
+	outbox OutboxDispatcher,
+) MessageService {
 	return &messageService{
-		repo:     repo,
-		userRepo: userRepo,
+		repo:        repo,
+		userRepo:    userRepo,
+		contactRepo: contactRepo,
+		outbox:      outbox,
+	}
+}
+
+func (s *messageService) SendMessage(senderID, receiverID int, encryptedContent, clientMessageID string) (int, error) {
+	clientMessageID, err := normalizeClientMessageID(clientMessageID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.CheckRecipient(senderID, receiverID); err != nil {
+		return 0, err
+	}
+
+	// 保存消息，推送给接收方与发送确认随消息写入发件箱
+	messageID, err := s.repo.Save(senderID, receiverID, encryptedContent, clientMessageID)
+	if err != nil {
+		return 0, err
 	}
+	s.outbox.Notify()
+	return messageID, nil
 }
 
-func (s *messageService) SendMessage(senderID, receiverID int, encryptedContent string) (int, error) {
+func (s *messageService) CheckRecipient(senderID, receiverID int) error {
 	// 验证接收者存在
-	_, err := s.userRepo.GetByID(receiverID)
+	if _, err := s.userRepo.GetByID(receiverID); err != nil {
+		return err
+	}
+	return s.checkAllowed(senderID, receiverID)
+}
+
+// normalizeClientMessageID 校验客户端消息ID并转换为标准格式，为空表示不去重
+func normalizeClientMessageID(clientMessageID string) (string, error) {
+	if clientMessageID == "" {
+		return "", nil
+	}
+	id, err := uuid.Parse(clientMessageID)
+	if err != nil {
+		return "", ErrInvalidClientMessageID
+	}
+	return id.String(), nil
+}
+
+// checkAllowed 检查黑名单与接收者的消息隐私设置
+func (s *messageService) checkAllowed(senderID, receiverID int) error {
+	blocked, err := s.contactRepo.IsBlocked(senderID, receiverID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrMessageBlocked
+	}
+
+	privacy, err := s.userRepo.GetPrivacy(receiverID)
+	if err != nil {
+		return err
+	}
+	if privacy.MessagePrivacy != model.MessagePrivacyContacts {
+		return nil
+	}
+
+	isContact, err := s.contactRepo.IsContact(receiverID, senderID)
+	if err != nil {
+		return err
+	}
+	if !isContact {
+		return ErrContactsOnly
+	}
+	return nil
+}
+
+// SendSealedMessage 保存密封发送的消息（调用方已校验投递令牌）
+// 拉黑由吊销投递令牌保证；服务端无法确认匿名发送方是否为联系人，只接受联系人消息的用户不接收密封消息
+func (s *messageService) SendSealedMessage(receiverID int, encryptedContent string) (int, error) {
+	privacy, err := s.userRepo.GetPrivacy(receiverID)
 	if err != nil {
 		return 0, err
 	}
+	if privacy.MessagePrivacy == model.MessagePrivacyContacts {
+		return 0, ErrContactsOnly
+	}
 
-	// 保存消息
-	return s.repo.Save(senderID, receiverID, encryptedContent)
+	messageID, err := s.repo.SaveSealed(receiverID, encryptedContent)
+	if err != nil {
+		return 0, err
+	}
+	s.outbox.Notify()
+	return messageID, nil
 }
 
 func (s *messageService) GetUnreadMessages(userID int) ([]model.MessageDTO, error) {
@@ -43,19 +147,7 @@ func (s *messageService) GetUnreadMessages(userID int) ([]model.MessageDTO, erro
 		return nil, err
 	}
 
-	var result []model.MessageDTO
-	for _, msg := range messages {
-		result = append(result, model.MessageDTO{
-			ID:               msg.ID,
-			SenderID:         msg.SenderID,
-			ReceiverID:       msg.ReceiverID,
-			EncryptedContent: msg.EncryptedContent,
-			IsRead:           msg.IsRead,
-			CreatedAt:        msg.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
-	}
-
-	return result, nil
+	return toMessageDTOs(messages), nil
 }
 
 func (s *messageService) MarkAsRead(messageID int) error {
@@ -68,6 +160,20 @@ func (s *messageService) GetConversation(userID1, userID2 int, limit int) ([]mod
 		return nil, err
 	}
 
+	return toMessageDTOs(messages), nil
+}
+
+func (s *messageService) GetAllMessages(userID int) ([]model.MessageDTO, error) {
+	messages, err := s.repo.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toMessageDTOs(messages), nil
+}
+
+// toMessageDTOs 转换为传输对象
+func toMessageDTOs(messages []model.Message) []model.MessageDTO {
 	var result []model.MessageDTO
 	for _, msg := range messages {
 		result = append(result, model.MessageDTO{
@@ -75,10 +181,11 @@ func (s *messageService) GetConversation(userID1, userID2 int, limit int) ([]mod
 			SenderID:         msg.SenderID,
 			ReceiverID:       msg.ReceiverID,
 			EncryptedContent: msg.EncryptedContent,
+			Sealed:           msg.Sealed,
+			ClientMessageID:  msg.ClientMessageID,
 			IsRead:           msg.IsRead,
 			CreatedAt:        msg.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		})
 	}
-
-	return result, nil
+	return result
 }
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+)
+
+const (
+	// outboxPollInterval 没有新事件通知时轮询发件箱的间隔（处理其他实例写入或需要重试的事件）
+	outboxPollInterval = time.Second
+	// outboxBatchSize 每次领取的事件数；每个事件推送最长耗时 busTimeout，批次小一些使租期不至于过长
+	outboxBatchSize = 20
+	// outboxClaimLease 领取后的租期，覆盖整批事件逐个推送超时的最坏情况，租期内其他实例不会重复领取
+	outboxClaimLease = outboxBatchSize*busTimeout + 10*time.Second
+	// outboxRetryDelay 首次重试前的等待时间，之后每次翻倍，最长 outboxMaxRetryDelay
+	outboxRetryDelay    = time.Second
+	outboxMaxRetryDelay = time.Minute
+	// maxOutboxAttempts 推送失败的最大尝试次数，之后放弃（消息已保存，接收方可从未读消息中获取）
+	maxOutboxAttempts = 10
+)
+
+// OutboxDispatcher 消息发件箱调度：将与消息同一事务写入的事件推送给在线连接（本节点或经消息总线转发），
+// 推送成功后删除，失败时按指数退避重试；事件带幂等键，重复推送时客户端去重
+type OutboxDispatcher interface {
+	// Notify 有新事件写入时唤醒调度，不必等待下一次轮询
+	Notify()
+	// OnDeliver 注册推送函数，查询在线状态或转发失败时返回错误
+	OnDeliver(deliver func(userID int, msg model.WSMessage) (bool, error))
+	// Run 推送发件箱事件直到 ctx 结束
+	Run(ctx context.Context)
+}
+
+type outboxDispatcher struct {
+	repo    repository.OutboxRepository
+	deliver func(userID int, msg model.WSMessage) (bool, error)
+	wake    chan struct{}
+}
+
+// NewOutboxDispatcher 创建发件箱调度实例
+func NewOutboxDispatcher(repo repository.OutboxRepository) OutboxDispatcher {
+	return &outboxDispatcher{
+		repo:    repo,
+		deliver: func(int, model.WSMessage) (bool, error) { return false, nil },
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+func (d *outboxDispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *outboxDispatcher) OnDeliver(deliver func(userID int, msg model.WSMessage) (bool, error)) {
+	d.deliver = deliver
+}
+
+func (d *outboxDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatch()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// dispatch 领取并推送到期的事件，直到没有更多到期事件
+func (d *outboxDispatcher) dispatch() {
+	for {
+		events, err := d.repo.Claim(outboxBatchSize, outboxClaimLease)
+		if err != nil {
+			log.Printf("Failed to claim outbox events: %v", err)
+			return
+		}
+
+		var done, failed []int64
+		for _, event := range events {
+			if d.dispatchEvent(&event) {
+				done = append(done, event.ID)
+			} else {
+				failed = append(failed, event.ID)
+			}
+		}
+		// 删除失败时事件在租期结束后重新推送，客户端凭幂等键去重
+		if len(done) > 0 {
+			if err := d.repo.Delete(done); err != nil {
+				log.Printf("Failed to delete outbox events: %v", err)
+			}
+		}
+		// 推送失败的事件按尝试次数退避；更新失败时在租期结束后重试
+		if len(failed) > 0 {
+			if err := d.repo.Retry(failed, outboxRetryDelay, outboxMaxRetryDelay); err != nil {
+				log.Printf("Failed to reschedule outbox events: %v", err)
+			}
+		}
+
+		if len(events) < outboxBatchSize {
+			return
+		}
+	}
+}
+
+// dispatchEvent 推送事件，返回是否可以删除（推送成功、接收方不在线或已放弃）
+func (d *outboxDispatcher) dispatchEvent(event *model.OutboxEvent) bool {
+	online, err := d.deliver(event.UserID, outboxMessage(event))
+	if err != nil {
+		if event.Attempts >= maxOutboxAttempts {
+			log.Printf("Giving up outbox event %d after %d attempts: %v", event.ID, event.Attempts, err)
+			return true
+		}
+		log.Printf("Failed to dispatch outbox event %d (attempt %d), will retry: %v", event.ID, event.Attempts, err)
+		return false
+	}
+
+	if event.Type != model.OutboxEventMessageSent {
+		if online {
+			log.Printf("Message %d delivered to %d (online)", event.Message.ID, event.UserID)
+		} else {
+			log.Printf("Message %d saved for offline user %d", event.Message.ID, event.UserID)
+		}
+	}
+	return true
+}
+
+// outboxMessage 构造事件推送的 WebSocket 消息
+// 幂等键取发件箱记录ID：重试同一记录时不变，重复发送后新插入的确认记录则不会被当作已处理丢弃
+func outboxMessage(event *model.OutboxEvent) model.WSMessage {
+	msg := event.Message
+	wsMsg := model.WSMessage{
+		Type:      event.Type,
+		MessageID: msg.ID,
+		EventID:   fmt.Sprintf("%s:%d", event.Type, event.ID),
+	}
+
+	switch event.Type {
+	case model.OutboxEventMessageSent:
+		wsMsg.ReceiverID = msg.ReceiverID
+		wsMsg.ClientMessageID = msg.ClientMessageID
+		wsMsg.Content = "Message sent successfully"
+	case model.OutboxEventSealedMessage:
+		wsMsg.Content = msg.EncryptedContent
+		wsMsg.Timestamp = msg.CreatedAt.Format(time.RFC3339)
+	default:
+		wsMsg.SenderID = msg.SenderID
+		wsMsg.Content = msg.EncryptedContent
+		wsMsg.Timestamp = msg.CreatedAt.Format(time.RFC3339)
+	}
+	return wsMsg
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"im-system/server/internal/broker"
+	"im-system/server/internal/model"
+)
+
+// fakeOutboxRepository 进程内发件箱，按与数据库相同的规则领取与退避，时间由 now 控制
+type fakeOutboxRepository struct {
+	now    time.Time
+	events map[int64]*fakeOutboxEvent
+	leases []time.Duration
+}
+
+type fakeOutboxEvent struct {
+	event       model.OutboxEvent
+	nextAttempt time.Time
+}
+
+func newFakeOutboxRepository(events ...model.OutboxEvent) *fakeOutboxRepository {
+	r := &fakeOutboxRepository{now: time.Unix(1700000000, 0), events: make(map[int64]*fakeOutboxEvent)}
+	for _, event := range events {
+		r.events[event.ID] = &fakeOutboxEvent{event: event, nextAttempt: r.now}
+	}
+	return r
+}
+
+func (r *fakeOutboxRepository) Claim(limit int, lease time.Duration) ([]model.OutboxEvent, error) {
+	r.leases = append(r.leases, lease)
+
+	var ids []int64
+	for id, e := range r.events {
+		if !e.nextAttempt.After(r.now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	events := make([]model.OutboxEvent, 0, len(ids))
+	for _, id := range ids {
+		e := r.events[id]
+		e.event.Attempts++
+		e.nextAttempt = r.now.Add(lease)
+		events = append(events, e.event)
+	}
+	return events, nil
+}
+
+func (r *fakeOutboxRepository) Retry(ids []int64, retryDelay, maxRetryDelay time.Duration) error {
+	for _, id := range ids {
+		e := r.events[id]
+		delay := retryDelay << (e.event.Attempts - 1)
+		if delay > maxRetryDelay || delay <= 0 {
+			delay = maxRetryDelay
+		}
+		e.nextAttempt = r.now.Add(delay)
+	}
+	return nil
+}
+
+func (r *fakeOutboxRepository) Delete(ids []int64) error {
+	for _, id := range ids {
+		delete(r.events, id)
+	}
+	return nil
+}
+
+func outboxEvents(n int) []model.OutboxEvent {
+	events := make([]model.OutboxEvent, n)
+	for i := range events {
+		events[i] = model.OutboxEvent{
+			ID:      int64(i + 1),
+			UserID:  7,
+			Type:    model.OutboxEventMessage,
+			Message: model.Message{ID: i + 1, SenderID: 3, ReceiverID: 7},
+		}
+	}
+	return events
+}
+
+func TestOutboxDispatchBatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		events     int
+		wantClaims int
+	}{
+		{"empty", 0, 1},
+		{"partial batch", outboxBatchSize - 1, 1},
+		// 整批领取后再领取一次，确认没有更多到期事件
+		{"full batch", outboxBatchSize, 2},
+		{"several batches", 2*outboxBatchSize + 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeOutboxRepository(outboxEvents(tt.events)...)
+			d := NewOutboxDispatcher(repo).(*outboxDispatcher)
+			var delivered []int
+			d.OnDeliver(func(userID int, msg model.WSMessage) (bool, error) {
+				delivered = append(delivered, msg.MessageID)
+				return true, nil
+			})
+
+			d.dispatch()
+
+			if len(delivered) != tt.events {
+				t.Errorf("delivered %d events, want %d", len(delivered), tt.events)
+			}
+			if !sort.IntsAreSorted(delivered) {
+				t.Errorf("delivered out of order: %v", delivered)
+			}
+			if len(repo.events) != 0 {
+				t.Errorf("%d events left in outbox", len(repo.events))
+			}
+			if len(repo.leases) != tt.wantClaims {
+				t.Errorf("claimed %d times, want %d", len(repo.leases), tt.wantClaims)
+			}
+			for _, lease := range repo.leases {
+				if lease < outboxBatchSize*busTimeout {
+					t.Errorf("lease %v shorter than the worst case batch %v", lease, outboxBatchSize*busTimeout)
+				}
+			}
+		})
+	}
+}
+
+func TestOutboxRetryBackoff(t *testing.T) {
+	repo := newFakeOutboxRepository(outboxEvents(1)...)
+	d := NewOutboxDispatcher(repo).(*outboxDispatcher)
+	attempts := 0
+	d.OnDeliver(func(int, model.WSMessage) (bool, error) {
+		attempts++
+		return false, errors.New("bus unavailable")
+	})
+
+	var delays []time.Duration
+	for attempt := 1; attempt <= maxOutboxAttempts; attempt++ {
+		d.dispatch()
+		if attempts != attempt {
+			t.Fatalf("after dispatch %d: delivered %d times", attempt, attempts)
+		}
+		e, ok := repo.events[1]
+		if !ok {
+			if attempt != maxOutboxAttempts {
+				t.Fatalf("event removed after %d attempts, want %d", attempt, maxOutboxAttempts)
+			}
+			break
+		}
+		delay := e.nextAttempt.Sub(repo.now)
+		delays = append(delays, delay)
+
+		// 退避期间不会再次领取
+		d.dispatch()
+		if attempts != attempt {
+			t.Fatalf("event redelivered %v before its retry time", delay)
+		}
+		repo.now = e.nextAttempt
+	}
+
+	want := []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		32 * time.Second, time.Minute, time.Minute, time.Minute,
+	}
+	if !reflect.DeepEqual(delays, want) {
+		t.Errorf("retry delays = %v, want %v", delays, want)
+	}
+	if _, ok := repo.events[1]; ok {
+		t.Errorf("event kept after %d failed attempts", maxOutboxAttempts)
+	}
+}
+
+func TestOutboxDispatchMixedResults(t *testing.T) {
+	repo := newFakeOutboxRepository(outboxEvents(4)...)
+	d := NewOutboxDispatcher(repo).(*outboxDispatcher)
+	d.OnDeliver(func(userID int, msg model.WSMessage) (bool, error) {
+		switch msg.MessageID {
+		case 2:
+			return false, errors.New("bus unavailable")
+		case 3:
+			// 接收方不在线，消息从未读消息中获取
+			return false, nil
+		}
+		return true, nil
+	})
+
+	d.dispatch()
+
+	if len(repo.events) != 1 || repo.events[2] == nil {
+		t.Fatalf("outbox = %v, want only event 2 left for retry", repo.events)
+	}
+	if got := repo.events[2].nextAttempt.Sub(repo.now); got != outboxRetryDelay {
+		t.Errorf("retry delay = %v, want %v", got, outboxRetryDelay)
+	}
+}
+
+func TestOutboxMessage(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	msg := model.Message{ID: 42, SenderID: 3, ReceiverID: 7, EncryptedContent: "ciphertext", ClientMessageID: "id", CreatedAt: created}
+	tests := []struct {
+		eventType string
+		want      model.WSMessage
+	}{
+		{model.OutboxEventMessage, model.WSMessage{
+			Type: "message", SenderID: 3, MessageID: 42, Content: "ciphertext", Timestamp: "2024-05-01T12:00:00Z", EventID: "message:9",
+		}},
+		{model.OutboxEventSealedMessage, model.WSMessage{
+			Type: "sealed_message", MessageID: 42, Content: "ciphertext", Timestamp: "2024-05-01T12:00:00Z", EventID: "sealed_message:9",
+		}},
+		{model.OutboxEventMessageSent, model.WSMessage{
+			Type: "message_sent", ReceiverID: 7, MessageID: 42, ClientMessageID: "id", Content: "Message sent successfully", EventID: "message_sent:9",
+		}},
+	}
+	for _, tt := range tests {
+		got := outboxMessage(&model.OutboxEvent{ID: 9, Type: tt.eventType, Message: msg})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("outboxMessage(%s) = %+v, want %+v", tt.eventType, got, tt.want)
+		}
+	}
+}
+
+// 确认丢失后客户端重发同一消息，发件箱为发送方新插入一条确认，新确认不能被节点与客户端的去重丢弃
+func TestOutboxReackAfterDuplicateSubmit(t *testing.T) {
+	msg := model.Message{ID: 42, SenderID: 3, ReceiverID: 7, ClientMessageID: "id"}
+	repo := newFakeOutboxRepository(model.OutboxEvent{ID: 1, UserID: 3, Type: model.OutboxEventMessageSent, Message: msg})
+	d := NewOutboxDispatcher(repo).(*outboxDispatcher)
+
+	node := &websocketService{recent: newRecentEvents(recentEventsSize)}
+	client := newRecentEvents(recentEventsSize)
+	var acks int
+	d.OnDeliver(func(userID int, wsMsg model.WSMessage) (bool, error) {
+		if node.seenEvent(&broker.Event{UserID: userID, EventID: wsMsg.EventID}) || client.seen(wsMsg.EventID) {
+			return true, nil
+		}
+		acks++
+		return true, nil
+	})
+
+	d.dispatch()
+	if acks != 1 {
+		t.Fatalf("first ack delivered %d times, want 1", acks)
+	}
+
+	// 重复发送：messageRepository.Save 为发送方插入新的 message_sent 记录
+	repo.events[2] = &fakeOutboxEvent{
+		event:       model.OutboxEvent{ID: 2, UserID: 3, Type: model.OutboxEventMessageSent, Message: msg},
+		nextAttempt: repo.now,
+	}
+	d.dispatch()
+	if acks != 2 {
+		t.Errorf("re-ack after duplicate submit was dropped as already seen")
+	}
+}
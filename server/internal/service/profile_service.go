@@ -0,0 +1,279 @@
+package service
+
+import (
+	"encoding/base64"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+)
+
+// 资料字段的长度上限（按字符计）
+const (
+	maxDisplayNameLength   = 64
+	maxBioLength           = 500
+	maxStatusMessageLength = 140
+	maxAvatarRefLength     = 512
+)
+
+// 用户搜索参数
+const (
+	maxSearchQueryLength = 64
+	// minFuzzySearchLength 关键字达到该长度才进行模糊匹配，太短的关键字三元组相似度没有意义
+	minFuzzySearchLength = 3
+	defaultSearchLimit   = 20
+	maxSearchLimit       = 50
+)
+
+// avatarBlobID 头像存储ID的格式
+var avatarBlobID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+
+var (
+	ErrDisplayNameTooLong    = &ProfileError{"display name must be at most 64 characters"}
+	ErrBioTooLong            = &ProfileError{"bio must be at most 500 characters"}
+	ErrStatusMessageTooLong  = &ProfileError{"status message must be at most 140 characters"}
+	ErrInvalidProfileText    = &ProfileError{"profile fields must be valid UTF-8 without control characters"}
+	ErrInvalidAvatarRef      = &ProfileError{"avatar must be an https URL or a blob ID"}
+	ErrInvalidMessagePrivacy = &ProfileError{"message_privacy must be \"everyone\" or \"contacts\""}
+	ErrSearchQueryTooLong    = &ProfileError{"search query must be at most 64 characters"}
+	ErrInvalidSearchCursor   = &ProfileError{"invalid search cursor"}
+)
+
+// ProfileError 资料校验错误
+type ProfileError struct {
+	Message string
+}
+
+func (e *ProfileError) Error() string {
+	return e.Message
+}
+
+// ProfileService 用户资料服务接口
+type ProfileService interface {
+	GetProfile(userID int) (*model.UserPublicInfo, error)
+	// UpdateProfile 校验并修改资料，通过 WebSocket 通知联系人
+	UpdateProfile(userID int, update *model.ProfileUpdate) (*model.UserPublicInfo, error)
+	GetPrivacy(userID int) (*model.PrivacySettings, error)
+	UpdatePrivacy(userID int, update *model.PrivacyUpdate) (*model.PrivacySettings, error)
+	// SearchUsers 按用户名与显示名称的前缀或模糊匹配搜索用户，关键字为空时按用户名列出所有可被搜索的用户；
+	// cursor 为上一页返回的 next_cursor
+	SearchUsers(viewerID int, query, cursor string, limit int) (*model.UserSearchPage, error)
+}
+
+type profileService struct {
+	userRepo     repository.UserRepository
+	contactRepo  repository.ContactRepository
+	sealedSender SealedSenderService
+	wsService    WebSocketService
+}
+
+// NewProfileService 创建用户资料服务实例
+func NewProfileService(
+	userRepo repository.UserRepository,
+	contactRepo repository.ContactRepository,
+	sealedSender SealedSenderService,
+	wsService WebSocketService,
+) ProfileService {
+	return &profileService{
+		userRepo:     userRepo,
+		contactRepo:  contactRepo,
+		sealedSender: sealedSender,
+		wsService:    wsService,
+	}
+}
+
+func (s *profileService) GetProfile(userID int) (*model.UserPublicInfo, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := publicInfo(user)
+	return &profile, nil
+}
+
+func (s *profileService) UpdateProfile(userID int, update *model.ProfileUpdate) (*model.UserPublicInfo, error) {
+	if err := validateProfile(update); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.UpdateProfile(userID, update)
+	if err != nil {
+		return nil, err
+	}
+
+	// 推送给联系人与自己的其他设备
+	profile := publicInfo(user)
+	contactIDs, err := s.contactRepo.ContactIDs(userID)
+	if err != nil {
+		log.Printf("Failed to list contacts of user %d: %v", userID, err)
+	}
+	for _, id := range append(contactIDs, userID) {
+		s.wsService.SendToUser(id, model.WSMessage{
+			Type:     "profile_updated",
+			SenderID: userID,
+			Profile:  &profile,
+		})
+	}
+
+	return &profile, nil
+}
+
+func (s *profileService) GetPrivacy(userID int) (*model.PrivacySettings, error) {
+	return s.userRepo.GetPrivacy(userID)
+}
+
+func (s *profileService) UpdatePrivacy(userID int, update *model.PrivacyUpdate) (*model.PrivacySettings, error) {
+	if update.MessagePrivacy != nil &&
+		*update.MessagePrivacy != model.MessagePrivacyEveryone && *update.MessagePrivacy != model.MessagePrivacyContacts {
+		return nil, ErrInvalidMessagePrivacy
+	}
+
+	previous, err := s.userRepo.GetPrivacy(userID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.userRepo.UpdatePrivacy(userID, update)
+	if err != nil {
+		return nil, err
+	}
+
+	// 消息隐私设置变化后，按旧设置分发出去的投递令牌全部失效
+	if settings.MessagePrivacy != previous.MessagePrivacy {
+		if err := revokeDeliveryToken(s.sealedSender, s.wsService, userID); err != nil {
+			return nil, err
+		}
+	}
+	return settings, nil
+}
+
+func (s *profileService) SearchUsers(viewerID int, query, cursor string, limit int) (*model.UserSearchPage, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	queryLength := utf8.RuneCountInString(query)
+	if queryLength > maxSearchQueryLength {
+		return nil, ErrSearchQueryTooLong
+	}
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+
+	var after *model.UserSearchCursor
+	if cursor != "" {
+		var err error
+		if after, err = decodeSearchCursor(cursor); err != nil {
+			return nil, ErrInvalidSearchCursor
+		}
+	}
+
+	users, next, err := s.userRepo.Search(viewerID, query, queryLength >= minFuzzySearchLength, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &model.UserSearchPage{Users: publicInfos(users)}
+	if next != nil {
+		page.NextCursor = encodeSearchCursor(next)
+	}
+	return page, nil
+}
+
+// encodeSearchCursor 将分页位置编码为不透明的字符串
+func encodeSearchCursor(cursor *model.UserSearchCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(cursor.Rank) + ":" + cursor.Username))
+}
+
+func decodeSearchCursor(cursor string) (*model.UserSearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	rank, username, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidSearchCursor
+	}
+	r, err := strconv.Atoi(rank)
+	if err != nil {
+		return nil, err
+	}
+	return &model.UserSearchCursor{Rank: r, Username: username}, nil
+}
+
+// validateProfile 去除首尾空白后校验各字段
+func validateProfile(update *model.ProfileUpdate) error {
+	fields := []struct {
+		value   *string
+		maxLen  int
+		tooLong error
+	}{
+		{update.DisplayName, maxDisplayNameLength, ErrDisplayNameTooLong},
+		{update.Bio, maxBioLength, ErrBioTooLong},
+		{update.StatusMessage, maxStatusMessageLength, ErrStatusMessageTooLong},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		*field.value = strings.TrimSpace(*field.value)
+		if !validProfileText(*field.value, field.value == update.Bio) {
+			return ErrInvalidProfileText
+		}
+		if utf8.RuneCountInString(*field.value) > field.maxLen {
+			return field.tooLong
+		}
+	}
+
+	if update.AvatarRef != nil {
+		*update.AvatarRef = strings.TrimSpace(*update.AvatarRef)
+		if !validAvatarRef(*update.AvatarRef) {
+			return ErrInvalidAvatarRef
+		}
+	}
+	return nil
+}
+
+// validProfileText 拒绝非法 UTF-8 与控制字符，简介允许换行
+func validProfileText(value string, multiline bool) bool {
+	if !utf8.ValidString(value) {
+		return false
+	}
+	for _, r := range value {
+		if multiline && r == '\n' {
+			continue
+		}
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validAvatarRef 头像引用为空（清除头像）、https URL 或存储ID
+func validAvatarRef(ref string) bool {
+	if ref == "" || avatarBlobID.MatchString(ref) {
+		return true
+	}
+	if len(ref) > maxAvatarRefLength {
+		return false
+	}
+	u, err := url.Parse(ref)
+	return err == nil && u.Scheme == "https" && u.Host != "" && u.User == nil
+}
+
+// publicInfo 用户公开信息
+func publicInfo(user *model.User) model.UserPublicInfo {
+	return model.UserPublicInfo{
+		ID:            user.ID,
+		Username:      user.Username,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		StatusMessage: user.StatusMessage,
+		AvatarRef:     user.AvatarRef,
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"im-system/server/internal/config"
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+	"im-system/server/pkg/crypto"
+	"im-system/server/pkg/ratelimit"
+)
+
+// senderCertificateTTL 发送方证书有效期
+const senderCertificateTTL = 24 * time.Hour
+
+var (
+	// ErrInvalidDeliveryToken 投递令牌格式错误
+	ErrInvalidDeliveryToken = &KeyError{"delivery token must be at least 16 random bytes, base64url encoded"}
+	// ErrDeliveryUnauthorized 投递令牌与接收方不匹配
+	ErrDeliveryUnauthorized = &KeyError{"delivery not authorized"}
+	// ErrSealedRateLimited 发往该接收方的密封消息过多
+	ErrSealedRateLimited = &KeyError{"too many sealed messages for this receiver, try again later"}
+)
+
+// SealedSenderService 密封发送服务接口
+// 发送方身份和服务端签发的证书加密在信封内，服务端仅凭接收方的投递令牌接收消息，只记录接收方
+type SealedSenderService interface {
+	SetDeliveryToken(userID int, deliveryToken string) error
+	IssueCertificate(userID int) (*model.SenderCertificate, error)
+	GetPublicKey() (string, error)
+	// clientIP 为请求来源地址，用于限制投递令牌的失败尝试
+	SendSealed(receiverID int, deliveryToken, encryptedContent, clientIP string) (int, error)
+	// RevokeDeliveryToken 吊销用户的投递令牌（拉黑、修改消息隐私设置后），持有旧令牌的发送方只能普通发送
+	RevokeDeliveryToken(userID int) error
+}
+
+type sealedSenderService struct {
+	tokenRepo      repository.DeliveryTokenRepository
+	keyRepo        repository.KeyRepository
+	userRepo       repository.UserRepository
+	messageService MessageService
+	signingKey     ed25519.PrivateKey
+	limiter        ratelimit.Limiter
+	failures       ratelimit.Lockout
+}
+
+// NewSealedSenderService 创建密封发送服务实例
+func NewSealedSenderService(
+	tokenRepo repository.DeliveryTokenRepository,
+	keyRepo repository.KeyRepository,
+	userRepo repository.UserRepository,
+	signingKeyRepo repository.SigningKeyRepository,
+	messageService MessageService,
+	limits ratelimit.Store,
+	cfg *config.Config,
+) (SealedSenderService, error) {
+	signingKey, err := loadSigningKey(signingKeyRepo, "sealed_sender", cfg.SealedSenderSigningKey, "SEALED_SENDER_SIGNING_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealedSenderService{
+		tokenRepo:      tokenRepo,
+		keyRepo:        keyRepo,
+		userRepo:       userRepo,
+		messageService: messageService,
+		signingKey:     signingKey,
+		// 匿名接口无法按发送方限流，按接收方限制已通过令牌校验的投递频率
+		limiter: limits.NewTokenBucket("sealed", time.Second, 30),
+		// 令牌错误按来源 IP 计数，防止猜测令牌或借错误令牌耗尽接收方的配额
+		failures: limits.NewLockout("sealed_token", 10, time.Minute, time.Hour),
+	}, nil
+}
+
+// SetDeliveryToken 设置（轮换）用户的投递令牌，服务端只保存哈希
+func (s *sealedSenderService) SetDeliveryToken(userID int, deliveryToken string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(deliveryToken)
+	if err != nil || len(raw) < 16 {
+		return ErrInvalidDeliveryToken
+	}
+
+	hash := sha256.Sum256([]byte(deliveryToken))
+	return s.tokenRepo.Save(userID, hash[:])
+}
+
+// IssueCertificate 为发送方签发短期证书，绑定用户ID与当前公钥
+func (s *sealedSenderService) IssueCertificate(userID int) (*model.SenderCertificate, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := s.keyRepo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(&model.SenderCertificateData{
+		SenderID:  user.ID,
+		Username:  user.Username,
+		PublicKey: publicKey,
+		Expires:   time.Now().Add(senderCertificateTTL).UnixMilli(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.SenderCertificate{
+		Certificate: data,
+		Signature:   ed25519.Sign(s.signingKey, data),
+	}, nil
+}
+
+func (s *sealedSenderService) GetPublicKey() (string, error) {
+	return crypto.EncodeSigningPublicKey(s.signingKey.Public().(ed25519.PublicKey))
+}
+
+// SendSealed 校验投递令牌后保存密封消息
+// 只有通过令牌校验的消息才计入接收方的配额，错误令牌按来源 IP 锁定
+func (s *sealedSenderService) SendSealed(receiverID int, deliveryToken, encryptedContent, clientIP string) (int, error) {
+	if s.failures.Locked(clientIP) > 0 {
+		return 0, ErrSealedRateLimited
+	}
+
+	expected, err := s.tokenRepo.GetHash(receiverID)
+	if err != nil {
+		return 0, err
+	}
+	actual := sha256.Sum256([]byte(deliveryToken))
+	if expected == nil || subtle.ConstantTimeCompare(expected, actual[:]) != 1 {
+		s.failures.Fail(clientIP)
+		return 0, ErrDeliveryUnauthorized
+	}
+
+	if ok, _ := s.limiter.Allow(strconv.Itoa(receiverID)); !ok {
+		return 0, ErrSealedRateLimited
+	}
+
+	return s.messageService.SendSealedMessage(receiverID, encryptedContent)
+}
+
+func (s *sealedSenderService) RevokeDeliveryToken(userID int) error {
+	return s.tokenRepo.Delete(userID)
+}
+
+// revokeDeliveryToken 吊销投递令牌并通知用户的在线设备，客户端随后生成新令牌，只随发给联系人的消息分发
+func revokeDeliveryToken(sealedSender SealedSenderService, wsService WebSocketService, userID int) error {
+	if err := sealedSender.RevokeDeliveryToken(userID); err != nil {
+		return err
+	}
+	wsService.SendToUser(userID, model.WSMessage{Type: "delivery_token_revoked"})
+	return nil
+}
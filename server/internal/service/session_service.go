@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+)
+
+// ErrSessionNotFound 会话不存在、已失效或不属于当前用户
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionService 登录会话（设备）管理服务接口
+type SessionService interface {
+	// ListSessions 列出用户当前有效的会话，标记发起请求的会话
+	ListSessions(userID int, currentSessionID string) ([]model.Session, error)
+	// RevokeSession 远程退出指定会话并断开其 WebSocket 连接
+	RevokeSession(userID int, sessionID string) error
+	// RevokeOtherSessions 退出除当前会话外的所有会话，返回退出的会话数
+	RevokeOtherSessions(userID int, currentSessionID string) (int, error)
+}
+
+type sessionService struct {
+	repo        repository.SessionRepository
+	userService UserService
+}
+
+// NewSessionService 创建会话管理服务实例
+func NewSessionService(repo repository.SessionRepository, userService UserService) SessionService {
+	return &sessionService{
+		repo:        repo,
+		userService: userService,
+	}
+}
+
+func (s *sessionService) ListSessions(userID int, currentSessionID string) ([]model.Session, error) {
+	sessions, err := s.repo.ListActive(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+func (s *sessionService) RevokeSession(userID int, sessionID string) error {
+	session, err := s.repo.Get(sessionID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.UserID != userID || session.RevokedAt != nil {
+		return ErrSessionNotFound
+	}
+
+	// 通过用户服务吊销，以便触发断开 WebSocket 连接的回调
+	return s.userService.RevokeSession(sessionID)
+}
+
+func (s *sessionService) RevokeOtherSessions(userID int, currentSessionID string) (int, error) {
+	sessions, err := s.repo.ListActive(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.ID == currentSessionID {
+			continue
+		}
+		if err := s.userService.RevokeSession(session.ID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"im-system/server/internal/repository"
+	"im-system/server/pkg/crypto"
+	"im-system/server/pkg/logger"
+)
+
+// loadSigningKey 加载 Ed25519 签名私钥
+// 未配置时自动生成并以 name 保存到数据库，保证重启后客户端固定的签名公钥仍然有效
+func loadSigningKey(signingKeyRepo repository.SigningKeyRepository, name, configured, envName string) (ed25519.PrivateKey, error) {
+	privateKeyPEM := configured
+	if privateKeyPEM == "" {
+		generated, err := crypto.GenerateSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		privateKeyPEM, err = signingKeyRepo.GetOrCreate(name, generated)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("%s not set, using the %s signing key stored in the database", envName, name))
+	}
+
+	return crypto.ParseSigningKey(privateKeyPEM)
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"im-system/server/internal/config"
+	"im-system/server/internal/model"
+	"im-system/server/internal/repository"
+	"im-system/server/pkg/ratelimit"
+	"im-system/server/pkg/totp"
+)
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+var (
+	// ErrTwoFactorAlreadyEnabled 两步验证已开启
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorNotSetUp 尚未生成两步验证密钥
+	ErrTwoFactorNotSetUp = errors.New("two-factor authentication is not set up")
+	// ErrTwoFactorNotEnabled 两步验证未开启
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrInvalidTwoFactorCode 验证码或恢复码错误（或已使用）
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrInvalidChallenge 挑战令牌无效或已过期
+	ErrInvalidChallenge = errors.New("invalid or expired challenge token")
+	// ErrTwoFactorRateLimited 验证码尝试过于频繁
+	ErrTwoFactorRateLimited = errors.New("too many two-factor attempts, try again later")
+)
+
+// TwoFactorService TOTP 两步验证服务接口
+type TwoFactorService interface {
+	// Setup 生成新的密钥（未激活），返回供验证器应用扫描的 URI
+	Setup(userID int) (*model.TwoFactorSetup, error)
+	// Activate 校验第一个验证码后开启两步验证，返回一次性恢复码（只显示这一次）
+	Activate(userID int, code string) ([]string, error)
+	// Disable 使用验证码或恢复码关闭两步验证
+	Disable(userID int, code string) error
+	// RegenerateRecoveryCodes 使用验证码重新生成恢复码，旧恢复码作废
+	RegenerateRecoveryCodes(userID int, code string) ([]string, error)
+	// Status 返回是否已开启两步验证及剩余恢复码数量
+	Status(userID int) (bool, int, error)
+	// CompleteLogin 使用挑战令牌与验证码（或恢复码）完成登录
+	CompleteLogin(challengeToken, code string, device *model.DeviceInfo) (*model.LoginResult, time.Duration, error)
+}
+
+type twoFactorService struct {
+	repo        repository.TwoFactorRepository
+	userRepo    repository.UserRepository
+	userService UserService
+	config      *config.Config
+	limiter     ratelimit.Limiter
+}
+
+// NewTwoFactorService 创建两步验证服务实例
+func NewTwoFactorService(
+	repo repository.TwoFactorRepository,
+	userRepo repository.UserRepository,
+	userService UserService,
+	limits ratelimit.Store,
+	cfg *config.Config,
+) TwoFactorService {
+	return &twoFactorService{
+		repo:        repo,
+		userRepo:    userRepo,
+		userService: userService,
+		config:      cfg,
+		// 6 位验证码需要限制尝试频率：每个用户每 30 秒一次，最多连续 5 次
+		limiter: limits.NewTokenBucket("2fa", 30*time.Second, 5),
+	}
+}
+
+func (s *twoFactorService) Setup(userID int) (*model.TwoFactorSetup, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.repo.SavePending(userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	return &model.TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.config.TOTPIssuer, user.Username, secret),
+	}, nil
+}
+
+func (s *twoFactorService) Activate(userID int, code string) ([]string, error) {
+	twoFactor, err := s.repo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil {
+		return nil, ErrTwoFactorNotSetUp
+	}
+	if twoFactor.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if ok, _ := s.limiter.Allow(strconv.Itoa(userID)); !ok {
+		return nil, ErrTwoFactorRateLimited
+	}
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now(), 1)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Enable(userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *twoFactorService) Disable(userID int, code string) error {
+	if err := s.verify(userID, code, true); err != nil {
+		return err
+	}
+	return s.repo.Delete(userID)
+}
+
+func (s *twoFactorService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	if err := s.verify(userID, code, false); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *twoFactorService) Status(userID int) (bool, int, error) {
+	twoFactor, err := s.repo.Get(userID)
+	if err != nil || twoFactor == nil || !twoFactor.Enabled {
+		return false, 0, err
+	}
+
+	remaining, err := s.repo.CountRecoveryCodes(userID)
+	if err != nil {
+		return false, 0, err
+	}
+	return true, remaining, nil
+}
+
+// CompleteLogin 校验成功后创建会话，超过尝试频率时返回需要等待的时间
+func (s *twoFactorService) CompleteLogin(challengeToken, code string, device *model.DeviceInfo) (*model.LoginResult, time.Duration, error) {
+	claims, err := s.userService.ValidateChallengeToken(challengeToken)
+	if err != nil {
+		return nil, 0, ErrInvalidChallenge
+	}
+
+	if ok, retryAfter := s.limiter.Allow(strconv.Itoa(claims.UserID)); !ok {
+		return nil, retryAfter, ErrTwoFactorRateLimited
+	}
+	if err := s.check(claims.UserID, code, true); err != nil {
+		return nil, 0, err
+	}
+
+	tokens, err := s.userService.IssueTokens(claims.UserID, claims.Username, device)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &model.LoginResult{
+		UserID:   claims.UserID,
+		Username: claims.Username,
+		Tokens:   tokens,
+	}, 0, nil
+}
+
+// verify 限制频率后校验验证码
+func (s *twoFactorService) verify(userID int, code string, allowRecovery bool) error {
+	if ok, _ := s.limiter.Allow(strconv.Itoa(userID)); !ok {
+		return ErrTwoFactorRateLimited
+	}
+	return s.check(userID, code, allowRecovery)
+}
+
+// check 校验 TOTP 验证码（同一时间步只能使用一次），失败时尝试恢复码
+func (s *twoFactorService) check(userID int, code string, allowRecovery bool) error {
+	twoFactor, err := s.repo.Get(userID)
+	if err != nil {
+		return err
+	}
+	if twoFactor == nil || !twoFactor.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := totp.Validate(twoFactor.Secret, code, time.Now(), 1); ok {
+		fresh, err := s.repo.UseStep(userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	if allowRecovery {
+		used, err := s.repo.UseRecoveryCode(userID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if used {
+			return nil
+		}
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// generateRecoveryCodes 生成恢复码（形如 abcde-fghij）及其哈希
+func generateRecoveryCodes() ([]string, [][]byte, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(raw))[:10]
+		code = code[:5] + "-" + code[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 忽略大小写、空格与连字符后计算哈希
+func hashRecoveryCode(code string) []byte {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	hash := sha256.Sum256([]byte(normalized))
+	return hash[:]
+}
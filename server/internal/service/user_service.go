@@ -1,131 +1,419 @@
 package service
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	"im-system/server/internal/config"
 	"im-system/server/internal/model"
 	"im-system/server/internal/repository"
+	"im-system/server/pkg/ratelimit"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新令牌不存在、已过期或会话已吊销
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用，会话已被吊销
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrAccountLocked 连续登录失败次数过多，账户暂时锁定
+	ErrAccountLocked = errors.New("too many failed login attempts, account temporarily locked")
 )
 
 // UserService 用户服务接口
 type UserService interface {
-	Register(username, password string) (string, int, error)
-	Login(username, password string) (string, int, error)
-	GetAllUsers(excludeUserID int) ([]model.UserPublicInfo, error)
+	Register(username, password string, device *model.DeviceInfo) (*model.TokenPair, int, error)
+	// Login 校验密码；开启两步验证时只返回挑战令牌，需要用验证码换取正式令牌。
+	// 账户被锁定时返回 ErrAccountLocked 及剩余锁定时间
+	Login(username, password string, device *model.DeviceInfo) (*model.LoginResult, time.Duration, error)
 	GetUserByID(userID int) (*model.User, error)
-	GenerateToken(userID int, username string) (string, error)
+	// IssueTokens 创建新会话，签发访问令牌与刷新令牌
+	IssueTokens(userID int, username string, device *model.DeviceInfo) (*model.TokenPair, error)
+	// RefreshTokens 轮换刷新令牌并签发新的访问令牌，同时更新会话的 IP 地址
+	RefreshTokens(refreshToken, ipAddress string) (*model.TokenPair, error)
+	// Logout 吊销当前访问令牌及其所属会话
+	Logout(claims *Claims) error
+	RevokeSession(sessionID string) error
+	// OnSessionRevoked 注册会话吊销回调，用于断开该会话的 WebSocket 连接
+	OnSessionRevoked(listener func(sessionID string))
 	ValidateToken(tokenString string) (*Claims, error)
+	// ValidateChallengeToken 校验两步验证的挑战令牌
+	ValidateChallengeToken(tokenString string) (*Claims, error)
 }
 
+// challengeTokenTTL 两步验证挑战令牌的有效期
+const challengeTokenTTL = 5 * time.Minute
+
+// purposeTwoFactor 挑战令牌的用途，带用途的令牌不能作为访问令牌使用
+const purposeTwoFactor = "2fa"
+
+// sessionTouchInterval 同一会话更新最后使用时间的最小间隔，间隔内的请求不再写数据库
+const sessionTouchInterval = time.Minute
+
 type userService struct {
-	repo   repository.UserRepository
-	config *config.Config
+	repo          repository.UserRepository
+	sessionRepo   repository.SessionRepository
+	twoFactorRepo repository.TwoFactorRepository
+	auditRepo     repository.AuditRepository
+	jwtKeys       JWTKeyService
+	lockout       ratelimit.Lockout
+	config        *config.Config
+	listeners     []func(sessionID string)
+
+	// touched 本实例最近更新最后使用时间的会话
+	touched   map[string]time.Time
+	lastPrune time.Time
+	touchMu   sync.Mutex
 }
 
+var (
+	// dummyPasswordHash 用户名不存在时也执行一次 bcrypt 校验，使响应时间与密码错误时一致
+	dummyPasswordHash     []byte
+	dummyPasswordHashOnce sync.Once
+)
+
 // Claims JWT 声明
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // NewUserService 创建用户服务实例
-func NewUserService(repo repository.UserRepository, cfg *config.Config) UserService {
+func NewUserService(
+	repo repository.UserRepository,
+	sessionRepo repository.SessionRepository,
+	twoFactorRepo repository.TwoFactorRepository,
+	auditRepo repository.AuditRepository,
+	jwtKeys JWTKeyService,
+	limits ratelimit.Store,
+	cfg *config.Config,
+) UserService {
 	return &userService{
-		repo:   repo,
-		config: cfg,
+		repo:          repo,
+		sessionRepo:   sessionRepo,
+		twoFactorRepo: twoFactorRepo,
+		auditRepo:     auditRepo,
+		jwtKeys:       jwtKeys,
+		lockout: limits.NewLockout(
+			"login",
+			cfg.LoginLockoutThreshold,
+			time.Duration(cfg.LoginLockoutSeconds)*time.Second,
+			time.Duration(cfg.LoginLockoutMaxMinutes)*time.Minute,
+		),
+		config:  cfg,
+		touched: make(map[string]time.Time),
 	}
 }
 
-func (s *userService) Register(username, password string) (string, int, error) {
+func (s *userService) Register(username, password string, device *model.DeviceInfo) (*model.TokenPair, int, error) {
 	// 创建用户
 	userID, err := s.repo.Create(username, password)
 	if err != nil {
-		return "", 0, errors.New("username already exists")
+		return nil, 0, errors.New("username already exists")
 	}
 
 	// 生成 token
-	token, err := s.GenerateToken(userID, username)
+	tokens, err := s.IssueTokens(userID, username, device)
 	if err != nil {
-		return "", 0, err
+		return nil, 0, err
 	}
 
-	return token, userID, nil
+	return tokens, userID, nil
 }
 
-func (s *userService) Login(username, password string) (string, int, error) {
+func (s *userService) Login(username, password string, device *model.DeviceInfo) (*model.LoginResult, time.Duration, error) {
+	// 锁定期间不校验密码（用户名不存在时同样计数，避免泄露用户是否存在）
+	if remaining := s.lockout.Locked(username); remaining > 0 {
+		return nil, remaining, ErrAccountLocked
+	}
+
 	// 获取用户
 	user, err := s.repo.GetByUsername(username)
 	if err != nil {
-		return "", 0, errors.New("invalid credentials")
+		dummyPasswordHashOnce.Do(func() {
+			dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+		})
+		s.repo.VerifyPassword(string(dummyPasswordHash), password)
+		retryAfter, err := s.loginFailed(username, nil, device)
+		return nil, retryAfter, err
 	}
 
 	// 验证密码
 	if !s.repo.VerifyPassword(user.Password, password) {
-		return "", 0, errors.New("invalid credentials")
+		retryAfter, err := s.loginFailed(username, &user.ID, device)
+		return nil, retryAfter, err
+	}
+	s.lockout.Reset(username)
+
+	result := &model.LoginResult{
+		UserID:   user.ID,
+		Username: user.Username,
+	}
+
+	// 开启两步验证时先签发挑战令牌
+	twoFactor, err := s.twoFactorRepo.Get(user.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if twoFactor != nil && twoFactor.Enabled {
+		result.ChallengeToken, err = s.signToken(&Claims{
+			UserID:   user.ID,
+			Username: user.Username,
+			Purpose:  purposeTwoFactor,
+		}, challengeTokenTTL)
+		if err != nil {
+			return nil, 0, err
+		}
+		result.ChallengeExpiresIn = int(challengeTokenTTL.Seconds())
+		return result, 0, nil
 	}
 
 	// 生成 token
-	token, err := s.GenerateToken(user.ID, user.Username)
+	result.Tokens, err = s.IssueTokens(user.ID, user.Username, device)
 	if err != nil {
-		return "", 0, err
+		return nil, 0, err
 	}
 
-	return token, user.ID, nil
+	return result, 0, nil
 }
 
-func (s *userService) GetAllUsers(excludeUserID int) ([]model.UserPublicInfo, error) {
-	users, err := s.repo.GetAll()
+// loginFailed 记录一次登录失败，触发锁定时写入审计事件并返回锁定时长
+func (s *userService) loginFailed(username string, userID *int, device *model.DeviceInfo) (time.Duration, error) {
+	duration := s.lockout.Fail(username)
+	if duration == 0 {
+		return 0, ErrInvalidCredentials
+	}
+
+	log.Printf("Login locked for %q from %s for %s", username, device.IPAddress, duration)
+	err := s.auditRepo.Record(&model.AuditEvent{
+		UserID:    userID,
+		Username:  username,
+		Event:     model.AuditLoginLocked,
+		IPAddress: device.IPAddress,
+		Detail:    fmt.Sprintf("locked for %s after %d failed attempts", duration, s.config.LoginLockoutThreshold),
+	})
+	if err != nil {
+		log.Printf("Failed to record audit event: %v", err)
+	}
+	return duration, ErrAccountLocked
+}
+
+func (s *userService) GetUserByID(userID int) (*model.User, error) {
+	return s.repo.GetByID(userID)
+}
+
+func (s *userService) IssueTokens(userID int, username string, device *model.DeviceInfo) (*model.TokenPair, error) {
+	refreshToken, refreshHash, err := newRefreshToken()
 	if err != nil {
 		return nil, err
 	}
 
-	var result []model.UserPublicInfo
-	for _, user := range users {
-		if user.ID != excludeUserID {
-			result = append(result, model.UserPublicInfo{
-				ID:       user.ID,
-				Username: user.Username,
-			})
+	session := &model.Session{
+		ID:               uuid.New().String(),
+		UserID:           userID,
+		DeviceName:       device.Name,
+		UserAgent:        device.UserAgent,
+		IPAddress:        device.IPAddress,
+		RefreshTokenHash: refreshHash,
+	}
+	if err := s.sessionRepo.Create(session, s.refreshTokenTTL()); err != nil {
+		return nil, err
+	}
+
+	return s.tokenPair(userID, username, session.ID, refreshToken)
+}
+
+func (s *userService) RefreshTokens(refreshToken, ipAddress string) (*model.TokenPair, error) {
+	oldHash := hashRefreshToken(refreshToken)
+	session, err := s.sessionRepo.GetByTokenHash(oldHash)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// 上一个刷新令牌被再次使用，说明令牌可能已泄露，吊销整个会话
+	if !bytes.Equal(session.RefreshTokenHash, oldHash) {
+		if err := s.RevokeSession(session.ID); err != nil {
+			return nil, err
 		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	user, err := s.repo.GetByID(session.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// 并发刷新时只有一个请求能完成轮换
+	ok, err := s.sessionRepo.Rotate(session.ID, oldHash, newHash, s.refreshTokenTTL(), ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidRefreshToken
 	}
 
-	return result, nil
+	return s.tokenPair(user.ID, user.Username, session.ID, newToken)
 }
 
-func (s *userService) GetUserByID(userID int) (*model.User, error) {
-	return s.repo.GetByID(userID)
+func (s *userService) Logout(claims *Claims) error {
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if err := s.sessionRepo.RevokeToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+	}
+
+	if claims.SessionID == "" {
+		return nil
+	}
+	return s.RevokeSession(claims.SessionID)
 }
 
-func (s *userService) GenerateToken(userID int, username string) (string, error) {
-	claims := &Claims{
-		UserID:   userID,
-		Username: username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ID:        uuid.New().String(),
-		},
+func (s *userService) RevokeSession(sessionID string) error {
+	if err := s.sessionRepo.Revoke(sessionID); err != nil {
+		return err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.config.JWTSecret))
+	for _, listener := range s.listeners {
+		listener(sessionID)
+	}
+	return nil
+}
+
+func (s *userService) OnSessionRevoked(listener func(sessionID string)) {
+	s.listeners = append(s.listeners, listener)
 }
 
 func (s *userService) ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.config.JWTSecret), nil
-	})
+	claims, err := s.parseToken(tokenString)
+	if err != nil || claims.Purpose != "" {
+		return nil, errors.New("invalid token")
+	}
 
-	if err != nil || !token.Valid {
+	// 检查令牌是否已被吊销
+	revoked, err := s.sessionRepo.IsTokenRevoked(claims.ID)
+	if err != nil || revoked {
 		return nil, errors.New("invalid token")
 	}
 
+	// 会话吊销后，该会话签发的所有访问令牌立即失效
+	if claims.SessionID != "" {
+		active, err := s.sessionRepo.IsActive(claims.SessionID)
+		if err != nil || !active {
+			return nil, errors.New("invalid token")
+		}
+		if s.shouldTouch(claims.SessionID) {
+			_ = s.sessionRepo.Touch(claims.SessionID)
+		}
+	}
+
+	return claims, nil
+}
+
+// shouldTouch 距本实例上次更新该会话超过 sessionTouchInterval 时返回真，并顺带清理过期的记录
+func (s *userService) shouldTouch(sessionID string) bool {
+	now := time.Now()
+	s.touchMu.Lock()
+	defer s.touchMu.Unlock()
+
+	if now.Sub(s.lastPrune) >= sessionTouchInterval {
+		for id, at := range s.touched {
+			if now.Sub(at) >= sessionTouchInterval {
+				delete(s.touched, id)
+			}
+		}
+		s.lastPrune = now
+	}
+
+	if at, ok := s.touched[sessionID]; ok && now.Sub(at) < sessionTouchInterval {
+		return false
+	}
+	s.touched[sessionID] = now
+	return true
+}
+
+func (s *userService) ValidateChallengeToken(tokenString string) (*Claims, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil || claims.Purpose != purposeTwoFactor {
+		return nil, errors.New("invalid challenge token")
+	}
 	return claims, nil
 }
+
+func (s *userService) parseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if err := s.jwtKeys.Parse(tokenString, claims); err != nil {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// signToken 填写有效期与令牌ID后签名
+func (s *userService) signToken(claims *Claims, ttl time.Duration) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ID:        uuid.New().String(),
+	}
+	return s.jwtKeys.Sign(claims)
+}
+
+// tokenPair 签发访问令牌并与刷新令牌一起返回
+func (s *userService) tokenPair(userID int, username, sessionID, refreshToken string) (*model.TokenPair, error) {
+	ttl := time.Duration(s.config.AccessTokenTTLMinutes) * time.Minute
+	accessToken, err := s.signToken(&Claims{
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
+	}, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(ttl.Seconds()),
+	}, nil
+}
+
+func (s *userService) refreshTokenTTL() time.Duration {
+	return time.Duration(s.config.RefreshTokenTTLDays) * 24 * time.Hour
+}
+
+// newRefreshToken 生成随机刷新令牌及其哈希（数据库只保存哈希）
+func newRefreshToken() (string, []byte, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
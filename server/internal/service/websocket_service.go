@@ -1,157 +1,622 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"im-system/server/internal/broker"
+	"im-system/server/internal/config"
 	"im-system/server/internal/model"
+	"im-system/server/internal/wire"
 
 	"github.com/gorilla/websocket"
 )
 
 // WebSocketService WebSocket 服务接口
 type WebSocketService interface {
-	RegisterClient(userID int, username string, conn *websocket.Conn) *model.WSClient
-	UnregisterClient(userID int)
-	GetClient(userID int) *model.WSClient
-	GetOnlineUsers() []int
+	// RegisterClient 登记连接，服务端正在关闭时返回 ErrShuttingDown
+	RegisterClient(userID int, username, sessionID string, conn *websocket.Conn) (*model.WSClient, error)
+	UnregisterClient(client *model.WSClient)
+	// DisconnectSession 断开所有节点上使用该会话令牌建立的连接
+	DisconnectSession(sessionID string)
+	// FilterOnline 返回 userIDs 中在任一节点在线的用户
+	FilterOnline(userIDs []int) []int
 	HandleMessage(client *model.WSClient, msg model.WSMessage)
+	// SendToUser 推送消息给用户在所有节点上的连接，用户不在线时返回 false
+	SendToUser(userID int, msg model.WSMessage) bool
+	// Deliver 与 SendToUser 相同，但查询在线状态或转发到其他节点失败时返回错误，供调用方重试
+	Deliver(userID int, msg model.WSMessage) (bool, error)
 	ReadPump(client *model.WSClient, conn *websocket.Conn)
 	WritePump(client *model.WSClient, conn *websocket.Conn)
+	// Run 接收其他节点转发的事件并定期续期在线状态，直到 ctx 结束
+	Run(ctx context.Context)
+	// Stats 本节点推送队列的统计
+	Stats() model.WSStats
+	// Shutdown 停止接受新连接，写出各连接发送队列中的消息后发送 going away 关闭帧，
+	// 等待所有连接关闭或 ctx 结束
+	Shutdown(ctx context.Context) error
 }
 
+// ErrShuttingDown 服务端正在关闭，客户端应重新连接（到其他实例）
+var ErrShuttingDown = errors.New("server is shutting down, please reconnect")
+
+const (
+	// busTimeout 访问消息总线与在线状态登记的超时
+	busTimeout = 2 * time.Second
+	// PresenceTTL 在线状态记录的有效期，节点异常退出后其连接在此时间后视为离线
+	PresenceTTL = 90 * time.Second
+	// presenceRefreshInterval 续期本节点在线状态的间隔
+	presenceRefreshInterval = 30 * time.Second
+	// submitQueueSize 每个连接等待写入消息队列的消息数，已满时回复 ErrPipelineBusy，不阻塞读取
+	submitQueueSize = 32
+	// recentEventsSize 本节点记住的最近转发事件数，用于丢弃重试时重复转发的事件
+	recentEventsSize = 4096
+)
+
 type websocketService struct {
-	clients        map[int]*model.WSClient
-	clientsMutex   sync.RWMutex
-	messageService MessageService
-	userService    UserService
+	// 本节点上的连接，每个用户可以在多台设备上同时在线
+	clients      map[int]map[*model.WSClient]bool
+	clientsMutex sync.RWMutex
+	pipeline     MessagePipeline
+	userService  UserService
+	broker       broker.Broker
+	presence     broker.Presence
+	nodeID       string
+	sendBuffer   int
+	// 心跳间隔、读超时（收到 pong 或消息时刷新）、写超时与单条消息大小上限
+	pingInterval   time.Duration
+	pongWait       time.Duration
+	writeWait      time.Duration
+	maxMessageSize int64
+	// 发送队列已满时是否断开连接（否则只丢弃该条推送）
+	disconnectSlow  bool
+	dropped         atomic.Int64
+	slowDisconnects atomic.Int64
+	// draining 关闭中不再接受新连接，pumps 跟踪尚未退出的 WritePump
+	draining bool
+	pumps    sync.WaitGroup
+	// recent 最近处理过的转发事件
+	recent   *recentEvents
+	recentMu sync.Mutex
 }
 
 // NewWebSocketService 创建 WebSocket 服务实例
-func NewWebSocketService(messageService MessageService, userService UserService) WebSocketService {
+func NewWebSocketService(
+	pipeline MessagePipeline,
+	userService UserService,
+	messageBroker broker.Broker,
+	presence broker.Presence,
+	cfg *config.Config,
+) WebSocketService {
 	return &websocketService{
-		clients:        make(map[int]*model.WSClient),
-		messageService: messageService,
+		clients:        make(map[int]map[*model.WSClient]bool),
+		pipeline:       pipeline,
 		userService:    userService,
+		broker:         messageBroker,
+		presence:       presence,
+		nodeID:         cfg.NodeID,
+		sendBuffer:     cfg.WSSendBuffer,
+		disconnectSlow: cfg.WSSlowConsumerPolicy == "disconnect",
+		pingInterval:   time.Duration(cfg.WSPingIntervalSeconds) * time.Second,
+		pongWait:       time.Duration(cfg.WSPongTimeoutSeconds) * time.Second,
+		writeWait:      time.Duration(cfg.WSWriteTimeoutSeconds) * time.Second,
+		maxMessageSize: int64(cfg.WSMaxMessageBytes),
+		recent:         newRecentEvents(recentEventsSize),
 	}
 }
 
-func (s *websocketService) RegisterClient(userID int, username string, conn *websocket.Conn) *model.WSClient {
+func (s *websocketService) RegisterClient(userID int, username, sessionID string, conn *websocket.Conn) (*model.WSClient, error) {
 	client := &model.WSClient{
-		UserID:   userID,
-		Username: username,
-		Send:     make(chan interface{}, 256),
+		UserID:    userID,
+		Username:  username,
+		SessionID: sessionID,
+		Send:      make(chan model.WSMessage, s.sendBuffer),
 	}
 
 	s.clientsMutex.Lock()
-	s.clients[userID] = client
+	if s.draining {
+		s.clientsMutex.Unlock()
+		return nil, ErrShuttingDown
+	}
+	s.pumps.Add(1)
+	first := s.clients[userID] == nil
+	if first {
+		s.clients[userID] = make(map[*model.WSClient]bool)
+	}
+	s.clients[userID][client] = true
 	s.clientsMutex.Unlock()
 
+	if first {
+		s.updatePresence(userID, true)
+	}
+
 	log.Printf("User %s (ID: %d) connected", username, userID)
-	return client
+	return client, nil
 }
 
-func (s *websocketService) UnregisterClient(userID int) {
+// UnregisterClient 注销连接，已被断开的连接重复注销时忽略
+func (s *websocketService) UnregisterClient(client *model.WSClient) {
 	s.clientsMutex.Lock()
-	if client, ok := s.clients[userID]; ok {
-		close(client.Send)
-		delete(s.clients, userID)
-		log.Printf("User ID %d disconnected", userID)
+	removed, last := s.removeClient(client)
+	s.clientsMutex.Unlock()
+
+	if removed {
+		log.Printf("User ID %d disconnected", client.UserID)
+	}
+	if last {
+		s.updatePresence(client.UserID, false)
+	}
+}
+
+func (s *websocketService) DisconnectSession(sessionID string) {
+	if sessionID == "" {
+		return
+	}
+
+	s.disconnectLocalSession(sessionID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	err := s.broker.Broadcast(ctx, &broker.Event{
+		Type:      broker.EventDisconnectSession,
+		Origin:    s.nodeID,
+		SessionID: sessionID,
+	})
+	if err != nil {
+		log.Printf("Failed to broadcast session revocation: %v", err)
+	}
+}
+
+// disconnectLocalSession 断开本节点上使用该会话建立的连接
+func (s *websocketService) disconnectLocalSession(sessionID string) {
+	var offline []int
+
+	s.clientsMutex.Lock()
+	for _, clients := range s.clients {
+		for client := range clients {
+			if client.SessionID != sessionID {
+				continue
+			}
+			removed, last := s.removeClient(client)
+			if removed {
+				log.Printf("User ID %d disconnected: session revoked", client.UserID)
+			}
+			if last {
+				offline = append(offline, client.UserID)
+			}
+		}
 	}
 	s.clientsMutex.Unlock()
+
+	for _, userID := range offline {
+		s.updatePresence(userID, false)
+	}
+}
+
+// removeClient 移除连接并关闭发送通道，WritePump 写出队列中剩余的消息后发送关闭帧并关闭连接；
+// 返回是否移除以及是否为该用户在本节点的最后一个连接。调用方需持有写锁
+func (s *websocketService) removeClient(client *model.WSClient) (removed, last bool) {
+	clients := s.clients[client.UserID]
+	if !clients[client] {
+		return false, false
+	}
+
+	close(client.Send)
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(s.clients, client.UserID)
+		return true, true
+	}
+	return true, false
+}
+
+// updatePresence 登记用户在本节点上线或离线，失败时由定期续期（上线）或记录过期（离线）纠正
+func (s *websocketService) updatePresence(userID int, online bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+
+	var err error
+	if online {
+		err = s.presence.Add(ctx, userID, s.nodeID)
+	} else {
+		err = s.presence.Remove(ctx, userID, s.nodeID)
+	}
+	if err != nil {
+		log.Printf("Failed to update presence of user %d: %v", userID, err)
+	}
 }
 
-func (s *websocketService) GetClient(userID int) *model.WSClient {
+func (s *websocketService) FilterOnline(userIDs []int) []int {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+
+	online, err := s.presence.FilterOnline(ctx, userIDs)
+	if err != nil {
+		// 在线状态登记不可用时只返回本节点上的在线用户
+		log.Printf("Failed to query presence: %v", err)
+		s.clientsMutex.RLock()
+		defer s.clientsMutex.RUnlock()
+
+		online = []int{}
+		for _, userID := range userIDs {
+			if s.clients[userID] != nil {
+				online = append(online, userID)
+			}
+		}
+	}
+	return online
+}
+
+func (s *websocketService) HandleMessage(client *model.WSClient, msg model.WSMessage) {
+	// 校验后写入消息队列，由消费者保存并投递，确认通过 message_sent 事件异步返回；
+	// 队列积压时最多阻塞 submitTimeout，由连接的提交协程调用，不影响读取
+	if err := s.pipeline.Submit(client.UserID, msg.ReceiverID, msg.Content, msg.ClientMessageID); err != nil {
+		content := "Failed to send message"
+		switch err {
+		case ErrMessageBlocked, ErrContactsOnly, ErrPipelineBusy, ErrInvalidClientMessageID:
+			content = err.Error()
+		}
+		s.reply(client, model.WSMessage{
+			Type:            "error",
+			ReceiverID:      msg.ReceiverID,
+			ClientMessageID: msg.ClientMessageID,
+			Content:         content,
+		})
+	}
+}
+
+func (s *websocketService) SendToUser(userID int, msg model.WSMessage) bool {
+	delivered, err := s.Deliver(userID, msg)
+	if err != nil {
+		log.Printf("Failed to deliver message to user %d: %v", userID, err)
+	}
+	return delivered
+}
+
+func (s *websocketService) Deliver(userID int, msg model.WSMessage) (bool, error) {
+	delivered := s.deliverLocal(userID, msg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+
+	nodes, err := s.presence.Nodes(ctx, userID)
+	if err != nil {
+		return delivered, err
+	}
+
+	// 转发失败时继续转发给其他节点，重试时已收到的节点凭 event_id 去重（见 handleEvent）
+	var firstErr error
+	for _, nodeID := range nodes {
+		if nodeID == s.nodeID {
+			continue
+		}
+		err := s.broker.Publish(ctx, nodeID, &broker.Event{
+			Type:    broker.EventDeliver,
+			Origin:  s.nodeID,
+			UserID:  userID,
+			Message: &msg,
+			EventID: msg.EventID,
+		})
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("forward to node %s: %w", nodeID, err)
+			}
+			continue
+		}
+		delivered = true
+	}
+	return delivered, firstErr
+}
+
+// deliverLocal 推送消息给用户在本节点上的所有连接，没有任何连接接收时返回 false
+// （消息已保存在数据库中，客户端之后从未读消息中获取）
+func (s *websocketService) deliverLocal(userID int, msg model.WSMessage) bool {
+	var delivered bool
+	var slow []*model.WSClient
+
 	s.clientsMutex.RLock()
-	defer s.clientsMutex.RUnlock()
-	return s.clients[userID]
+	for client := range s.clients[userID] {
+		if enqueue(client, msg) {
+			delivered = true
+		} else {
+			slow = append(slow, client)
+		}
+	}
+	s.clientsMutex.RUnlock()
+
+	s.handleSlowConsumers(slow)
+	return delivered
 }
 
-func (s *websocketService) GetOnlineUsers() []int {
+// enqueue 非阻塞地放入连接的发送队列，队列已满时返回 false。调用方需持有读锁
+func enqueue(client *model.WSClient, msg model.WSMessage) bool {
+	select {
+	case client.Send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleSlowConsumers 发送队列已满的连接丢弃本条推送，按配置断开连接
+func (s *websocketService) handleSlowConsumers(clients []*model.WSClient) {
+	for _, client := range clients {
+		s.dropped.Add(1)
+		if !s.disconnectSlow {
+			log.Printf("Send queue of user ID %d is full, message dropped", client.UserID)
+			continue
+		}
+
+		s.clientsMutex.Lock()
+		removed, last := s.removeClient(client)
+		s.clientsMutex.Unlock()
+
+		if removed {
+			s.slowDisconnects.Add(1)
+			log.Printf("User ID %d disconnected: slow consumer", client.UserID)
+		}
+		if last {
+			s.updatePresence(client.UserID, false)
+		}
+	}
+}
+
+func (s *websocketService) Shutdown(ctx context.Context) error {
+	var offline []int
+
+	s.clientsMutex.Lock()
+	s.draining = true
+	for userID, clients := range s.clients {
+		for client := range clients {
+			client.CloseCode = websocket.CloseGoingAway
+			client.CloseReason = ErrShuttingDown.Error()
+			s.removeClient(client)
+		}
+		offline = append(offline, userID)
+	}
+	s.clientsMutex.Unlock()
+
+	for _, userID := range offline {
+		s.updatePresence(userID, false)
+	}
+	log.Printf("Closing %d WebSocket users for shutdown", len(offline))
+
+	done := make(chan struct{})
+	go func() {
+		s.pumps.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *websocketService) Stats() model.WSStats {
 	s.clientsMutex.RLock()
 	defer s.clientsMutex.RUnlock()
 
-	users := make([]int, 0, len(s.clients))
-	for userID := range s.clients {
-		users = append(users, userID)
+	stats := model.WSStats{
+		DroppedMessages:           s.dropped.Load(),
+		SlowConsumersDisconnected: s.slowDisconnects.Load(),
 	}
-	return users
+	for _, clients := range s.clients {
+		for client := range clients {
+			depth := len(client.Send)
+			stats.Connections++
+			stats.QueuedMessages += depth
+			if depth > stats.MaxQueueDepth {
+				stats.MaxQueueDepth = depth
+			}
+		}
+	}
+	return stats
 }
 
-func (s *websocketService) HandleMessage(client *model.WSClient, msg model.WSMessage) {
-	// 保存消息到数据库
-	messageID, err := s.messageService.SendMessage(client.UserID, msg.ReceiverID, msg.Content)
-	if err != nil {
-		client.Send <- model.WSMessage{
-			Type:    "error",
-			Content: "Failed to save message",
+func (s *websocketService) Run(ctx context.Context) {
+	go s.refreshPresence(ctx)
+
+	// 订阅断开（如 Redis 重启）时稍后重试
+	for {
+		if err := s.broker.Subscribe(ctx, s.nodeID, s.handleEvent); err != nil {
+			log.Printf("Message bus subscription failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
 		}
-		return
 	}
+}
 
-	// 检查接收者是否在线
-	receiver := s.GetClient(msg.ReceiverID)
-	if receiver != nil {
-		// 在线，直接发送
-		receiver.Send <- model.WSMessage{
-			Type:      "message",
-			SenderID:  client.UserID,
-			Content:   msg.Content,
-			MessageID: messageID,
-			Timestamp: time.Now().Format(time.RFC3339),
+// handleEvent 处理其他节点转发的事件
+func (s *websocketService) handleEvent(event *broker.Event) {
+	switch event.Type {
+	case broker.EventDeliver:
+		if event.Message != nil && !s.seenEvent(event) {
+			s.deliverLocal(event.UserID, *event.Message)
+		}
+	case broker.EventDisconnectSession:
+		// 发出广播的节点已经断开了自己的连接
+		if event.Origin != s.nodeID {
+			s.disconnectLocalSession(event.SessionID)
+		}
+	}
+}
+
+// refreshPresence 定期续期本节点上所有在线用户的记录
+func (s *websocketService) refreshPresence(ctx context.Context) {
+	ticker := time.NewTicker(presenceRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.clientsMutex.RLock()
+			userIDs := make([]int, 0, len(s.clients))
+			for userID := range s.clients {
+				userIDs = append(userIDs, userID)
+			}
+			s.clientsMutex.RUnlock()
+
+			refreshCtx, cancel := context.WithTimeout(ctx, busTimeout)
+			if err := s.presence.Refresh(refreshCtx, s.nodeID, userIDs); err != nil {
+				log.Printf("Failed to refresh presence: %v", err)
+			}
+			cancel()
 		}
-		log.Printf("Message sent from %d to %d (online)", client.UserID, msg.ReceiverID)
-	} else {
-		// 离线，消息已保存到数据库
-		log.Printf("Message saved for offline user %d", msg.ReceiverID)
 	}
+}
 
-	// 发送确认
-	client.Send <- model.WSMessage{
-		Type:      "message_sent",
-		Content:   "Message sent successfully",
-		MessageID: messageID,
+// reply 回复消息给连接本身，连接已被注销（发送通道已关闭）时丢弃
+func (s *websocketService) reply(client *model.WSClient, msg model.WSMessage) {
+	s.clientsMutex.RLock()
+	full := s.clients[client.UserID][client] && !enqueue(client, msg)
+	s.clientsMutex.RUnlock()
+
+	if full {
+		s.handleSlowConsumers([]*model.WSClient{client})
 	}
 }
 
+// ReadPump 读取客户端消息直到连接断开；超过 pongWait 未收到 pong 或任何消息（半开连接）、
+// 消息超过大小上限时读取失败，连接随之注销
 func (s *websocketService) ReadPump(client *model.WSClient, conn *websocket.Conn) {
 	defer func() {
-		s.UnregisterClient(client.UserID)
+		s.UnregisterClient(client)
 		conn.Close()
 	}()
 
+	codec := wire.ForSubprotocol(conn.Subprotocol())
+	conn.SetReadLimit(s.maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(s.pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.pongWait))
+	})
+
+	// 消息由提交协程按顺序写入消息队列，队列积压时不阻塞读取（心跳与 ping 照常处理）
+	submissions := make(chan model.WSMessage, submitQueueSize)
+	defer close(submissions)
+	go func() {
+		for msg := range submissions {
+			s.HandleMessage(client, msg)
+		}
+	}()
+
 	for {
 		var msg model.WSMessage
-		err := conn.ReadJSON(&msg)
+		err := wire.ReadMessage(conn, codec, &msg)
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			switch {
+			case errors.Is(err, websocket.ErrReadLimit):
+				log.Printf("User ID %d sent a message larger than %d bytes", client.UserID, s.maxMessageSize)
+			case errors.As(err, &netErr) && netErr.Timeout():
+				log.Printf("User ID %d heartbeat timed out", client.UserID)
+			case websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure):
 				log.Printf("WebSocket error: %v", err)
 			}
 			return
 		}
+		conn.SetReadDeadline(time.Now().Add(s.pongWait))
 
 		switch msg.Type {
 		case "message":
-			s.HandleMessage(client, msg)
+			select {
+			case submissions <- msg:
+			default:
+				s.reply(client, model.WSMessage{
+					Type:            "error",
+					ReceiverID:      msg.ReceiverID,
+					ClientMessageID: msg.ClientMessageID,
+					Content:         ErrPipelineBusy.Error(),
+				})
+			}
 		case "ping":
-			client.Send <- model.WSMessage{Type: "pong"}
+			s.reply(client, model.WSMessage{Type: "pong"})
 		}
 	}
 }
 
+// WritePump 写出发送队列中的消息并定期发送 ping，是唯一写连接的协程；写超时或写失败时关闭连接使 ReadPump 退出
 func (s *websocketService) WritePump(client *model.WSClient, conn *websocket.Conn) {
+	codec := wire.ForSubprotocol(conn.Subprotocol())
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+	defer s.pumps.Done()
+
 	for {
 		select {
 		case message, ok := <-client.Send:
+			conn.SetWriteDeadline(time.Now().Add(s.writeWait))
 			if !ok {
-				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// 发送队列中的消息已全部写出；关闭连接使 ReadPump 退出（会话被吊销、慢消费者被断开或服务端关闭时）
+				closeMessage := []byte{}
+				if client.CloseCode != 0 {
+					closeMessage = websocket.FormatCloseMessage(client.CloseCode, client.CloseReason)
+				}
+				conn.WriteMessage(websocket.CloseMessage, closeMessage)
+				conn.Close()
 				return
 			}
 
-			if err := conn.WriteJSON(message); err != nil {
+			if err := wire.WriteMessage(conn, codec, &message); err != nil {
+				conn.Close()
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(s.writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				conn.Close()
 				return
 			}
 		}
 	}
 }
+
+// seenEvent 返回转发事件是否已处理过，未处理过时记录下来；没有幂等键的事件总是处理
+func (s *websocketService) seenEvent(event *broker.Event) bool {
+	if event.EventID == "" {
+		return false
+	}
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+	return s.recent.seen(strconv.Itoa(event.UserID) + ":" + event.EventID)
+}
+
+// recentEvents 最近处理过的事件ID，超过容量时淘汰最早的
+type recentEvents struct {
+	ids   map[string]bool
+	order []string
+	next  int
+}
+
+func newRecentEvents(size int) *recentEvents {
+	return &recentEvents{
+		ids:   make(map[string]bool, size),
+		order: make([]string, size),
+	}
+}
+
+// seen 返回事件是否已处理过，未处理过时记录下来
+func (r *recentEvents) seen(id string) bool {
+	if r.ids[id] {
+		return true
+	}
+	delete(r.ids, r.order[r.next])
+	r.order[r.next] = id
+	r.ids[id] = true
+	r.next = (r.next + 1) % len(r.order)
+	return false
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+
+	"im-system/server/internal/broker"
+)
+
+func TestRecentEvents(t *testing.T) {
+	r := newRecentEvents(2)
+	steps := []struct {
+		id   string
+		want bool
+	}{
+		{"a", false},
+		{"a", true},
+		{"b", false},
+		{"a", true},
+		// 容量为 2，记录 c 时淘汰最早的 a
+		{"c", false},
+		{"b", true},
+		{"a", false},
+	}
+	for i, step := range steps {
+		if got := r.seen(step.id); got != step.want {
+			t.Fatalf("step %d: seen(%q) = %v, want %v", i, step.id, got, step.want)
+		}
+	}
+}
+
+func TestSeenEvent(t *testing.T) {
+	s := &websocketService{recent: newRecentEvents(recentEventsSize)}
+	tests := []struct {
+		name  string
+		event broker.Event
+		want  bool
+	}{
+		{"first delivery", broker.Event{UserID: 1, EventID: "message:42"}, false},
+		{"retried delivery", broker.Event{UserID: 1, EventID: "message:42"}, true},
+		{"same event for another user", broker.Event{UserID: 2, EventID: "message:42"}, false},
+		{"without event ID", broker.Event{UserID: 1}, false},
+		{"without event ID again", broker.Event{UserID: 1}, false},
+	}
+	for _, tt := range tests {
+		if got := s.seenEvent(&tt.event); got != tt.want {
+			t.Errorf("%s: seenEvent = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+// JWT 非对称签名算法
+const (
+	JWTAlgorithmES256 = "ES256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// ErrUnsupportedJWTAlgorithm 不支持的 JWT 签名算法
+var ErrUnsupportedJWTAlgorithm = errors.New("unsupported JWT algorithm, expected ES256 or EdDSA")
+
+// jwtKeyEncryptedPrefix 加密保存的签名私钥前缀，没有前缀的为旧版明文 PEM
+const jwtKeyEncryptedPrefix = "v1:"
+
+// SigningJWK JWKS 中发布的签名公钥（RFC 7517/7518/8037）
+type SigningJWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+// GenerateJWTSigningKey 按算法生成 P-256 或 Ed25519 签名私钥（PKCS#8 PEM 格式）
+func GenerateJWTSigningKey(algorithm string) (string, error) {
+	var key crypto.Signer
+	var err error
+	switch algorithm {
+	case JWTAlgorithmES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case JWTAlgorithmEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", ErrUnsupportedJWTAlgorithm
+	}
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})), nil
+}
+
+// ParseJWTSigningKey 解析 PKCS#8 PEM 格式的签名私钥，并校验与算法匹配
+func ParseJWTSigningKey(algorithm, privateKeyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block containing the JWT signing key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *ecdsa.PrivateKey:
+		if algorithm == JWTAlgorithmES256 && key.Curve == elliptic.P256() {
+			return key, nil
+		}
+	case ed25519.PrivateKey:
+		if algorithm == JWTAlgorithmEdDSA {
+			return key, nil
+		}
+	}
+	return nil, ErrUnsupportedJWTAlgorithm
+}
+
+// EncryptJWTSigningKey 使用 AES-256-GCM 加密签名私钥以便保存到数据库，kid 作为附加数据，
+// 密文被挪到其他行时无法解密
+func EncryptJWTSigningKey(encryptionKey []byte, kid, privateKeyPEM string) (string, error) {
+	aead, err := newJWTKeyAEAD(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(privateKeyPEM), []byte(kid))
+	return jwtKeyEncryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptJWTSigningKey 解密 EncryptJWTSigningKey 的结果；旧版明文 PEM 原样返回，legacy 为真
+func DecryptJWTSigningKey(encryptionKey []byte, kid, stored string) (privateKeyPEM string, legacy bool, err error) {
+	encoded, ok := strings.CutPrefix(stored, jwtKeyEncryptedPrefix)
+	if !ok {
+		return stored, true, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false, err
+	}
+	aead, err := newJWTKeyAEAD(encryptionKey)
+	if err != nil {
+		return "", false, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", false, errors.New("encrypted JWT signing key too short")
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(kid))
+	if err != nil {
+		return "", false, errors.New("failed to decrypt JWT signing key, check JWT_KEY_ENCRYPTION_KEY")
+	}
+	return string(plaintext), false, nil
+}
+
+func newJWTKeyAEAD(encryptionKey []byte) (cipher.AEAD, error) {
+	if len(encryptionKey) != 32 {
+		return nil, errors.New("JWT key encryption key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncodeSigningJWK 将签名公钥编码为 JWK
+func EncodeSigningJWK(kid, algorithm string, publicKey crypto.PublicKey) (*SigningJWK, error) {
+	jwk := &SigningJWK{Kid: kid, Alg: algorithm, Use: "sig"}
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		raw := ecdhKey.Bytes()
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = base64.RawURLEncoding.EncodeToString(raw[1:33])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(raw[33:])
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(key)
+	default:
+		return nil, ErrUnsupportedJWTAlgorithm
+	}
+	return jwk, nil
+}
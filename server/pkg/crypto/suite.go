@@ -0,0 +1,317 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"im-system/shared/keyencoding"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// SuiteID 加密套件标识，写在密文头部
+type SuiteID uint8
+
+const (
+	// SuiteP256AES256GCM ECDH P-256 + SHA-256 + AES-256-GCM（旧版密文使用的套件）
+	SuiteP256AES256GCM SuiteID = 1
+	// SuiteX25519ChaCha20Poly1305 X25519 + HKDF-SHA256 + ChaCha20-Poly1305
+	SuiteX25519ChaCha20Poly1305 SuiteID = 2
+)
+
+// ciphertextMagic 带套件头的密文首字节，旧版密文以未压缩点前缀 0x04 开头
+const ciphertextMagic = 0xC5
+
+var (
+	// ErrUnknownSuite 未知的加密套件
+	ErrUnknownSuite = errors.New("unknown cipher suite")
+	// ErrNoCommonSuite 没有与接收方公钥匹配且双方都支持的加密套件
+	ErrNoCommonSuite = errors.New("no common cipher suite for recipient key")
+)
+
+// CipherSuite 加密套件：密钥协商曲线、密钥派生与 AEAD 算法的组合
+type CipherSuite interface {
+	ID() SuiteID
+	Name() string
+	Curve() ecdh.Curve
+	// Seal 加密，返回不含套件头的密文体，additionalData 参与认证
+	Seal(recipient *ecdh.PublicKey, plaintext, additionalData []byte) ([]byte, error)
+	// Open 解密 Seal 生成的密文体
+	Open(privateKey *ecdh.PrivateKey, body, additionalData []byte) ([]byte, error)
+}
+
+// suites 已注册的加密套件，按默认优先级排列
+var suites = []CipherSuite{
+	p256AES256GCM{},
+	x25519ChaCha20Poly1305{},
+}
+
+// LookupSuite 按标识查找加密套件
+func LookupSuite(id SuiteID) (CipherSuite, error) {
+	for _, suite := range suites {
+		if suite.ID() == id {
+			return suite, nil
+		}
+	}
+	return nil, ErrUnknownSuite
+}
+
+// SuitesForKey 返回可用于该公钥的全部加密套件标识
+func SuitesForKey(publicKey string) ([]SuiteID, error) {
+	key, err := keyencoding.ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []SuiteID
+	for _, suite := range suites {
+		if suite.Curve() == key.Curve() {
+			ids = append(ids, suite.ID())
+		}
+	}
+	return ids, nil
+}
+
+// SelectSuite 按接收方公布的套件顺序选择第一个本地支持且与其公钥匹配的套件
+// 接收方未公布套件时视为旧版客户端，只能使用不带套件头的 P-256 密文
+func SelectSuite(publicKey string, advertised, supported []SuiteID) (CipherSuite, bool, error) {
+	key, err := keyencoding.ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(advertised) == 0 {
+		if key.Curve() != ecdh.P256() {
+			return nil, false, ErrNoCommonSuite
+		}
+		return p256AES256GCM{}, false, nil
+	}
+
+	for _, id := range advertised {
+		suite, err := LookupSuite(id)
+		if err != nil || suite.Curve() != key.Curve() || !containsSuite(supported, id) {
+			continue
+		}
+		return suite, true, nil
+	}
+	return nil, false, ErrNoCommonSuite
+}
+
+// Seal 使用指定套件加密，header 为 false 时输出旧版格式（仅限 P-256 套件）
+func Seal(suite CipherSuite, publicKey string, plaintext []byte, header bool) ([]byte, error) {
+	recipient, err := keyencoding.ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if recipient.Curve() != suite.Curve() {
+		return nil, ErrNoCommonSuite
+	}
+
+	if !header {
+		if suite.ID() != SuiteP256AES256GCM {
+			return nil, errors.New("only the P-256 suite supports headerless ciphertexts")
+		}
+		return suite.Seal(recipient, plaintext, nil)
+	}
+
+	// 套件头同时作为附加认证数据，防止密文被改写为其他套件
+	head := []byte{ciphertextMagic, byte(suite.ID())}
+	body, err := suite.Seal(recipient, plaintext, head)
+	if err != nil {
+		return nil, err
+	}
+	return append(head, body...), nil
+}
+
+// Open 根据密文头部选择套件解密，不带套件头的密文按旧版 P-256 格式处理
+func Open(privateKey string, ciphertext []byte) ([]byte, error) {
+	key, err := keyencoding.ParsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < 2 {
+		return nil, errors.New("invalid encrypted data format")
+	}
+
+	suite, body, additionalData := CipherSuite(p256AES256GCM{}), ciphertext, []byte(nil)
+	if ciphertext[0] == ciphertextMagic {
+		suite, err = LookupSuite(SuiteID(ciphertext[1]))
+		if err != nil {
+			return nil, err
+		}
+		body, additionalData = ciphertext[2:], ciphertext[:2]
+	}
+
+	if key.Curve() != suite.Curve() {
+		return nil, errors.New("ciphertext suite does not match private key")
+	}
+	return suite.Open(key, body, additionalData)
+}
+
+// ParseSuiteIDs 将整数列表转换为套件标识并过滤未知套件
+func ParseSuiteIDs(ids []int) []SuiteID {
+	var result []SuiteID
+	for _, id := range ids {
+		if id <= 0 || id > 255 {
+			continue
+		}
+		if _, err := LookupSuite(SuiteID(id)); err == nil && !containsSuite(result, SuiteID(id)) {
+			result = append(result, SuiteID(id))
+		}
+	}
+	return result
+}
+
+func containsSuite(ids []SuiteID, id SuiteID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// p256AES256GCM 密文体：临时公钥（65 字节）+ nonce + 密文
+type p256AES256GCM struct{}
+
+func (p256AES256GCM) ID() SuiteID       { return SuiteP256AES256GCM }
+func (p256AES256GCM) Name() string      { return "P256_SHA256_AES256GCM" }
+func (p256AES256GCM) Curve() ecdh.Curve { return ecdh.P256() }
+
+func (p256AES256GCM) Seal(recipient *ecdh.PublicKey, plaintext, additionalData []byte) ([]byte, error) {
+	// 生成临时 ECDH 密钥对并执行密钥交换
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用 SHA-256 派生加密密钥
+	hash := sha256.Sum256(sharedSecret)
+	gcm, err := newAESGCM(hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, additionalData)
+	return append(ephemeral.PublicKey().Bytes(), ciphertext...), nil
+}
+
+func (p256AES256GCM) Open(privateKey *ecdh.PrivateKey, body, additionalData []byte) ([]byte, error) {
+	// 提取临时公钥（P-256 公钥为 65 字节）
+	if len(body) < 65 {
+		return nil, errors.New("invalid encrypted data format")
+	}
+	ephemeral, err := ecdh.P256().NewPublicKey(body[:65])
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(sharedSecret)
+	gcm, err := newAESGCM(hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := body[65:]
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// x25519ChaCha20Poly1305 密文体：临时公钥（32 字节）+ nonce + 密文
+type x25519ChaCha20Poly1305 struct{}
+
+func (x25519ChaCha20Poly1305) ID() SuiteID       { return SuiteX25519ChaCha20Poly1305 }
+func (x25519ChaCha20Poly1305) Name() string      { return "X25519_HKDFSHA256_CHACHA20POLY1305" }
+func (x25519ChaCha20Poly1305) Curve() ecdh.Curve { return ecdh.X25519() }
+
+func (s x25519ChaCha20Poly1305) Seal(recipient *ecdh.PublicKey, plaintext, additionalData []byte) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := s.aead(sharedSecret, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ciphertext := aead.Seal(nonce, nonce, plaintext, additionalData)
+	return append(ephemeral.PublicKey().Bytes(), ciphertext...), nil
+}
+
+func (s x25519ChaCha20Poly1305) Open(privateKey *ecdh.PrivateKey, body, additionalData []byte) ([]byte, error) {
+	if len(body) < 32 {
+		return nil, errors.New("invalid encrypted data format")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(body[:32])
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := privateKey.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := s.aead(sharedSecret, body[:32], privateKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := body[32:]
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// aead 使用 HKDF-SHA256 从共享密钥派生 ChaCha20-Poly1305 密钥，info 绑定双方公钥
+func (s x25519ChaCha20Poly1305) aead(sharedSecret, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	info := append([]byte(s.Name()), ephemeral...)
+	info = append(info, recipient...)
+
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, nil, info), key); err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(key)
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
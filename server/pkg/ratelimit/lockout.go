@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Lockout 连续失败锁定接口
+type Lockout interface {
+	// Locked 返回 key 剩余的锁定时间，未锁定时返回 0
+	Locked(key string) time.Duration
+	// Fail 记录一次失败，本次失败触发锁定时返回锁定时长
+	Fail(key string) time.Duration
+	// Reset 成功后清除 key 的失败记录
+	Reset(key string)
+}
+
+// lockoutState 单个 key 的失败记录
+type lockoutState struct {
+	failures    int
+	level       int // 决定下一次锁定时长，锁定时长达到 max 后不再增加
+	lockedUntil time.Time
+	last        time.Time
+}
+
+// lockout 基于内存的渐进式锁定
+type lockout struct {
+	threshold int
+	base      time.Duration
+	max       time.Duration
+	forget    time.Duration // 超过该时间没有失败则清除记录
+	states    map[string]*lockoutState
+	mu        sync.Mutex
+}
+
+// NewLockout 创建内存锁定器：连续失败 threshold 次后锁定 base，之后每次锁定时长翻倍，最长 max
+func NewLockout(threshold int, base, max time.Duration) Lockout {
+	return &lockout{
+		threshold: threshold,
+		base:      base,
+		max:       max,
+		forget:    24 * time.Hour,
+		states:    make(map[string]*lockoutState),
+	}
+}
+
+func (l *lockout) Locked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.states[key]
+	if !ok {
+		return 0
+	}
+	if remaining := time.Until(state.lockedUntil); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (l *lockout) Fail(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	state, ok := l.states[key]
+	if !ok || now.Sub(state.last) > l.forget {
+		l.sweep(now)
+		state = &lockoutState{}
+		l.states[key] = state
+	}
+	state.last = now
+
+	state.failures++
+	if state.failures < l.threshold {
+		return 0
+	}
+
+	duration := l.base << state.level
+	if duration >= l.max || duration <= 0 {
+		duration = l.max
+	} else {
+		// 只在未达到上限时翻倍，level 有界，移位不会溢出
+		state.level++
+	}
+	state.failures = 0
+	state.lockedUntil = now.Add(duration)
+	return duration
+}
+
+func (l *lockout) Reset(key string) {
+	l.mu.Lock()
+	delete(l.states, key)
+	l.mu.Unlock()
+}
+
+// sweep 清理长时间没有失败的记录，避免内存无限增长
+func (l *lockout) sweep(now time.Time) {
+	if len(l.states) < 10000 {
+		return
+	}
+	for key, state := range l.states {
+		if now.Sub(state.last) > l.forget {
+			delete(l.states, key)
+		}
+	}
+}
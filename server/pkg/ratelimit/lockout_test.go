@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutFail(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		base, max time.Duration
+		// want 依次调用 Fail 的返回值
+		want []time.Duration
+	}{
+		{
+			name:      "locks after threshold",
+			threshold: 3, base: time.Minute, max: time.Hour,
+			want: []time.Duration{0, 0, time.Minute},
+		},
+		{
+			name:      "doubles each lockout",
+			threshold: 2, base: time.Minute, max: time.Hour,
+			want: []time.Duration{0, time.Minute, 0, 2 * time.Minute, 0, 4 * time.Minute},
+		},
+		{
+			name:      "capped at max",
+			threshold: 1, base: time.Minute, max: 5 * time.Minute,
+			want: []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLockout(tt.threshold, tt.base, tt.max)
+			for i, want := range tt.want {
+				if got := l.Fail("alice"); got != want {
+					t.Fatalf("Fail #%d = %v, want %v", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+// 锁定次数很多时 base << level 溢出，仍按 max 锁定
+func TestLockoutNeverExceedsMax(t *testing.T) {
+	l := NewLockout(1, time.Hour, 24*time.Hour)
+	for i := 0; i < 100; i++ {
+		if got := l.Fail("alice"); got <= 0 || got > 24*time.Hour {
+			t.Fatalf("Fail #%d = %v, want within (0, 24h]", i+1, got)
+		}
+	}
+}
+
+func TestLockoutLevelStopsAtMax(t *testing.T) {
+	l := NewLockout(1, time.Nanosecond, time.Hour)
+	for i := 0; i < 1000; i++ {
+		l.Fail("alice")
+	}
+	// 1ns << 42 > 1h，之后 level 不再增加，移位不会溢出回较短的锁定
+	if level := l.(*lockout).states["alice"].level; level > 42 {
+		t.Errorf("level = %d after reaching max, want at most 42", level)
+	}
+	if got := l.Fail("alice"); got != time.Hour {
+		t.Errorf("Fail after reaching max = %v, want %v", got, time.Hour)
+	}
+}
+
+func TestLockoutLocked(t *testing.T) {
+	l := NewLockout(2, time.Minute, time.Hour)
+
+	if got := l.Locked("alice"); got != 0 {
+		t.Fatalf("Locked before failures = %v, want 0", got)
+	}
+	l.Fail("alice")
+	if got := l.Locked("alice"); got != 0 {
+		t.Fatalf("Locked below threshold = %v, want 0", got)
+	}
+	l.Fail("alice")
+	if got := l.Locked("alice"); got <= 0 || got > time.Minute {
+		t.Fatalf("Locked after threshold = %v, want within (0, 1m]", got)
+	}
+	if got := l.Locked("bob"); got != 0 {
+		t.Errorf("Locked for another key = %v, want 0", got)
+	}
+
+	l.Reset("alice")
+	if got := l.Locked("alice"); got != 0 {
+		t.Errorf("Locked after Reset = %v, want 0", got)
+	}
+	// Reset 同时清除锁定级别，下一次锁定重新从 base 开始
+	l.Fail("alice")
+	if got := l.Fail("alice"); got != time.Minute {
+		t.Errorf("Fail after Reset = %v, want %v", got, time.Minute)
+	}
+}
+
+func TestLockoutExpires(t *testing.T) {
+	l := NewLockout(1, 20*time.Millisecond, time.Second)
+	if got := l.Fail("alice"); got != 20*time.Millisecond {
+		t.Fatalf("Fail = %v, want 20ms", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if got := l.Locked("alice"); got != 0 {
+		t.Errorf("Locked after lockout expired = %v, want 0", got)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	l := NewTokenBucket(time.Hour, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("alice"); !ok {
+			t.Fatalf("Allow #%d rejected within burst", i+1)
+		}
+	}
+	ok, wait := l.Allow("alice")
+	if ok || wait <= 0 || wait > time.Hour {
+		t.Errorf("Allow after burst = %v, %v, want rejected with wait within (0, 1h]", ok, wait)
+	}
+	if ok, _ := l.Allow("bob"); !ok {
+		t.Error("Allow for another key rejected")
+	}
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter 限流器接口
+type Limiter interface {
+	// Allow 消耗 key 对应的一个令牌，不允许时返回需要等待的时间
+	Allow(key string) (bool, time.Duration)
+}
+
+// bucket 令牌桶状态
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// tokenBucket 基于内存的令牌桶限流器
+type tokenBucket struct {
+	rate    float64 // 每秒补充的令牌数
+	burst   float64 // 桶容量
+	buckets map[string]*bucket
+	mu      sync.Mutex
+}
+
+// NewTokenBucket 创建内存令牌桶限流器，每 interval 补充一个令牌，最多累积 burst 个
+func NewTokenBucket(interval time.Duration, burst int) Limiter {
+	return &tokenBucket{
+		rate:    1 / interval.Seconds(),
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *tokenBucket) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		l.sweep(now)
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep 清理已经回满的令牌桶，避免内存无限增长
+func (l *tokenBucket) sweep(now time.Time) {
+	if len(l.buckets) < 10000 {
+		return
+	}
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis 键前缀
+const (
+	redisLimiterKey = "im:ratelimit:"
+	redisLockoutKey = "im:lockout:"
+)
+
+// redisTimeout 单次 Redis 调用的超时，超时或出错时退回本实例的内存计数
+const redisTimeout = 500 * time.Millisecond
+
+// tokenBucketScript 原子地补充并消耗令牌，时间取 Redis 服务器时间，避免各实例时钟不一致
+// KEYS[1] 令牌桶；ARGV[1] 每秒补充的令牌数，ARGV[2] 桶容量；返回 {是否允许, 需要等待的秒数}
+var tokenBucketScript = redis.NewScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = (1 - tokens) / rate
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return {allowed, tostring(wait)}
+`)
+
+// lockoutFailScript 记录一次失败，达到阈值时设置锁定键并返回锁定时长（毫秒）
+// KEYS[1] 失败计数，KEYS[2] 锁定键；ARGV 依次为阈值、首次锁定时长、锁定时长上限、记录保留时间（毫秒）
+var lockoutFailScript = redis.NewScript(`
+local threshold = tonumber(ARGV[1])
+local base = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+if failures < threshold then
+  return 0
+end
+local level = tonumber(redis.call('HGET', KEYS[1], 'level') or '0')
+local duration = base * 2 ^ level
+if duration >= max then
+  duration = max
+else
+  level = level + 1
+end
+duration = math.floor(duration)
+redis.call('HSET', KEYS[1], 'failures', 0, 'level', level)
+redis.call('SET', KEYS[2], 1, 'PX', duration)
+return duration
+`)
+
+// redisStore 计数保存在 Redis 中，多实例部署时各实例共享限额
+type redisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore 创建基于 Redis 的限流存储，client 由调用方关闭
+func NewRedisStore(client *redis.Client) Store {
+	return &redisStore{client: client}
+}
+
+func (s *redisStore) NewTokenBucket(name string, interval time.Duration, burst int) Limiter {
+	return &redisTokenBucket{
+		client:   s.client,
+		prefix:   redisLimiterKey + name + ":",
+		rate:     1 / interval.Seconds(),
+		burst:    burst,
+		fallback: NewTokenBucket(interval, burst),
+	}
+}
+
+func (s *redisStore) NewLockout(name string, threshold int, base, max time.Duration) Lockout {
+	return &redisLockout{
+		client:    s.client,
+		prefix:    redisLockoutKey + name + ":",
+		threshold: threshold,
+		base:      base,
+		max:       max,
+		forget:    24 * time.Hour,
+		fallback:  NewLockout(threshold, base, max),
+	}
+}
+
+// redisTokenBucket 基于 Redis 的令牌桶，Redis 不可用时使用本实例的内存令牌桶
+type redisTokenBucket struct {
+	client   *redis.Client
+	prefix   string
+	rate     float64
+	burst    int
+	fallback Limiter
+}
+
+func (l *redisTokenBucket) Allow(key string) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	result, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key}, l.rate, l.burst).Slice()
+	if err != nil || len(result) != 2 {
+		log.Printf("Redis rate limiter unavailable, using local limit: %v", err)
+		return l.fallback.Allow(key)
+	}
+
+	allowed, _ := result[0].(int64)
+	waitText, _ := result[1].(string)
+	wait, _ := strconv.ParseFloat(waitText, 64)
+	return allowed == 1, time.Duration(wait * float64(time.Second))
+}
+
+// redisLockout 基于 Redis 的渐进式锁定，Redis 不可用时使用本实例的内存记录
+type redisLockout struct {
+	client    *redis.Client
+	prefix    string
+	threshold int
+	base      time.Duration
+	max       time.Duration
+	forget    time.Duration
+	fallback  Lockout
+}
+
+func (l *redisLockout) keys(key string) []string {
+	return []string{l.prefix + key, l.prefix + key + ":locked"}
+}
+
+func (l *redisLockout) Locked(key string) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	remaining, err := l.client.PTTL(ctx, l.keys(key)[1]).Result()
+	if err != nil {
+		log.Printf("Redis lockout unavailable, using local state: %v", err)
+		return l.fallback.Locked(key)
+	}
+	// 键不存在时 PTTL 返回负值
+	if remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (l *redisLockout) Fail(key string) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	duration, err := lockoutFailScript.Run(ctx, l.client, l.keys(key),
+		l.threshold, l.base.Milliseconds(), l.max.Milliseconds(), l.forget.Milliseconds(),
+	).Int64()
+	if err != nil {
+		log.Printf("Redis lockout unavailable, using local state: %v", err)
+		return l.fallback.Fail(key)
+	}
+	return time.Duration(duration) * time.Millisecond
+}
+
+func (l *redisLockout) Reset(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	if err := l.client.Del(ctx, l.keys(key)...).Err(); err != nil {
+		log.Printf("Redis lockout unavailable, resetting local state only: %v", err)
+	}
+	l.fallback.Reset(key)
+}
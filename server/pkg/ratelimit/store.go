@@ -0,0 +1,25 @@
+package ratelimit
+
+import "time"
+
+// Store 按名称创建限流器与锁定器，name 区分不同用途的计数
+type Store interface {
+	NewTokenBucket(name string, interval time.Duration, burst int) Limiter
+	NewLockout(name string, threshold int, base, max time.Duration) Lockout
+}
+
+// memoryStore 计数保存在进程内，仅适用于单实例部署
+type memoryStore struct{}
+
+// NewMemoryStore 创建进程内的限流存储
+func NewMemoryStore() Store {
+	return memoryStore{}
+}
+
+func (memoryStore) NewTokenBucket(name string, interval time.Duration, burst int) Limiter {
+	return NewTokenBucket(interval, burst)
+}
+
+func (memoryStore) NewLockout(name string, threshold int, base, max time.Duration) Lockout {
+	return NewLockout(threshold, base, max)
+}
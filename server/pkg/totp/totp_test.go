@@ -0,0 +1,99 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录 B 的 SHA-1 密钥 "12345678901234567890"（Base32）
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 附录 B 的 SHA-1 测试向量，验证码取 8 位结果的后 6 位
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		got, err := Code(rfc6238Secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.code {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestCodeSecretFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{"lower case", strings.ToLower(rfc6238Secret)},
+		{"padded", rfc6238Secret + "===="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Code(tt.secret, Step(time.Unix(59, 0)))
+			if err != nil || got != "287082" {
+				t.Errorf("Code = %q, %v, want 287082", got, err)
+			}
+		})
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code with invalid secret succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	previous, _ := Code(rfc6238Secret, step-1)
+	next, _ := Code(rfc6238Secret, step+1)
+	stale, _ := Code(rfc6238Secret, step-2)
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current", "050471", 1, step, true},
+		{"surrounding spaces", " 050471 ", 1, step, true},
+		{"previous step within skew", previous, 1, step - 1, true},
+		{"next step within skew", next, 1, step + 1, true},
+		{"previous step without skew", previous, 0, 0, false},
+		{"outside skew", stale, 1, 0, false},
+		{"wrong code", "000000", 1, 0, false},
+		{"too short", "05047", 1, 0, false},
+		{"too long", "0504710", 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := Validate(rfc6238Secret, tt.code, now, tt.skew)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", tt.code, gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	got := ProvisioningURI("IM System", "alice@example", "SECRET")
+	want := "otpauth://totp/IM%20System:alice@example?algorithm=SHA1&digits=6&issuer=IM%20System&period=30&secret=SECRET"
+	if got != want {
+		t.Errorf("ProvisioningURI = %s, want %s", got, want)
+	}
+}
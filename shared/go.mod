@@ -0,0 +1,5 @@
+module im-system/shared
+
+go 1.21
+
+require google.golang.org/protobuf v1.34.1
@@ -0,0 +1,310 @@
+// Package keyencoding 服务端与客户端共用的 P-256 / X25519 公私钥编码与解析（PEM、JWK 与旧版格式）
+package keyencoding
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// ErrUnsupportedKey 无法识别的密钥格式或不支持的曲线
+var ErrUnsupportedKey = errors.New("unsupported key format, expected a P-256 or X25519 key")
+
+// JWK P-256（kty=EC）或 X25519（kty=OKP）密钥的 JSON Web Key 表示（RFC 7517/7518/8037）
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	D   string `json:"d,omitempty"`
+}
+
+// ParsePublicKey 解析 P-256 或 X25519 公钥
+// 支持 PKIX（SubjectPublicKeyInfo）PEM、JWK，以及旧版 "EC PUBLIC KEY" 下的原始点或 SPKI
+func ParsePublicKey(publicKey string) (*ecdh.PublicKey, error) {
+	if isJWK(publicKey) {
+		jwk, err := parseJWK(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		return jwk.publicKey()
+	}
+
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block containing the key")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return parsePKIXPublicKey(block.Bytes)
+	case "EC PUBLIC KEY":
+		// 旧版格式为未压缩的原始点，浏览器生成的旧密钥为 SPKI
+		if key, err := ecdh.P256().NewPublicKey(block.Bytes); err == nil {
+			return key, nil
+		}
+		return parsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// ParsePrivateKey 解析 P-256 或 X25519 私钥
+// 支持 PKCS#8 PEM、SEC1 PEM（仅 P-256）、JWK，以及旧版 "EC PRIVATE KEY" 下的原始 32 字节标量或 PKCS#8
+func ParsePrivateKey(privateKey string) (*ecdh.PrivateKey, error) {
+	if isJWK(privateKey) {
+		jwk, err := parseJWK(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return jwk.privateKey()
+	}
+
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, errors.New("failed to parse PEM block containing the key")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return parsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		if len(block.Bytes) == 32 {
+			return ecdh.P256().NewPrivateKey(block.Bytes)
+		}
+		if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+			return ecdsaToECDHPrivate(key)
+		}
+		// 浏览器生成的旧私钥为 PKCS#8
+		return parsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// EncodePublicKeyPEM 将公钥编码为 PKIX PEM 格式
+func EncodePublicKeyPEM(key *ecdh.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	})), nil
+}
+
+// EncodePrivateKeyPEM 将私钥编码为 PKCS#8 PEM 格式
+func EncodePrivateKeyPEM(key *ecdh.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})), nil
+}
+
+// EncodeSEC1PrivateKeyPEM 将 P-256 私钥编码为 SEC1 PEM 格式（"EC PRIVATE KEY"，openssl ec 的默认格式）
+func EncodeSEC1PrivateKeyPEM(key *ecdh.PrivateKey) (string, error) {
+	if key.Curve() != ecdh.P256() {
+		return "", ErrUnsupportedKey
+	}
+	der, err := x509.MarshalECPrivateKey(ecdhToECDSAPrivate(key))
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: der,
+	})), nil
+}
+
+// EncodePublicKeyJWK 将公钥编码为 JWK
+func EncodePublicKeyJWK(key *ecdh.PublicKey) (string, error) {
+	return marshalJWK(publicJWK(key))
+}
+
+// EncodePrivateKeyJWK 将私钥编码为 JWK（包含公钥坐标）
+func EncodePrivateKeyJWK(key *ecdh.PrivateKey) (string, error) {
+	jwk := publicJWK(key.PublicKey())
+	jwk.D = base64.RawURLEncoding.EncodeToString(key.Bytes())
+	return marshalJWK(jwk)
+}
+
+// NormalizePublicKey 将任意支持格式的公钥转换为 PKIX PEM 格式
+func NormalizePublicKey(publicKey string) (string, error) {
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return EncodePublicKeyPEM(key)
+}
+
+// 辅助函数
+func isJWK(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), "{")
+}
+
+func parseJWK(s string) (*JWK, error) {
+	var jwk JWK
+	if err := json.Unmarshal([]byte(s), &jwk); err != nil {
+		return nil, err
+	}
+	if (jwk.Kty != "EC" || jwk.Crv != "P-256") && (jwk.Kty != "OKP" || jwk.Crv != "X25519") {
+		return nil, ErrUnsupportedKey
+	}
+	return &jwk, nil
+}
+
+func publicJWK(key *ecdh.PublicKey) *JWK {
+	raw := key.Bytes()
+	if key.Curve() == ecdh.X25519() {
+		return &JWK{
+			Kty: "OKP",
+			Crv: "X25519",
+			X:   base64.RawURLEncoding.EncodeToString(raw),
+		}
+	}
+	return &JWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(raw[1:33]),
+		Y:   base64.RawURLEncoding.EncodeToString(raw[33:]),
+	}
+}
+
+func (j *JWK) curve() ecdh.Curve {
+	if j.Kty == "OKP" {
+		return ecdh.X25519()
+	}
+	return ecdh.P256()
+}
+
+func marshalJWK(jwk *JWK) (string, error) {
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (j *JWK) publicKey() (*ecdh.PublicKey, error) {
+	x, err := decodeCoordinate(j.X)
+	if err != nil {
+		return nil, err
+	}
+	if j.Kty == "OKP" {
+		return ecdh.X25519().NewPublicKey(x)
+	}
+	y, err := decodeCoordinate(j.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 0, 65)
+	raw = append(raw, 0x04)
+	raw = append(raw, x...)
+	raw = append(raw, y...)
+	return ecdh.P256().NewPublicKey(raw)
+}
+
+func (j *JWK) privateKey() (*ecdh.PrivateKey, error) {
+	d, err := decodeCoordinate(j.D)
+	if err != nil {
+		return nil, err
+	}
+	key, err := j.curve().NewPrivateKey(d)
+	if err != nil {
+		return nil, err
+	}
+
+	// 若 JWK 中带有公钥坐标，需与私钥一致
+	if j.X != "" {
+		publicKey, err := j.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		if !publicKey.Equal(key.PublicKey()) {
+			return nil, errors.New("JWK public and private components do not match")
+		}
+	}
+	return key, nil
+}
+
+func decodeCoordinate(s string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, errors.New("invalid JWK coordinate length")
+	}
+	return b, nil
+}
+
+func parsePKIXPublicKey(der []byte) (*ecdh.PublicKey, error) {
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	switch key := parsed.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return nil, ErrUnsupportedKey
+		}
+		return key.ECDH()
+	case *ecdh.PublicKey:
+		if key.Curve() != ecdh.X25519() {
+			return nil, ErrUnsupportedKey
+		}
+		return key, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+func parsePKCS8PrivateKey(der []byte) (*ecdh.PrivateKey, error) {
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	switch key := parsed.(type) {
+	case *ecdsa.PrivateKey:
+		return ecdsaToECDHPrivate(key)
+	case *ecdh.PrivateKey:
+		if key.Curve() != ecdh.X25519() {
+			return nil, ErrUnsupportedKey
+		}
+		return key, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+func ecdsaToECDHPrivate(key *ecdsa.PrivateKey) (*ecdh.PrivateKey, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, ErrUnsupportedKey
+	}
+	return key.ECDH()
+}
+
+func ecdhToECDSAPrivate(key *ecdh.PrivateKey) *ecdsa.PrivateKey {
+	raw := key.PublicKey().Bytes()
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(raw[1:33]),
+			Y:     new(big.Int).SetBytes(raw[33:]),
+		},
+		D: new(big.Int).SetBytes(key.Bytes()),
+	}
+}
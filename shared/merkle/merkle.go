@@ -0,0 +1,174 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// 叶子与内部节点的哈希前缀（RFC 6962）
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// LeafHash 计算叶子哈希 SHA-256(0x00 || data)
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NodeHash 计算内部节点哈希 SHA-256(0x01 || left || right)
+func NodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// RootHash 计算由叶子哈希构成的 Merkle 树根哈希
+func RootHash(leaves [][]byte) []byte {
+	n := len(leaves)
+	switch n {
+	case 0:
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	case 1:
+		return leaves[0]
+	}
+
+	k := splitPoint(n)
+	return NodeHash(RootHash(leaves[:k]), RootHash(leaves[k:]))
+}
+
+// InclusionProof 生成第 index 个叶子在树中的审计路径
+func InclusionProof(index int, leaves [][]byte) [][]byte {
+	n := len(leaves)
+	if index < 0 || index >= n || n == 1 {
+		return [][]byte{}
+	}
+
+	k := splitPoint(n)
+	if index < k {
+		return append(InclusionProof(index, leaves[:k]), RootHash(leaves[k:]))
+	}
+	return append(InclusionProof(index-k, leaves[k:]), RootHash(leaves[:k]))
+}
+
+// ConsistencyProof 生成大小为 m 的旧树与当前树之间的一致性证明
+func ConsistencyProof(m int, leaves [][]byte) [][]byte {
+	if m <= 0 || m > len(leaves) {
+		return [][]byte{}
+	}
+	return subProof(m, leaves, true)
+}
+
+func subProof(m int, leaves [][]byte, complete bool) [][]byte {
+	n := len(leaves)
+	if m == n {
+		if complete {
+			return [][]byte{}
+		}
+		return [][]byte{RootHash(leaves)}
+	}
+
+	k := splitPoint(n)
+	if m <= k {
+		return append(subProof(m, leaves[:k], complete), RootHash(leaves[k:]))
+	}
+	return append(subProof(m-k, leaves[k:], false), RootHash(leaves[:k]))
+}
+
+// VerifyInclusion 校验叶子的审计路径（RFC 9162 2.1.3.2）
+func VerifyInclusion(index, size int64, leafHash []byte, proof [][]byte, root []byte) bool {
+	if index < 0 || index >= size {
+		return false
+	}
+
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	return sn == 0 && bytes.Equal(r, root)
+}
+
+// VerifyConsistency 校验两个树头之间的一致性证明（RFC 9162 2.1.4.2）
+func VerifyConsistency(first, second int64, proof [][]byte, firstRoot, secondRoot []byte) bool {
+	if first <= 0 || first > second {
+		return false
+	}
+	if first == second {
+		return len(proof) == 0 && bytes.Equal(firstRoot, secondRoot)
+	}
+	if len(proof) == 0 {
+		return false
+	}
+
+	// 旧树大小为 2 的幂时，旧根本身就是证明的起点
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	return sn == 0 && bytes.Equal(fr, firstRoot) && bytes.Equal(sr, secondRoot)
+}
+
+// TreeHeadSignatureInput 构造树头签名的输入数据
+func TreeHeadSignatureInput(treeSize, timestamp int64, rootHash []byte) []byte {
+	buf := make([]byte, 0, 16+len(rootHash)+16)
+	buf = append(buf, []byte("im-keylog-sth-v1")...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(treeSize))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(timestamp))
+	return append(buf, rootHash...)
+}
+
+// splitPoint 返回小于 n 的最大 2 的幂
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
@@ -0,0 +1,224 @@
+package merkle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// rfc6962Leaves RFC 6962 参考实现（certificate-transparency）测试使用的叶子数据
+var rfc6962Leaves = []string{
+	"",
+	"00",
+	"10",
+	"2021",
+	"3031",
+	"40414243",
+	"5051525354555657",
+	"606162636465666768696a6b6c6d6e6f",
+}
+
+func testLeaves(t *testing.T, n int) [][]byte {
+	t.Helper()
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		if i < len(rfc6962Leaves) {
+			data, err := hex.DecodeString(rfc6962Leaves[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaves[i] = LeafHash(data)
+		} else {
+			leaves[i] = LeafHash([]byte(fmt.Sprint(i)))
+		}
+	}
+	return leaves
+}
+
+func TestRootHash(t *testing.T) {
+	tests := []struct {
+		size int
+		root string
+	}{
+		{0, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{1, "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d"},
+		{2, "fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125"},
+		{3, "aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77"},
+		{4, "d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7"},
+		{5, "4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4"},
+		{6, "76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef"},
+		{7, "ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c"},
+		{8, "5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(RootHash(testLeaves(t, tt.size)))
+		if got != tt.root {
+			t.Errorf("RootHash(%d leaves) = %s, want %s", tt.size, got, tt.root)
+		}
+	}
+}
+
+func TestInclusionProof(t *testing.T) {
+	for size := 1; size <= 33; size++ {
+		leaves := testLeaves(t, size)
+		root := RootHash(leaves)
+		for index := 0; index < size; index++ {
+			proof := InclusionProof(index, leaves)
+			i, n := int64(index), int64(size)
+			if !VerifyInclusion(i, n, leaves[index], proof, root) {
+				t.Fatalf("size %d index %d: valid proof rejected", size, index)
+			}
+
+			// 叶子、位置或证明任一不符时校验失败
+			other := LeafHash([]byte("other"))
+			if VerifyInclusion(i, n, other, proof, root) {
+				t.Errorf("size %d index %d: proof accepted for another leaf", size, index)
+			}
+			if size > 1 && VerifyInclusion((i+1)%n, n, leaves[index], proof, root) {
+				t.Errorf("size %d index %d: proof accepted at another index", size, index)
+			}
+			if len(proof) > 0 {
+				tampered := append([][]byte{}, proof...)
+				tampered[0] = other
+				if VerifyInclusion(i, n, leaves[index], tampered, root) {
+					t.Errorf("size %d index %d: tampered proof accepted", size, index)
+				}
+				if VerifyInclusion(i, n, leaves[index], proof[:len(proof)-1], root) {
+					t.Errorf("size %d index %d: truncated proof accepted", size, index)
+				}
+			}
+		}
+	}
+}
+
+func TestInclusionProofOutOfRange(t *testing.T) {
+	leaves := testLeaves(t, 4)
+	root := RootHash(leaves)
+	tests := []struct {
+		name        string
+		index, size int64
+	}{
+		{"negative index", -1, 4},
+		{"index equals size", 4, 4},
+		{"empty tree", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyInclusion(tt.index, tt.size, leaves[0], InclusionProof(int(tt.index), leaves), root) {
+				t.Error("out of range proof accepted")
+			}
+		})
+	}
+}
+
+func TestConsistencyProof(t *testing.T) {
+	for second := 1; second <= 33; second++ {
+		leaves := testLeaves(t, second)
+		secondRoot := RootHash(leaves)
+		for first := 1; first <= second; first++ {
+			firstRoot := RootHash(leaves[:first])
+			proof := ConsistencyProof(first, leaves)
+			m, n := int64(first), int64(second)
+			if !VerifyConsistency(m, n, proof, firstRoot, secondRoot) {
+				t.Fatalf("%d -> %d: valid proof rejected", first, second)
+			}
+
+			other := LeafHash([]byte("other"))
+			if VerifyConsistency(m, n, proof, other, secondRoot) {
+				t.Errorf("%d -> %d: proof accepted for another old root", first, second)
+			}
+			if VerifyConsistency(m, n, proof, firstRoot, other) {
+				t.Errorf("%d -> %d: proof accepted for another new root", first, second)
+			}
+			if len(proof) > 0 {
+				tampered := append([][]byte{}, proof...)
+				tampered[len(tampered)-1] = other
+				if VerifyConsistency(m, n, tampered, firstRoot, secondRoot) {
+					t.Errorf("%d -> %d: tampered proof accepted", first, second)
+				}
+			}
+		}
+	}
+}
+
+func TestConsistencyProofInvalidSizes(t *testing.T) {
+	leaves := testLeaves(t, 8)
+	root := RootHash(leaves)
+	tests := []struct {
+		name          string
+		first, second int64
+	}{
+		{"empty old tree", 0, 8},
+		{"old tree larger", 9, 8},
+		{"same size with proof", 8, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyConsistency(tt.first, tt.second, [][]byte{root}, root, root) {
+				t.Error("invalid sizes accepted")
+			}
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	leaves := testLeaves(t, 70)
+	var tree Tree
+	for size := 0; size <= len(leaves); size++ {
+		if size > 0 {
+			tree.Append(leaves[size-1])
+		}
+		if tree.Size() != int64(size) {
+			t.Fatalf("Size = %d, want %d", tree.Size(), size)
+		}
+		if !bytes.Equal(tree.Root(), RootHash(leaves[:size])) {
+			t.Fatalf("size %d: Root differs from RootHash", size)
+		}
+		if len(tree.Leaves()) != size {
+			t.Fatalf("size %d: Leaves has %d entries", size, len(tree.Leaves()))
+		}
+	}
+}
+
+func TestTreeProofs(t *testing.T) {
+	leaves := testLeaves(t, 40)
+	var tree Tree
+	for _, leaf := range leaves {
+		tree.Append(leaf)
+	}
+
+	for size := 1; size <= len(leaves); size++ {
+		for i := 0; i < size; i++ {
+			got := tree.InclusionProof(int64(i), int64(size))
+			if !equalProofs(got, InclusionProof(i, leaves[:size])) {
+				t.Fatalf("InclusionProof(%d, %d) differs from InclusionProof", i, size)
+			}
+		}
+		for m := 1; m <= size; m++ {
+			got := tree.ConsistencyProof(int64(m), int64(size))
+			if !equalProofs(got, ConsistencyProof(m, leaves[:size])) {
+				t.Fatalf("ConsistencyProof(%d, %d) differs from ConsistencyProof", m, size)
+			}
+		}
+	}
+
+	if len(tree.InclusionProof(0, int64(len(leaves)+1))) != 0 {
+		t.Error("InclusionProof beyond the tree size should be empty")
+	}
+	if len(tree.ConsistencyProof(1, int64(len(leaves)+1))) != 0 {
+		t.Error("ConsistencyProof beyond the tree size should be empty")
+	}
+}
+
+func equalProofs(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"math/bits"
+)
+
+// Tree 只追加的 Merkle 树，缓存全部完全子树的根哈希
+// 追加叶子为均摊 O(1)，根哈希与证明只需 O(log² n) 次哈希，不随日志增长重算全部叶子
+type Tree struct {
+	// levels[l][i] 为第 i 个由 2^l 个叶子构成的完全子树的根，levels[0] 为叶子哈希
+	levels [][][]byte
+}
+
+// Append 追加叶子哈希
+func (t *Tree) Append(leafHash []byte) {
+	if len(t.levels) == 0 {
+		t.levels = append(t.levels, nil)
+	}
+	t.levels[0] = append(t.levels[0], leafHash)
+
+	// 同一层凑齐一对时生成上一层的完全子树
+	for l := 0; len(t.levels[l])%2 == 0; l++ {
+		n := len(t.levels[l])
+		if l+1 == len(t.levels) {
+			t.levels = append(t.levels, nil)
+		}
+		t.levels[l+1] = append(t.levels[l+1], NodeHash(t.levels[l][n-2], t.levels[l][n-1]))
+	}
+}
+
+// Size 叶子数
+func (t *Tree) Size() int64 {
+	if len(t.levels) == 0 {
+		return 0
+	}
+	return int64(len(t.levels[0]))
+}
+
+// Root 当前树的根哈希，与 RootHash(t.Leaves()) 相同
+func (t *Tree) Root() []byte {
+	size := int(t.Size())
+	if size == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+	return t.subtreeHash(0, size)
+}
+
+// Leaves 当前全部叶子哈希，调用方不得修改
+func (t *Tree) Leaves() [][]byte {
+	if len(t.levels) == 0 {
+		return nil
+	}
+	return t.levels[0][:len(t.levels[0]):len(t.levels[0])]
+}
+
+// InclusionProof 第 index 个叶子在前 size 个叶子构成的树中的审计路径，与 InclusionProof(index, t.Leaves()[:size]) 相同
+func (t *Tree) InclusionProof(index, size int64) [][]byte {
+	if index < 0 || index >= size || size > t.Size() {
+		return [][]byte{}
+	}
+	return t.inclusionProof(int(index), 0, int(size))
+}
+
+// ConsistencyProof 大小为 m 与 size 的两棵树之间的一致性证明，与 ConsistencyProof(m, t.Leaves()[:size]) 相同
+func (t *Tree) ConsistencyProof(m, size int64) [][]byte {
+	if m <= 0 || m > size || size > t.Size() {
+		return [][]byte{}
+	}
+	return t.subProof(int(m), 0, int(size), true)
+}
+
+func (t *Tree) inclusionProof(index, start, n int) [][]byte {
+	if n == 1 {
+		return [][]byte{}
+	}
+
+	k := splitPoint(n)
+	if index < k {
+		return append(t.inclusionProof(index, start, k), t.subtreeHash(start+k, n-k))
+	}
+	return append(t.inclusionProof(index-k, start+k, n-k), t.subtreeHash(start, k))
+}
+
+func (t *Tree) subProof(m, start, n int, complete bool) [][]byte {
+	if m == n {
+		if complete {
+			return [][]byte{}
+		}
+		return [][]byte{t.subtreeHash(start, n)}
+	}
+
+	k := splitPoint(n)
+	if m <= k {
+		return append(t.subProof(m, start, k, complete), t.subtreeHash(start+k, n-k))
+	}
+	return append(t.subProof(m-k, start+k, n-k, false), t.subtreeHash(start, k))
+}
+
+// subtreeHash 从 start 开始的 n 个叶子构成的子树根，完全子树直接取缓存
+func (t *Tree) subtreeHash(start, n int) []byte {
+	if n&(n-1) == 0 && start%n == 0 {
+		l := bits.TrailingZeros(uint(n))
+		return t.levels[l][start>>l]
+	}
+
+	k := splitPoint(n)
+	return NodeHash(t.subtreeHash(start, k), t.subtreeHash(start+k, n-k))
+}
@@ -0,0 +1,4 @@
+// Package wsproto 由 websocket.proto 生成的 WebSocket 帧 Protobuf 类型
+package wsproto
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative websocket.proto